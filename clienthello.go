@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"runtime"
-	"sort"
 
 	"github.com/gaukas/clienthellod/internal/utils"
 	tls "github.com/refraction-networking/utls"
@@ -17,11 +16,19 @@ import (
 
 // ClientHello represents a captured ClientHello message with all fingerprintable fields.
 type ClientHello struct {
-	raw []byte
+	raw       []byte // all TLS records carrying the ClientHello, as read
+	handshake []byte // ClientHello handshake message reassembled from the TLS records
 
 	TLSRecordVersion    uint16 `json:"tls_record_version"`    // TLS record version (major, minor)
 	TLSHandshakeVersion uint16 `json:"tls_handshake_version"` // TLS handshake version (major, minor)
 
+	TLSRecordCount   int   `json:"tls_record_count"`   // number of TLS records carrying the ClientHello
+	TLSRecordLengths []int `json:"tls_record_lengths"` // length of each TLS record carrying the ClientHello
+
+	SSLv2                bool     `json:"sslv2,omitempty"`                  // sent in the SSLv2-compatible format, with TLSRecordVersion set to SSLV2_RECORD_VERSION
+	SSLv2CipherSpecs     []uint32 `json:"sslv2_cipher_specs,omitempty"`     // all 3-byte cipher specs of an SSLv2-compatible ClientHello
+	SSLv2ChallengeLength int      `json:"sslv2_challenge_length,omitempty"` // challenge length of an SSLv2-compatible ClientHello
+
 	CipherSuites         []uint16       `json:"cipher_suites"`
 	CompressionMethods   utils.Uint8Arr `json:"compression_methods"`
 	Extensions           []uint16       `json:"extensions"`            // extension IDs in original order
@@ -39,25 +46,68 @@ type ClientHello struct {
 	KeyShare            []uint16       `json:"key_share"`              // key_share(51)
 	ApplicationSettings []string       `json:"application_settings"`   // application_settings(17513) a.k.a ALPS
 
+	StatusRequest              *StatusRequestExtension        `json:"status_request,omitempty"`               // status_request(5)
+	SignedCertificateTimestamp bool                           `json:"signed_certificate_timestamp,omitempty"` // signed_certificate_timestamp(18)
+	PaddingLength              int                            `json:"padding_length,omitempty"`               // padding(21)
+	EncryptThenMAC             bool                           `json:"encrypt_then_mac,omitempty"`             // encrypt_then_mac(22)
+	ExtendedMasterSecret       bool                           `json:"extended_master_secret,omitempty"`       // extended_master_secret(23)
+	DelegatedCredentials       []uint16                       `json:"delegated_credentials,omitempty"`        // delegated_credentials(34)
+	SessionTicket              *SessionTicketExtension        `json:"session_ticket,omitempty"`               // session_ticket(35)
+	PreSharedKey               *PreSharedKeyExtension         `json:"pre_shared_key,omitempty"`               // pre_shared_key(41)
+	EarlyData                  bool                           `json:"early_data,omitempty"`                   // early_data(42)
+	CookieLength               int                            `json:"cookie_length,omitempty"`                // cookie(44)
+	PostHandshakeAuth          bool                           `json:"post_handshake_auth,omitempty"`          // post_handshake_auth(49)
+	EncryptedClientHello       *EncryptedClientHelloExtension `json:"encrypted_client_hello,omitempty"`       // encrypted_client_hello(65037)
+	RenegotiationInfo          *RenegotiationInfoExtension    `json:"renegotiation_info,omitempty"`           // renegotiation_info(65281)
+
+	MalformedExtensions []uint16 `json:"malformed_extensions,omitempty"` // extensions whose payload could not be decoded into the fields above
+
+	KeyShareAnalysis *KeyShareAnalysis `json:"key_share_analysis,omitempty"` // key_share(51) entries checked against supported_groups(10)
+	GREASE           *GREASEAnalysis   `json:"grease,omitempty"`             // GREASE values as sent, nil if none
+
+	InnerClientHello *ClientHello `json:"inner_client_hello,omitempty"` // decrypted from encrypted_client_hello, if ECH keys are set
+
 	UserAgent string `json:"user_agent,omitempty"` // User-Agent header, set by the caller
 
+	FingerprintScheme   string `json:"fingerprint_scheme,omitempty"`   // identifier of the scheme used to calculate the IDs below
+	NormalizationPolicy string `json:"normalization_policy,omitempty"` // identifier of the policy used to calculate the normalized IDs below
+
 	NumID     int64  `json:"num_id,omitempty"`      // NID of the fingerprint
 	NormNumID int64  `json:"norm_num_id,omitempty"` // Normalized NID of the fingerprint
 	HexID     string `json:"hex_id,omitempty"`      // ID of the fingerprint (hex string)
 	NormHexID string `json:"norm_hex_id,omitempty"` // Normalized ID of the fingerprint (hex string)
 
+	JA3     string `json:"ja3,omitempty"`      // JA3 fingerprint string
+	JA3Hash string `json:"ja3_hash,omitempty"` // MD5 hash of the JA3 fingerprint string (hex string)
+
+	JA4  string `json:"ja4,omitempty"`   // JA4 fingerprint
+	JA4R string `json:"ja4_r,omitempty"` // JA4_r fingerprint, i.e., JA4 with raw (unhashed) lists
+	JA4O string `json:"ja4_o,omitempty"` // JA4_o fingerprint, i.e., JA4 with lists in original order
+
+	Fingerprints FingerprintSet `json:"fingerprints,omitempty"` // fingerprint IDs calculated by all registered algorithms
+
 	// below are ONLY used for calculating the fingerprint (hash)
+	scheme                          FingerprintScheme
+	normPolicy                      NormalizationPolicy
+	echKeys                         []*ECHKey
+	sessionIDLength                 uint8
 	lengthPrefixedSupportedGroups   []uint16
 	lengthPrefixedEcPointFormats    []uint8
 	lengthPrefixedSignatureAlgos    []uint16
 	alpnWithLengths                 []uint8
 	lengthPrefixedCertCompressAlgos []uint8
 	keyshareGroupsWithLengths       []uint16
+	greaseValues                    []GREASEValue // as sent, before being replaced with tls.GREASE_PLACEHOLDER
 
 	// QUIC-only, nil if not QUIC
 	qtp *QUICTransportParameters
 }
 
+// DEFAULT_CLIENTHELLO_MAX_SIZE is the default maximum size of a ClientHello
+// handshake message (excluding the 4-byte handshake header) to be reassembled
+// from TLS records, same as the limit of crypto/tls.
+const DEFAULT_CLIENTHELLO_MAX_SIZE = 65536
+
 // ReadClientHello reads a ClientHello from a connection (io.Reader)
 // and returns a ClientHello struct.
 //
@@ -66,26 +116,78 @@ type ClientHello struct {
 // will be stored in the ClientHello struct to be rewinded by the caller
 // if ever needed.
 //
+// A ClientHello fragmented into multiple consecutive TLS handshake records
+// is reassembled, up to [DEFAULT_CLIENTHELLO_MAX_SIZE] bytes. See
+// [ReadClientHelloWithMaxSize] to use a different limit.
+//
+// An SSLv2-compatible ClientHello is also accepted and marked with SSLv2.
+//
 // This function does not automatically call [ClientHello.ParseClientHello].
 func ReadClientHello(r io.Reader) (ch *ClientHello, err error) {
-	ch = new(ClientHello)
-	// Read a TLS record
-	// Read exactly 5 bytes from the reader
-	ch.raw = make([]byte, 5)
-	if _, err = io.ReadFull(r, ch.raw); err != nil {
-		return
+	return ReadClientHelloWithMaxSize(r, DEFAULT_CLIENTHELLO_MAX_SIZE)
+}
+
+// ReadClientHelloWithMaxSize works like [ReadClientHello] but reassembles
+// a ClientHello handshake message of at most maxSize bytes (excluding the
+// 4-byte handshake header). A non-positive maxSize means
+// [DEFAULT_CLIENTHELLO_MAX_SIZE].
+func ReadClientHelloWithMaxSize(r io.Reader, maxSize int) (ch *ClientHello, err error) {
+	if maxSize <= 0 {
+		maxSize = DEFAULT_CLIENTHELLO_MAX_SIZE
 	}
 
-	// Check if the first byte is 0x16 (TLS Handshake)
-	if ch.raw[0] != 0x16 {
-		err = errors.New("not a TLS handshake record")
-		return
+	ch = new(ClientHello)
+	var handshake []byte
+	msgLen := -1 // unknown until the handshake header is read
+	for msgLen < 0 || len(handshake) < 4+msgLen {
+		// Read a TLS record
+		// Read exactly 5 bytes from the reader
+		header := make([]byte, 5)
+		n, err := io.ReadFull(r, header)
+		ch.raw = append(ch.raw, header[:n]...)
+		if err != nil {
+			return ch, err
+		}
+
+		// SSLv2-compatible ClientHello is never fragmented
+		if len(ch.TLSRecordLengths) == 0 && isSSLv2ClientHelloHeader(header) {
+			return ch, ch.readSSLv2ClientHello(r, maxSize)
+		}
+
+		// Check if the first byte is 0x16 (TLS Handshake)
+		if header[0] != 0x16 {
+			return ch, errors.New("not a TLS handshake record")
+		}
+
+		recordLen := int(binary.BigEndian.Uint16(header[3:5]))
+		if recordLen == 0 {
+			return ch, errors.New("empty TLS handshake record")
+		}
+		if len(handshake)+recordLen > 4+maxSize {
+			return ch, fmt.Errorf("ClientHello exceeds the maximum size of %d bytes", maxSize)
+		}
+
+		// Read exactly length bytes from the reader
+		ch.raw = append(ch.raw, make([]byte, recordLen)...)
+		n, err = io.ReadFull(r, ch.raw[len(ch.raw)-recordLen:])
+		ch.raw = ch.raw[:len(ch.raw)-recordLen+n]
+		if err != nil {
+			return ch, err
+		}
+		handshake = append(handshake, ch.raw[len(ch.raw)-recordLen:]...)
+		ch.TLSRecordLengths = append(ch.TLSRecordLengths, recordLen)
+
+		if msgLen < 0 && len(handshake) >= 4 {
+			msgLen = int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+			if msgLen > maxSize {
+				return ch, fmt.Errorf("ClientHello exceeds the maximum size of %d bytes", maxSize)
+			}
+		}
 	}
 
-	// Read exactly length bytes from the reader
-	ch.raw = append(ch.raw, make([]byte, binary.BigEndian.Uint16(ch.raw[3:5]))...)
-	_, err = io.ReadFull(r, ch.raw[5:])
-	return
+	ch.TLSRecordCount = len(ch.TLSRecordLengths)
+	ch.handshake = handshake[:4+msgLen] // anything after the ClientHello is ignored
+	return ch, nil
 }
 
 // UnmarshalClientHello unmarshals a ClientHello from a byte slice
@@ -108,159 +210,159 @@ func (ch *ClientHello) Raw() []byte {
 	return ch.raw
 }
 
-// ParseClientHello parses the raw bytes of a ClientHello into a ClientHello struct.
-func (ch *ClientHello) ParseClientHello() error {
-	// Call uTLS to parse the raw bytes into ClientHelloSpec
-	fingerprinter := tls.Fingerprinter{
-		AllowBluntMimicry: true, // we will need all the extensions even when not recognized
-	}
-	chs, err := fingerprinter.RawClientHello(ch.raw)
-	if err != nil {
-		return fmt.Errorf("failed to parse ClientHello, (*tls.Fingerprinter).RawClientHello(): %w", err)
-	}
+// SetFingerprintScheme sets the scheme used to calculate the native fingerprint
+// IDs of this ClientHello. It must be called before [ClientHello.ParseClientHello]
+// to take effect. If never called, the legacy scheme (zero value) is used.
+func (ch *ClientHello) SetFingerprintScheme(scheme FingerprintScheme) {
+	ch.scheme = scheme
+}
 
-	// ch.TLSRecordVersion = chs.TLSVersMin    // won't work for TLS 1.3
-	// ch.TLSHandshakeVersion = chs.TLSVersMax // won't work for TLS 1.3
-	ch.CipherSuites = chs.CipherSuites
-	ch.CompressionMethods = chs.CompressionMethods
+// SetNormalizationPolicy sets the policy used to normalize this ClientHello
+// before calculating the normalized fingerprint IDs. It must be called before
+// [ClientHello.ParseClientHello] to take effect. If never called, the legacy
+// policy (zero value) is used.
+func (ch *ClientHello) SetNormalizationPolicy(policy NormalizationPolicy) {
+	ch.normPolicy = policy
+}
 
-	// parse extensions
-	ch.parseExtensions(chs)
+// SetECHKeys sets the ECHKeys used to decrypt the encrypted_client_hello
+// extension into InnerClientHello. It must be called before
+// [ClientHello.ParseClientHello] to take effect.
+func (ch *ClientHello) SetECHKeys(keys []*ECHKey) {
+	ch.echKeys = keys
+}
 
-	// Call uTLS to parse the raw bytes into ClientHelloMsg
-	chm := tls.UnmarshalClientHello(ch.raw[5:])
-	if chm == nil {
-		return errors.New("failed to parse ClientHello, (*tls.ClientHelloInfo).Unmarshal(): nil")
-	}
-	ch.ServerName = chm.ServerName
+// FingerprintIDWithScheme calculates the native fingerprint IDs (hex string) of
+// an already parsed ClientHello with the given scheme, without altering the IDs
+// stored in the ClientHello. The normalized ID is calculated with the
+// NormalizationPolicy set before parsing.
+//
+// It can be used to reproduce IDs calculated with a different scheme.
+func (ch *ClientHello) FingerprintIDWithScheme(scheme FingerprintScheme) (hexID, normHexID string) {
+	_, hexID = ch.calcNumericID(scheme, false)
+	_, normHexID = ch.normalized(ch.normPolicy).calcNumericID(scheme, true)
+	return
+}
+
+// NormFingerprintIDWithPolicy calculates the normalized fingerprint ID (hex string)
+// of an already parsed ClientHello with the given scheme and normalization policy,
+// without altering the IDs stored in the ClientHello.
+func (ch *ClientHello) NormFingerprintIDWithPolicy(scheme FingerprintScheme, policy NormalizationPolicy) string {
+	_, normHexID := ch.normalized(policy).calcNumericID(scheme, true)
+	return normHexID
+}
 
+// ParseClientHello parses the raw bytes of a ClientHello into a ClientHello struct.
+//
+// The raw bytes are walked only once. Extensions which are malformed in ways
+// not preventing the ClientHello from being framed (e.g., an empty list where
+// at least one element is required) are accepted as-is.
+func (ch *ClientHello) ParseClientHello() error {
 	runtime.SetFinalizer(ch, func(c *ClientHello) {
 		c.qtp = nil // other trivial types are easy to GC
+		c.InnerClientHello = nil
 	})
 
-	// In the end parse extra information from raw
-	return ch.parseExtra()
+	if err := ch.parse(); err != nil {
+		return err
+	}
+
+	// Decrypt the inner ClientHello if any ECH key is set
+	return ch.decryptECH()
 }
 
-func (ch *ClientHello) parseExtensions(chs *tls.ClientHelloSpec) { // skipcq: GO-R1005
-	for _, ext := range chs.Extensions {
-		switch ext := ext.(type) {
-		case *tls.SupportedCurvesExtension:
-			for _, curve := range ext.Curves {
-				ch.NamedGroupList = append(ch.NamedGroupList, uint16(curve))
-			}
-			ch.lengthPrefixedSupportedGroups = append(ch.lengthPrefixedSupportedGroups, 2*uint16(len(ch.NamedGroupList)))
-			ch.lengthPrefixedSupportedGroups = append(ch.lengthPrefixedSupportedGroups, ch.NamedGroupList...)
-		case *tls.SupportedPointsExtension:
-			ch.ECPointFormatList = ext.SupportedPoints
-			ch.lengthPrefixedEcPointFormats = append(ch.lengthPrefixedEcPointFormats, uint8(len(ext.SupportedPoints)))
-			ch.lengthPrefixedEcPointFormats = append(ch.lengthPrefixedEcPointFormats, ext.SupportedPoints...)
-		case *tls.SignatureAlgorithmsExtension:
-			for _, sig := range ext.SupportedSignatureAlgorithms {
-				ch.SignatureSchemeList = append(ch.SignatureSchemeList, uint16(sig))
-			}
-			ch.lengthPrefixedSignatureAlgos = append(ch.lengthPrefixedSignatureAlgos, 2*uint16(len(ch.SignatureSchemeList)))
-			ch.lengthPrefixedSignatureAlgos = append(ch.lengthPrefixedSignatureAlgos, ch.SignatureSchemeList...)
-		case *tls.ALPNExtension:
-			ch.ALPN = ext.AlpnProtocols
-			// we will get alpnWithLengths from raw
-		case *tls.UtlsCompressCertExtension:
-			for _, algo := range ext.Algorithms {
-				ch.CertCompressAlgo = append(ch.CertCompressAlgo, uint16(algo))
-			}
-			ch.lengthPrefixedCertCompressAlgos = append(ch.lengthPrefixedCertCompressAlgos, 2*uint8(len(ch.CertCompressAlgo)))
-			ch.lengthPrefixedCertCompressAlgos = append(
-				ch.lengthPrefixedCertCompressAlgos,
-				utils.Uint16ToUint8(ch.CertCompressAlgo)...,
-			)
-		case *tls.FakeRecordSizeLimitExtension:
-			ch.RecordSizeLimit = append(ch.RecordSizeLimit, uint8(ext.Limit>>8), uint8(ext.Limit))
-		case *tls.SupportedVersionsExtension:
-			for _, ver := range ext.Versions {
-				ch.SupportedVersions = append(ch.SupportedVersions, uint16(ver))
-			}
-		case *tls.PSKKeyExchangeModesExtension:
-			ch.PSKKeyExchangeModes = ext.Modes
-		case *tls.KeyShareExtension:
-			for _, ks := range ext.KeyShares {
-				ch.KeyShare = append(ch.KeyShare, uint16(ks.Group))
-				// get below from raw instead
-				// ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, uint16(ks.Group))
-				// ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, uint16(len(ks.Data)))
-			}
-		case *tls.ApplicationSettingsExtension:
-			ch.ApplicationSettings = ext.SupportedProtocols
-		case *tls.GenericExtension:
-			if ext.Id == dicttls.ExtType_quic_transport_parameters {
-				ch.qtp = ParseQUICTransportParameters(ext.Data)
-			}
-		}
+// parse parses the fingerprintable fields from raw bytes and calculates
+// the fingerprints.
+func (ch *ClientHello) parse() error {
+	if ch.SSLv2 {
+		return ch.parseSSLv2()
 	}
-}
 
-// parseExtra parses extra information from raw bytes which couldn't be parsed by uTLS.
-func (ch *ClientHello) parseExtra() error {
-	// parse alpnWithLengths and Extensions
 	s := cryptobyte.String(ch.raw)
+	var contentType uint8
 	var recordVersion uint16
-	if !s.Skip(1) || !s.ReadUint16(&recordVersion) || !s.Skip(2) { // skip TLS record header
+	if !s.ReadUint8(&contentType) || !s.ReadUint16(&recordVersion) || !s.Skip(2) { // TLS record header
 		return errors.New("failed to parse TLS header, cryptobyte.String().Skip(): false")
 	}
+	if contentType != 0x16 {
+		return errors.New("not a TLS handshake record")
+	}
 	ch.TLSRecordVersion = recordVersion
+
+	s = cryptobyte.String(ch.handshake)
+	var handshakeType uint8
 	var handshakeVersion uint16
-	if !s.Skip(1) || // skip Handshake type
+	if !s.ReadUint8(&handshakeType) || // Handshake type
 		!s.Skip(3) || // skip Handshake length
 		!s.ReadUint16(&handshakeVersion) || // parse ClientHello version
 		!s.Skip(32) { // skip ClientHello random
 		return errors.New("failed to parse ClientHello, cryptobyte.String().Skip(): false")
 	}
+	if handshakeType != 0x01 {
+		return errors.New("handshake message is not a ClientHello")
+	}
 	ch.TLSHandshakeVersion = handshakeVersion
 
-	var ignoredSessionID cryptobyte.String
-	if !s.ReadUint8LengthPrefixed(&ignoredSessionID) {
+	var sessionID cryptobyte.String
+	if !s.ReadUint8LengthPrefixed(&sessionID) {
 		return errors.New("unable to read session id")
 	}
+	ch.sessionIDLength = uint8(len(sessionID))
 
-	var ignoredCipherSuites cryptobyte.String
-	if !s.ReadUint16LengthPrefixed(&ignoredCipherSuites) {
+	var cipherSuites cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&cipherSuites) {
 		return errors.New("unable to read ciphersuites")
 	}
+	ch.CipherSuites = make([]uint16, 0, len(cipherSuites)/2)
+	for !cipherSuites.Empty() {
+		var cipherSuite uint16
+		if !cipherSuites.ReadUint16(&cipherSuite) {
+			return errors.New("unable to read ciphersuite")
+		}
+		ch.CipherSuites = append(ch.CipherSuites, ch.unGREASE(GREASE_LOCATION_CIPHER_SUITE, len(ch.CipherSuites), cipherSuite))
+	}
 
-	var ignoredCompressionMethods cryptobyte.String
-	if !s.ReadUint8LengthPrefixed(&ignoredCompressionMethods) {
+	var compressionMethods cryptobyte.String
+	if !s.ReadUint8LengthPrefixed(&compressionMethods) {
 		return errors.New("unable to read compression methods")
 	}
+	ch.CompressionMethods = utils.Uint8Arr(compressionMethods)
 
-	if s.Empty() {
-		return nil // no extensions
-	}
+	if !s.Empty() { // extensions are optional
+		var extensions cryptobyte.String
+		if !s.ReadUint16LengthPrefixed(&extensions) {
+			return errors.New("unable to read extensions data")
+		}
 
-	var extensions cryptobyte.String
-	if !s.ReadUint16LengthPrefixed(&extensions) {
-		return errors.New("unable to read extensions data")
+		err := ch.parseExtensions(extensions)
+		if err != nil {
+			return fmt.Errorf("failed to parse extensions, parseExtensions(): %w", err)
+		}
 	}
 
-	err := ch.parseExtensionsExtra(extensions)
-	if err != nil {
-		return fmt.Errorf("failed to parse extensions, parseExtensionsExtra(): %w", err)
-	}
+	// normalize ch.Extensions and put result to ch.ExtensionsNormalized
+	ch.ExtensionsNormalized = ch.normPolicy.normalizeExtensions(ch.Extensions)
 
-	// sort ch.Extensions and put result to ch.ExtensionsNormalized
-	ch.ExtensionsNormalized = make([]uint16, len(ch.Extensions))
-	copy(ch.ExtensionsNormalized, ch.Extensions)
-	sort.Slice(ch.ExtensionsNormalized, func(i, j int) bool {
-		return ch.ExtensionsNormalized[i] < ch.ExtensionsNormalized[j]
-	})
+	ch.KeyShareAnalysis = ch.analyzeKeyShare()
+	ch.GREASE = ch.analyzeGREASE()
 
-	// calculate fingerprint
-	ch.NumID, ch.NormNumID = ch.calcNumericID()
-	ch.HexID = FingerprintID(ch.NumID).AsHex()
-	ch.NormHexID = FingerprintID(ch.NormNumID).AsHex()
+	ch.calcFingerprints()
 
 	return nil
 }
 
-func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String) error {
+// calcFingerprints calculates all fingerprints of the parsed ClientHello.
+func (ch *ClientHello) calcFingerprints() {
+	ch.FingerprintScheme = ch.scheme.String()
+	ch.NormalizationPolicy = ch.normPolicy.String()
+	ch.NumID, ch.HexID = ch.calcNumericID(ch.scheme, false)
+	ch.NormNumID, ch.NormHexID = ch.normalized(ch.normPolicy).calcNumericID(ch.scheme, true)
+	ch.JA3, ch.JA3Hash = ch.calcJA3()
+	ch.JA4, ch.JA4R, ch.JA4O = ch.calcJA4(ja4ProtocolTCP)
+	ch.Fingerprints = ch.calcFingerprintSet()
+}
+
+func (ch *ClientHello) parseExtensions(extensions cryptobyte.String) error {
 	var extensionIDs []uint16
 	for !extensions.Empty() {
 		var extensionID uint16
@@ -272,22 +374,131 @@ func (ch *ClientHello) parseExtensionsExtra(extensions cryptobyte.String) error
 			return errors.New("unable to read extension data")
 		}
 
-		extensionID, err := ch.parseExtensionExtra(extensionID, extensionData)
+		ch.recordGREASE(GREASE_LOCATION_EXTENSION, len(extensionIDs), extensionID)
+		extensionID, err := ch.parseExtension(extensionID, extensionData)
 		if err != nil {
-			return fmt.Errorf("failed to parse extension, parseExtensionExtra(): %w", err)
+			return fmt.Errorf("failed to parse extension, parseExtension(): %w", err)
 		}
-		extensionIDs = append(extensionIDs, extensionID) // extension ID might need to be overridden by parseExtensionExtra() in case of GREASE
+		extensionIDs = append(extensionIDs, extensionID) // extension ID might need to be overridden by parseExtension() in case of GREASE
 	}
 	ch.Extensions = extensionIDs
 
 	return nil
 }
 
-func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cryptobyte.String) (uint16, error) {
+func (ch *ClientHello) parseExtension(extensionID uint16, extensionData cryptobyte.String) (uint16, error) { // skipcq: GO-R1005
+	if err := ch.parseExtensionPayload(extensionID, extensionData); err != nil {
+		// still fingerprinted, with the decoded extension left unset
+		ch.MalformedExtensions = append(ch.MalformedExtensions, extensionID)
+	}
+
 	switch extensionID {
-	case 16: // ALPN
+	case dicttls.ExtType_server_name:
+		var serverNameList cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&serverNameList) {
+			return 0, errors.New("unable to read server_name list")
+		}
+		for !serverNameList.Empty() {
+			var nameType uint8
+			var serverName cryptobyte.String
+			if !serverNameList.ReadUint8(&nameType) || !serverNameList.ReadUint16LengthPrefixed(&serverName) {
+				return 0, errors.New("unable to read server_name")
+			}
+			if nameType == 0 && ch.ServerName == "" { // host_name
+				ch.ServerName = string(serverName)
+			}
+		}
+	case dicttls.ExtType_supported_groups:
+		var groups cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&groups) {
+			return 0, errors.New("unable to read supported_groups")
+		}
+		for !groups.Empty() {
+			var group uint16
+			if !groups.ReadUint16(&group) {
+				return 0, errors.New("unable to read supported group")
+			}
+			ch.NamedGroupList = append(ch.NamedGroupList, ch.unGREASE(GREASE_LOCATION_SUPPORTED_GROUP, len(ch.NamedGroupList), group))
+		}
+		ch.lengthPrefixedSupportedGroups = append(ch.lengthPrefixedSupportedGroups, 2*uint16(len(ch.NamedGroupList)))
+		ch.lengthPrefixedSupportedGroups = append(ch.lengthPrefixedSupportedGroups, ch.NamedGroupList...)
+	case dicttls.ExtType_ec_point_formats:
+		var pointFormats cryptobyte.String
+		if !extensionData.ReadUint8LengthPrefixed(&pointFormats) {
+			return 0, errors.New("unable to read ec_point_formats")
+		}
+		ch.ECPointFormatList = utils.Uint8Arr(pointFormats)
+		ch.lengthPrefixedEcPointFormats = append(ch.lengthPrefixedEcPointFormats, uint8(len(pointFormats)))
+		ch.lengthPrefixedEcPointFormats = append(ch.lengthPrefixedEcPointFormats, pointFormats...)
+	case dicttls.ExtType_signature_algorithms:
+		var sigAlgs cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&sigAlgs) {
+			return 0, errors.New("unable to read signature_algorithms")
+		}
+		for !sigAlgs.Empty() {
+			var sigAlg uint16
+			if !sigAlgs.ReadUint16(&sigAlg) {
+				return 0, errors.New("unable to read signature algorithm")
+			}
+			ch.recordGREASE(GREASE_LOCATION_SIGNATURE_ALGORITHM, len(ch.SignatureSchemeList), sigAlg)
+			ch.SignatureSchemeList = append(ch.SignatureSchemeList, sigAlg) // GREASE kept as-is
+		}
+		ch.lengthPrefixedSignatureAlgos = append(ch.lengthPrefixedSignatureAlgos, 2*uint16(len(ch.SignatureSchemeList)))
+		ch.lengthPrefixedSignatureAlgos = append(ch.lengthPrefixedSignatureAlgos, ch.SignatureSchemeList...)
+	case dicttls.ExtType_application_layer_protocol_negotiation:
 		ch.alpnWithLengths = extensionData
-	case 51: // keyshare
+		protocols, err := readProtocolNameList(extensionData)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read alpn: %w", err)
+		}
+		ch.ALPN = protocols
+	case dicttls.ExtType_compress_certificate:
+		var algos cryptobyte.String
+		if !extensionData.ReadUint8LengthPrefixed(&algos) {
+			return 0, errors.New("unable to read compress_certificate")
+		}
+		for !algos.Empty() {
+			var algo uint16
+			if !algos.ReadUint16(&algo) {
+				return 0, errors.New("unable to read certificate compression algorithm")
+			}
+			ch.CertCompressAlgo = append(ch.CertCompressAlgo, algo)
+		}
+		ch.lengthPrefixedCertCompressAlgos = append(ch.lengthPrefixedCertCompressAlgos, 2*uint8(len(ch.CertCompressAlgo)))
+		ch.lengthPrefixedCertCompressAlgos = append(
+			ch.lengthPrefixedCertCompressAlgos,
+			utils.Uint16ToUint8(ch.CertCompressAlgo)...,
+		)
+	case dicttls.ExtType_record_size_limit:
+		var limit []byte
+		if !extensionData.ReadBytes(&limit, 2) {
+			return 0, errors.New("unable to read record_size_limit")
+		}
+		ch.RecordSizeLimit = append(ch.RecordSizeLimit, limit...)
+	case dicttls.ExtType_supported_versions:
+		var versions cryptobyte.String
+		if !extensionData.ReadUint8LengthPrefixed(&versions) {
+			return 0, errors.New("unable to read supported_versions")
+		}
+		for !versions.Empty() {
+			var version uint16
+			if !versions.ReadUint16(&version) {
+				return 0, errors.New("unable to read supported version")
+			}
+			ch.SupportedVersions = append(ch.SupportedVersions, ch.unGREASE(GREASE_LOCATION_SUPPORTED_VERSION, len(ch.SupportedVersions), version))
+		}
+	case dicttls.ExtType_psk_key_exchange_modes:
+		var modes cryptobyte.String
+		if !extensionData.ReadUint8LengthPrefixed(&modes) {
+			return 0, errors.New("unable to read psk_key_exchange_modes")
+		}
+		ch.PSKKeyExchangeModes = utils.Uint8Arr(modes)
+		for i, mode := range modes {
+			if isGREASEPSKKeyExchangeMode(mode) {
+				ch.greaseValues = append(ch.greaseValues, GREASEValue{GREASE_LOCATION_PSK_KEY_EXCHANGE_MODE, i, uint64(mode)})
+			}
+		}
+	case dicttls.ExtType_key_share:
 		if !extensionData.Skip(2) {
 			return 0, errors.New("unable to skip keyshare total length")
 		}
@@ -297,15 +508,23 @@ func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cry
 			if !extensionData.ReadUint16(&group) || !extensionData.ReadUint16(&length) {
 				return 0, errors.New("unable to read keyshare group")
 			}
-			if utils.IsGREASEUint16(group) {
-				group = tls.GREASE_PLACEHOLDER
-			}
+			group = ch.unGREASE(GREASE_LOCATION_KEY_SHARE, len(ch.KeyShare), group)
+			ch.KeyShare = append(ch.KeyShare, group)
 			ch.keyshareGroupsWithLengths = append(ch.keyshareGroupsWithLengths, group, length)
 
 			if !extensionData.Skip(int(length)) {
 				return 0, errors.New("unable to skip keyshare data")
 			}
 		}
+	case dicttls.ExtType_application_settings:
+		protocols, err := readProtocolNameList(extensionData)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read application_settings: %w", err)
+		}
+		ch.ApplicationSettings = protocols
+	case dicttls.ExtType_quic_transport_parameters:
+		ch.qtp = ParseQUICTransportParameters(extensionData)
+		ch.greaseValues = append(ch.greaseValues, greaseTransportParameters(extensionData)...)
 	default:
 		if utils.IsGREASEUint16(extensionID) {
 			return tls.GREASE_PLACEHOLDER, nil
@@ -314,3 +533,46 @@ func (ch *ClientHello) parseExtensionExtra(extensionID uint16, extensionData cry
 
 	return extensionID, nil
 }
+
+// readProtocolNameList reads a ProtocolNameList as used by ALPN and ALPS.
+func readProtocolNameList(extensionData cryptobyte.String) ([]string, error) {
+	var protocolNameList cryptobyte.String
+	if !extensionData.ReadUint16LengthPrefixed(&protocolNameList) {
+		return nil, errors.New("unable to read protocol name list")
+	}
+	protocols := []string{}
+	for !protocolNameList.Empty() {
+		var protocol cryptobyte.String
+		if !protocolNameList.ReadUint8LengthPrefixed(&protocol) {
+			return nil, errors.New("unable to read protocol name")
+		}
+		protocols = append(protocols, string(protocol))
+	}
+	return protocols, nil
+}
+
+// unGREASE records a GREASE value found at the position in the list at the
+// location, and replaces it with the GREASE placeholder.
+func (ch *ClientHello) unGREASE(location string, position int, v uint16) uint16 {
+	if ch.recordGREASE(location, position, v) {
+		return tls.GREASE_PLACEHOLDER
+	}
+	return v
+}
+
+// recordGREASE records v if it is a GREASE value and tells if it is.
+func (ch *ClientHello) recordGREASE(location string, position int, v uint16) bool {
+	if !utils.IsGREASEUint16(v) {
+		return false
+	}
+	ch.greaseValues = append(ch.greaseValues, GREASEValue{location, position, uint64(v)})
+	return true
+}
+
+// unGREASEUint16 replaces any GREASE value with the GREASE placeholder.
+func unGREASEUint16(v uint16) uint16 {
+	if utils.IsGREASEUint16(v) {
+		return tls.GREASE_PLACEHOLDER
+	}
+	return v
+}
@@ -0,0 +1,101 @@
+package clienthellod
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	EXTENSION_ENCRYPTED_CLIENT_HELLO uint16 = 0xfe0d // encrypted_client_hello(65037)
+
+	ECH_CLIENT_HELLO_TYPE_OUTER uint8 = 0
+	ECH_CLIENT_HELLO_TYPE_INNER uint8 = 1
+
+	echAEADTagLength = 16 // all AEADs registered for HPKE have a 16-byte tag
+)
+
+// boringSSLGREASEECHPayloadLengths are the payload lengths of GREASE ECH sent by
+// BoringSSL (Chrome), which picks a payload of 128 + 32*[0, 3] bytes plus the
+// AEAD tag. A real ECH padded as recommended may have any of them too.
+var boringSSLGREASEECHPayloadLengths = map[int]bool{
+	144: true,
+	176: true,
+	208: true,
+	240: true,
+}
+
+// EncryptedClientHelloExtension is the decoded encrypted_client_hello(65037)
+// extension.
+type EncryptedClientHelloExtension struct {
+	Type uint8 `json:"type"` // 0 for outer, 1 for inner
+
+	// below are only present in outer ClientHello
+	KDFID         uint16 `json:"kdf_id,omitempty"`
+	AEADID        uint16 `json:"aead_id,omitempty"`
+	ConfigID      uint8  `json:"config_id,omitempty"`
+	EncLength     int    `json:"enc_length,omitempty"`
+	PayloadLength int    `json:"payload_length,omitempty"`
+
+	// LikelyGREASE is a heuristic telling if the extension looks like GREASE ECH
+	// instead of a real ECH encrypted with a server's ECH config: the payload,
+	// without the AEAD tag, is not padded to a multiple of 32 bytes as
+	// recommended for a real ClientHelloInner. It may misclassify a real ECH
+	// sent by a client not padding it.
+	//
+	// If ECH keys are set, LikelyGREASE is instead true if and only if the
+	// extension could not be decrypted with any of them.
+	LikelyGREASE bool `json:"likely_grease"`
+
+	// GREASEUndetermined is set, with LikelyGREASE left false, if no ECH key
+	// is set and the payload length is one picked by BoringSSL for GREASE ECH,
+	// which a real ECH padded as recommended may have as well. Only decrypting
+	// it can tell the two apart.
+	GREASEUndetermined bool `json:"grease_undetermined,omitempty"`
+
+	Decrypted  bool   `json:"decrypted,omitempty"`   // decrypted with an ECH key
+	InnerError string `json:"inner_error,omitempty"` // why the ClientHelloInner decrypted could not be parsed into InnerClientHello
+
+	enc     []byte
+	payload []byte
+}
+
+// parseEncryptedClientHello decodes the encrypted_client_hello extension.
+func parseEncryptedClientHello(extensionData cryptobyte.String) (*EncryptedClientHelloExtension, error) {
+	ech := &EncryptedClientHelloExtension{}
+	if !extensionData.ReadUint8(&ech.Type) {
+		return nil, errors.New("unable to read encrypted_client_hello type")
+	}
+
+	if ech.Type != ECH_CLIENT_HELLO_TYPE_OUTER {
+		if !extensionData.Empty() {
+			return nil, errors.New("trailing data after encrypted_client_hello type")
+		}
+		return ech, nil // inner ECH is empty
+	}
+
+	var enc, payload cryptobyte.String
+	if !extensionData.ReadUint16(&ech.KDFID) ||
+		!extensionData.ReadUint16(&ech.AEADID) ||
+		!extensionData.ReadUint8(&ech.ConfigID) ||
+		!extensionData.ReadUint16LengthPrefixed(&enc) ||
+		!extensionData.ReadUint16LengthPrefixed(&payload) {
+		return nil, errors.New("unable to read encrypted_client_hello outer")
+	}
+	if !extensionData.Empty() {
+		return nil, errors.New("trailing data after encrypted_client_hello payload")
+	}
+	ech.enc = enc
+	ech.payload = payload
+	ech.EncLength = len(enc)
+	ech.PayloadLength = len(payload)
+
+	switch {
+	case ech.PayloadLength <= echAEADTagLength || (ech.PayloadLength-echAEADTagLength)%32 != 0:
+		ech.LikelyGREASE = true
+	case boringSSLGREASEECHPayloadLengths[ech.PayloadLength]:
+		ech.GREASEUndetermined = true
+	}
+
+	return ech, nil
+}
@@ -0,0 +1,413 @@
+package clienthellod
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	EXTENSION_ECH_OUTER_EXTENSIONS uint16 = 0xfd00 // ech_outer_extensions(64768)
+
+	ECH_CONFIG_VERSION uint16 = 0xfe0d // ECHConfig version of draft-ietf-tls-esni-18 and later
+)
+
+var echHPKEInfoPrefix = []byte("tls ech\x00")
+
+type echCipherSuite struct {
+	kdfID  uint16
+	aeadID uint16
+}
+
+// ECHKey is the private key of a published ECHConfig. It is used to decrypt
+// the encrypted_client_hello extension of ClientHellos sent to the server
+// holding the key.
+type ECHKey struct {
+	config       []byte // serialized ECHConfig, used in the HPKE info
+	configID     uint8
+	kemID        uint16
+	cipherSuites []echCipherSuite
+	privateKey   kem.PrivateKey
+}
+
+// NewECHKey creates an ECHKey from a serialized ECHConfig (starting from the
+// version field) and the serialized private key of the KEM specified in the
+// ECHConfig, as defined by SerializePrivateKey in RFC 9180.
+func NewECHKey(config, privateKey []byte) (*ECHKey, error) {
+	s := cryptobyte.String(config)
+	var version uint16
+	var contents cryptobyte.String
+	if !s.ReadUint16(&version) || !s.ReadUint16LengthPrefixed(&contents) || !s.Empty() {
+		return nil, errors.New("unable to read ECHConfig")
+	}
+	if version != ECH_CONFIG_VERSION {
+		return nil, fmt.Errorf("unsupported ECHConfig version 0x%04x", version)
+	}
+
+	key := &ECHKey{config: bytes.Clone(config)}
+	var publicKey, cipherSuites cryptobyte.String
+	if !contents.ReadUint8(&key.configID) ||
+		!contents.ReadUint16(&key.kemID) ||
+		!contents.ReadUint16LengthPrefixed(&publicKey) ||
+		!contents.ReadUint16LengthPrefixed(&cipherSuites) {
+		return nil, errors.New("unable to read ECHConfig key config")
+	}
+	for !cipherSuites.Empty() {
+		var suite echCipherSuite
+		if !cipherSuites.ReadUint16(&suite.kdfID) || !cipherSuites.ReadUint16(&suite.aeadID) {
+			return nil, errors.New("unable to read ECHConfig cipher suite")
+		}
+		key.cipherSuites = append(key.cipherSuites, suite)
+	}
+
+	kemID := hpke.KEM(key.kemID)
+	if !kemID.IsValid() {
+		return nil, fmt.Errorf("unsupported ECHConfig KEM 0x%04x", key.kemID)
+	}
+	var err error
+	key.privateKey, err = kemID.Scheme().UnmarshalBinaryPrivateKey(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal ECH private key: %w", err)
+	}
+
+	pub, err := key.privateKey.Public().MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal ECH public key: %w", err)
+	}
+	if !bytes.Equal(pub, publicKey) {
+		return nil, errors.New("ECH private key does not match the public key in ECHConfig")
+	}
+
+	return key, nil
+}
+
+// ConfigID returns the config_id of the ECHConfig the key belongs to.
+func (k *ECHKey) ConfigID() uint8 {
+	return k.configID
+}
+
+// LoadECHKeysFromPEM loads ECHKeys from a PEM file containing a PKCS#8
+// "PRIVATE KEY" and an "ECHCONFIG" holding an ECHConfigList, as used by
+// OpenSSL and other TLS servers supporting ECH. The private key is paired
+// with every ECHConfig in the list.
+func LoadECHKeysFromPEM(pemBytes []byte) ([]*ECHKey, error) {
+	var privateKey, configList []byte
+	for {
+		var block *pem.Block
+		block, pemBytes = pem.Decode(pemBytes)
+		if block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY":
+			sk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("unable to parse ECH private key: %w", err)
+			}
+			switch sk := sk.(type) {
+			case *ecdh.PrivateKey:
+				privateKey = sk.Bytes()
+			case *ecdsa.PrivateKey:
+				ecdhSk, err := sk.ECDH()
+				if err != nil {
+					return nil, fmt.Errorf("unsupported ECH private key: %w", err)
+				}
+				privateKey = ecdhSk.Bytes()
+			default:
+				return nil, fmt.Errorf("unsupported ECH private key type %T", sk)
+			}
+		case "ECHCONFIG":
+			configList = block.Bytes
+		}
+	}
+
+	if privateKey == nil || configList == nil {
+		return nil, errors.New("both PRIVATE KEY and ECHCONFIG are required")
+	}
+
+	s := cryptobyte.String(configList)
+	var configs cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&configs) || !s.Empty() {
+		return nil, errors.New("unable to read ECHConfigList")
+	}
+
+	var keys []*ECHKey
+	for !configs.Empty() {
+		var version uint16
+		var contents cryptobyte.String
+		config := configs
+		if !configs.ReadUint16(&version) || !configs.ReadUint16LengthPrefixed(&contents) {
+			return nil, errors.New("unable to read ECHConfig")
+		}
+		config = config[:len(config)-len(configs)]
+		if version != ECH_CONFIG_VERSION {
+			continue // skip unsupported versions as clients do
+		}
+
+		key, err := NewECHKey(config, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no supported ECHConfig found")
+	}
+	return keys, nil
+}
+
+// open decrypts the payload of an outer encrypted_client_hello into the
+// EncodedClientHelloInner. It fails if the extension is not encrypted with
+// this key.
+func (k *ECHKey) open(ech *EncryptedClientHelloExtension, aad []byte) ([]byte, error) {
+	if ech.ConfigID != k.configID {
+		return nil, errors.New("config_id mismatch")
+	}
+
+	var supported bool
+	for _, suite := range k.cipherSuites {
+		if suite.kdfID == ech.KDFID && suite.aeadID == ech.AEADID {
+			supported = true
+			break
+		}
+	}
+	if !supported || !hpke.KDF(ech.KDFID).IsValid() || !hpke.AEAD(ech.AEADID).IsValid() {
+		return nil, errors.New("unsupported cipher suite")
+	}
+
+	info := append(append([]byte{}, echHPKEInfoPrefix...), k.config...)
+	receiver, err := hpke.NewSuite(hpke.KEM(k.kemID), hpke.KDF(ech.KDFID), hpke.AEAD(ech.AEADID)).NewReceiver(k.privateKey, info)
+	if err != nil {
+		return nil, err
+	}
+	opener, err := receiver.Setup(ech.enc)
+	if err != nil {
+		return nil, err
+	}
+	return opener.Open(ech.payload, aad)
+}
+
+type echRawExtension struct {
+	id   uint16
+	data []byte
+}
+
+// decryptECH decrypts the encrypted_client_hello extension with the ECHKeys
+// set and parses the reconstructed inner ClientHello into InnerClientHello.
+//
+// If none of the keys could decrypt the extension, it is marked as
+// LikelyGREASE since it is not a real ECH targeting this server. If the
+// decrypted ClientHelloInner is malformed, the error is recorded in
+// InnerError instead of failing the ClientHelloOuter, since anyone holding
+// the public ECH config could craft one.
+func (ch *ClientHello) decryptECH() error {
+	ech := ch.EncryptedClientHello
+	if len(ch.echKeys) == 0 || ech == nil || ech.Type != ECH_CLIENT_HELLO_TYPE_OUTER {
+		return nil
+	}
+
+	aad, sessionID, outerExtensions, err := ch.splitOuterClientHello()
+	if err != nil {
+		ech.InnerError = fmt.Sprintf("failed to parse ClientHelloOuter: %v", err)
+		return nil
+	}
+
+	for _, key := range ch.echKeys {
+		encodedInner, err := key.open(ech, aad)
+		if err != nil {
+			continue // not encrypted with this key
+		}
+
+		ech.Decrypted = true
+		ech.LikelyGREASE, ech.GREASEUndetermined = false, false
+
+		inner, err := ch.reconstructInnerClientHello(encodedInner, sessionID, outerExtensions)
+		if err != nil {
+			ech.InnerError = fmt.Sprintf("failed to reconstruct ClientHelloInner: %v", err)
+			return nil
+		}
+		if err = inner.ParseClientHello(); err != nil {
+			ech.InnerError = fmt.Sprintf("failed to parse ClientHelloInner: %v", err)
+			return nil
+		}
+		ch.InnerClientHello = inner
+		return nil
+	}
+
+	ech.LikelyGREASE, ech.GREASEUndetermined = true, false
+	return nil
+}
+
+// splitOuterClientHello reads the ClientHelloOuter and returns the
+// ClientHelloOuterAAD (the ClientHello body with the ECH payload zeroed),
+// the legacy_session_id and the extensions which could be referenced by
+// ech_outer_extensions.
+func (ch *ClientHello) splitOuterClientHello() (aad, sessionID []byte, extensions []echRawExtension, err error) {
+	s := cryptobyte.String(ch.handshake)
+	var body cryptobyte.String
+	if !s.Skip(1) || // skip Handshake type
+		!s.ReadUint24LengthPrefixed(&body) {
+		return nil, nil, nil, errors.New("unable to read ClientHello")
+	}
+
+	var versionRandom []byte
+	var sid, cipherSuites, compressionMethods, exts cryptobyte.String
+	if !body.ReadBytes(&versionRandom, 2+32) ||
+		!body.ReadUint8LengthPrefixed(&sid) ||
+		!body.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!body.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!body.ReadUint16LengthPrefixed(&exts) {
+		return nil, nil, nil, errors.New("unable to read ClientHello fields")
+	}
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddBytes(versionRandom)
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sid) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(cipherSuites) })
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(compressionMethods) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for !exts.Empty() {
+			var id uint16
+			var data cryptobyte.String
+			if !exts.ReadUint16(&id) || !exts.ReadUint16LengthPrefixed(&data) {
+				b.SetError(errors.New("unable to read extension"))
+				return
+			}
+			extensions = append(extensions, echRawExtension{id: id, data: data})
+
+			if id == EXTENSION_ENCRYPTED_CLIENT_HELLO {
+				data = zeroECHPayload(data)
+			}
+			b.AddUint16(id)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(data) })
+		}
+	})
+
+	aad, err = b.Bytes()
+	return aad, sid, extensions, err
+}
+
+// zeroECHPayload returns a copy of the extension data of an outer
+// encrypted_client_hello with the payload zeroed, or the data as-is if it is
+// not a well-formed outer one, e.g., a duplicate of inner type.
+func zeroECHPayload(data []byte) []byte {
+	// type(1) || kdf_id(2) || aead_id(2) || config_id(1) || enc<2> || payload<2>
+	s := cryptobyte.String(data)
+	var echType uint8
+	var enc, payload cryptobyte.String
+	if !s.ReadUint8(&echType) || echType != ECH_CLIENT_HELLO_TYPE_OUTER ||
+		!s.Skip(2+2+1) ||
+		!s.ReadUint16LengthPrefixed(&enc) ||
+		!s.ReadUint16LengthPrefixed(&payload) {
+		return data
+	}
+
+	payloadOffset := len(data) - len(s) - len(payload)
+	zeroed := bytes.Clone(data)
+	clear(zeroed[payloadOffset : payloadOffset+len(payload)])
+	return zeroed
+}
+
+// reconstructInnerClientHello decodes the EncodedClientHelloInner into a
+// ClientHelloInner wrapped in a TLS record, restoring the legacy_session_id
+// and expanding ech_outer_extensions from the ClientHelloOuter.
+func (ch *ClientHello) reconstructInnerClientHello(encodedInner, outerSessionID []byte, outerExtensions []echRawExtension) (*ClientHello, error) {
+	s := cryptobyte.String(encodedInner)
+	var versionRandom []byte
+	var sid, cipherSuites, compressionMethods, exts cryptobyte.String
+	if !s.ReadBytes(&versionRandom, 2+32) ||
+		!s.ReadUint8LengthPrefixed(&sid) ||
+		!s.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!s.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!s.ReadUint16LengthPrefixed(&exts) {
+		return nil, errors.New("unable to read EncodedClientHelloInner")
+	}
+	if !sid.Empty() {
+		return nil, errors.New("legacy_session_id of EncodedClientHelloInner must be empty")
+	}
+	for _, padding := range s {
+		if padding != 0 {
+			return nil, errors.New("non-zero padding in EncodedClientHelloInner")
+		}
+	}
+
+	var extensions []echRawExtension
+	var outerIdx int
+	for !exts.Empty() {
+		var id uint16
+		var data cryptobyte.String
+		if !exts.ReadUint16(&id) || !exts.ReadUint16LengthPrefixed(&data) {
+			return nil, errors.New("unable to read inner extension")
+		}
+
+		if id != EXTENSION_ECH_OUTER_EXTENSIONS {
+			extensions = append(extensions, echRawExtension{id: id, data: data})
+			continue
+		}
+
+		var outerIDs cryptobyte.String
+		if !data.ReadUint8LengthPrefixed(&outerIDs) || !data.Empty() {
+			return nil, errors.New("unable to read ech_outer_extensions")
+		}
+		for !outerIDs.Empty() {
+			var outerID uint16
+			if !outerIDs.ReadUint16(&outerID) {
+				return nil, errors.New("unable to read ech_outer_extensions")
+			}
+			if outerID == EXTENSION_ENCRYPTED_CLIENT_HELLO {
+				return nil, errors.New("ech_outer_extensions must not reference encrypted_client_hello")
+			}
+
+			// referenced extensions must appear in the same order as in ClientHelloOuter
+			for outerIdx < len(outerExtensions) && outerExtensions[outerIdx].id != outerID {
+				outerIdx++
+			}
+			if outerIdx == len(outerExtensions) {
+				return nil, fmt.Errorf("ech_outer_extensions references missing extension %d", outerID)
+			}
+			extensions = append(extensions, outerExtensions[outerIdx])
+			outerIdx++
+		}
+	}
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(0x16)        // TLS Handshake
+	b.AddBytes(ch.raw[1:3]) // record version of ClientHelloOuter
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0x01) // ClientHello
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddBytes(versionRandom)
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(outerSessionID) })
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(cipherSuites) })
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(compressionMethods) })
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, ext := range extensions {
+					b.AddUint16(ext.id)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(ext.data) })
+				}
+			})
+		})
+	})
+	raw, err := b.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	inner, err := ReadClientHello(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	inner.SetFingerprintScheme(ch.scheme)
+	inner.SetNormalizationPolicy(ch.normPolicy)
+	return inner, nil
+}
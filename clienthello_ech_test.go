@@ -0,0 +1,348 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/cloudflare/circl/hpke"
+	. "github.com/gaukas/clienthellod"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/exp/slices"
+)
+
+func TestParseEncryptedClientHello(t *testing.T) {
+	t.Run("Firefox126", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testEncryptedClientHelloEqualsTruth(t, ch.EncryptedClientHello, &EncryptedClientHelloExtension{
+			Type:          ECH_CLIENT_HELLO_TYPE_OUTER,
+			KDFID:         0x0001, // HKDF-SHA256
+			AEADID:        0x0003, // ChaCha20Poly1305
+			ConfigID:      77,
+			EncLength:     32,
+			PayloadLength: 239,
+			LikelyGREASE:  true,
+		})
+	})
+
+	t.Run("QUIC_Chrome124", func(t *testing.T) {
+		qch, err := ParseQUICClientHello(quicClientHelloTruth_Chrome124)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testEncryptedClientHelloEqualsTruth(t, qch.EncryptedClientHello, &EncryptedClientHelloExtension{
+			Type:          ECH_CLIENT_HELLO_TYPE_OUTER,
+			KDFID:         0x0001, // HKDF-SHA256
+			AEADID:        0x0001, // AES-128-GCM
+			ConfigID:      7,
+			EncLength:     32,
+			PayloadLength: 176,
+
+			GREASEUndetermined: true, // a length picked by BoringSSL for GREASE ECH, or a real ECH padded alike
+		})
+	})
+}
+
+func testEncryptedClientHelloEqualsTruth(t *testing.T, ech, truth *EncryptedClientHelloExtension) {
+	if ech == nil {
+		t.Fatal("encrypted_client_hello is expected to be present")
+	}
+
+	if ech.Type != truth.Type ||
+		ech.KDFID != truth.KDFID ||
+		ech.AEADID != truth.AEADID ||
+		ech.ConfigID != truth.ConfigID ||
+		ech.EncLength != truth.EncLength ||
+		ech.PayloadLength != truth.PayloadLength ||
+		ech.LikelyGREASE != truth.LikelyGREASE ||
+		ech.GREASEUndetermined != truth.GREASEUndetermined {
+		t.Errorf("encrypted_client_hello mismatch, expecting %+v, got %+v", truth, ech)
+	}
+}
+
+const (
+	echTestConfigID = 42
+	echTestKEM      = hpke.KEM_X25519_HKDF_SHA256
+	echTestKDF      = hpke.KDF_HKDF_SHA256
+	echTestAEAD     = hpke.AEAD_AES128GCM
+)
+
+// echTestConfig generates an X25519 ECH key pair and builds the ECHConfig
+// (with version and length) of it.
+func echTestConfig(t *testing.T) (config, privateKey []byte) {
+	pk, sk, err := echTestKEM.Scheme().GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, _ := pk.MarshalBinary()
+	privateKey, _ = sk.MarshalBinary()
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16(ECH_CONFIG_VERSION)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(echTestConfigID)
+		b.AddUint16(uint16(echTestKEM))
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(publicKey) })
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(uint16(echTestKDF))
+			b.AddUint16(uint16(echTestAEAD))
+		})
+		b.AddUint8(0) // maximum_name_length
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte("public.example")) })
+		b.AddUint16(0) // extensions
+	})
+	return b.BytesOrPanic(), privateKey
+}
+
+type echTestExtension struct {
+	id   uint16
+	data []byte
+}
+
+// echTestClientHelloBody builds a TLS 1.3 ClientHello body.
+func echTestClientHelloBody(sessionID []byte, extensions []echTestExtension) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16(0x0303)
+	b.AddBytes(make([]byte, 32)) // random
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sessionID) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint16(0x1301) })
+	b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, ext := range extensions {
+			b.AddUint16(ext.id)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(ext.data) })
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+func echTestServerName(name string) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0) // host_name
+		b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes([]byte(name)) })
+	})
+	return b.BytesOrPanic()
+}
+
+// echTestClientHelloOuter builds a ClientHelloOuter (in a TLS record) whose
+// encrypted_client_hello carries a ClientHelloInner for secret.example, which
+// references supported_groups and signature_algorithms of the outer with
+// ech_outer_extensions and adds ALPN.
+func echTestClientHelloOuter(t *testing.T, config []byte) []byte {
+	encodedInner := echTestClientHelloBody(nil, []echTestExtension{
+		{0, echTestServerName("secret.example")},
+		{EXTENSION_ECH_OUTER_EXTENSIONS, []byte{4, 0x00, 10, 0x00, 13}},
+		{16, []byte{0x00, 0x03, 2, 'h', '2'}}, // alpn: h2, only sent in the inner
+		{43, []byte{2, 0x03, 0x04}},           // supported_versions: TLS 1.3
+		{EXTENSION_ENCRYPTED_CLIENT_HELLO, []byte{ECH_CLIENT_HELLO_TYPE_INNER}},
+	})
+	return echTestSealClientHelloOuter(t, config, encodedInner, nil)
+}
+
+// echTestSealClientHelloOuter builds a ClientHelloOuter (in a TLS record)
+// whose encrypted_client_hello carries the EncodedClientHelloInner, with the
+// extra extensions sent before it.
+func echTestSealClientHelloOuter(t *testing.T, config, encodedInner []byte, extra []echTestExtension) []byte {
+	encodedInner = append(encodedInner, make([]byte, 32-len(encodedInner)%32)...) // padding
+
+	pk, err := echTestKEM.Scheme().UnmarshalBinaryPublicKey(config[9 : 9+32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := hpke.NewSuite(echTestKEM, echTestKDF, echTestAEAD).NewSender(pk, append([]byte("tls ech\x00"), config...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, sealer, err := sender.Setup(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outerBody := func(payload []byte) []byte {
+		ech := cryptobyte.NewBuilder(nil)
+		ech.AddUint8(ECH_CLIENT_HELLO_TYPE_OUTER)
+		ech.AddUint16(uint16(echTestKDF))
+		ech.AddUint16(uint16(echTestAEAD))
+		ech.AddUint8(echTestConfigID)
+		ech.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(enc) })
+		ech.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(payload) })
+
+		extensions := append([]echTestExtension{
+			{0, echTestServerName("public.example")},
+			{10, []byte{0x00, 0x02, 0x00, 0x1d}}, // supported_groups: x25519
+			{13, []byte{0x00, 0x02, 0x04, 0x03}}, // signature_algorithms: ecdsa_secp256r1_sha256
+			{43, []byte{2, 0x03, 0x04}},          // supported_versions: TLS 1.3
+		}, extra...)
+		return echTestClientHelloBody(make([]byte, 32), append(extensions, echTestExtension{EXTENSION_ENCRYPTED_CLIENT_HELLO, ech.BytesOrPanic()}))
+	}
+
+	aad := outerBody(make([]byte, len(encodedInner)+16))
+	payload, err := sealer.Seal(encodedInner, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(0x16)
+	b.AddUint16(0x0301)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0x01)
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(outerBody(payload)) })
+	})
+	return b.BytesOrPanic()
+}
+
+func TestDecryptEncryptedClientHello(t *testing.T) {
+	config, privateKey := echTestConfig(t)
+	outer := echTestClientHelloOuter(t, config)
+
+	// ECH key in PEM as loaded by the Caddy module
+	x25519Key, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(x25519Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configList := append([]byte{byte(len(config) >> 8), byte(len(config))}, config...)
+	pemBytes := append(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		pem.EncodeToMemory(&pem.Block{Type: "ECHCONFIG", Bytes: configList})...)
+
+	keys, err := LoadECHKeysFromPEM(pemBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ConfigID() != echTestConfigID {
+		t.Fatalf("unexpected ECH keys loaded: %v", keys)
+	}
+
+	t.Run("Decrypt", func(t *testing.T) {
+		tfp := NewTLSFingerprinter()
+		defer tfp.Close()
+		tfp.SetECHKeys(keys)
+		if err := tfp.HandleMessage("test", outer); err != nil {
+			t.Fatal(err)
+		}
+		ch := tfp.Pop("test")
+		if ch == nil {
+			t.Fatal("ClientHello not found in TLSFingerprinter")
+		}
+
+		if !ch.EncryptedClientHello.Decrypted || ch.EncryptedClientHello.LikelyGREASE || ch.EncryptedClientHello.GREASEUndetermined {
+			t.Errorf("encrypted_client_hello is expected to be decrypted, got %+v", ch.EncryptedClientHello)
+		}
+
+		inner := ch.InnerClientHello
+		if inner == nil {
+			t.Fatal("InnerClientHello is expected to be present")
+		}
+
+		if ch.ServerName != "public.example" || inner.ServerName != "secret.example" {
+			t.Errorf("server_name mismatch, outer: %s, inner: %s", ch.ServerName, inner.ServerName)
+		}
+
+		// ech_outer_extensions are expanded in place
+		if !slices.Equal(inner.Extensions, []uint16{0, 10, 13, 16, 43, EXTENSION_ENCRYPTED_CLIENT_HELLO}) {
+			t.Errorf("inner extensions mismatch, got %v", inner.Extensions)
+		}
+		if !slices.Equal(inner.NamedGroupList, []uint16{0x001d}) || !slices.Equal(inner.SignatureSchemeList, []uint16{0x0403}) {
+			t.Errorf("extensions referenced by ech_outer_extensions mismatch, got %v and %v", inner.NamedGroupList, inner.SignatureSchemeList)
+		}
+
+		if !slices.Equal(inner.ALPN, []string{"h2"}) || len(ch.ALPN) != 0 {
+			t.Errorf("alpn mismatch, outer: %v, inner: %v", ch.ALPN, inner.ALPN)
+		}
+
+		if inner.EncryptedClientHello == nil || inner.EncryptedClientHello.Type != ECH_CLIENT_HELLO_TYPE_INNER {
+			t.Errorf("inner encrypted_client_hello mismatch, got %+v", inner.EncryptedClientHello)
+		}
+
+		if inner.HexID == "" || inner.HexID == ch.HexID || inner.JA4 == "" {
+			t.Errorf("inner ClientHello is expected to have its own IDs, got %s (outer %s)", inner.HexID, ch.HexID)
+		}
+	})
+
+	t.Run("WrongKey", func(t *testing.T) {
+		otherConfig, otherPrivateKey := echTestConfig(t)
+		otherKey, err := NewECHKey(otherConfig, otherPrivateKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ch, err := ReadClientHello(bytes.NewReader(outer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch.SetECHKeys([]*ECHKey{otherKey})
+		if err = ch.ParseClientHello(); err != nil {
+			t.Fatal(err)
+		}
+
+		if ch.InnerClientHello != nil || ch.EncryptedClientHello.Decrypted || !ch.EncryptedClientHello.LikelyGREASE || ch.EncryptedClientHello.GREASEUndetermined {
+			t.Errorf("encrypted_client_hello is not expected to be decrypted, got %+v", ch.EncryptedClientHello)
+		}
+	})
+
+	t.Run("NoKey", func(t *testing.T) { // real ECH padded to the lengths of GREASE ECH sent by BoringSSL
+		for i, paddingLength := range []int{80, 112, 144, 176} {
+			inner := echTestClientHelloBody(nil, []echTestExtension{{21, make([]byte, paddingLength)}})
+			ch, err := UnmarshalClientHello(echTestSealClientHelloOuter(t, config, inner, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ech := ch.EncryptedClientHello
+			if ech.PayloadLength != 144+32*i {
+				t.Fatalf("payload length mismatch, expecting %d, got %d", 144+32*i, ech.PayloadLength)
+			}
+			if ech.LikelyGREASE || !ech.GREASEUndetermined {
+				t.Errorf("real ECH of %d bytes is expected to be undetermined, got %+v", ech.PayloadLength, ech)
+			}
+		}
+	})
+
+	t.Run("DuplicateExtension", func(t *testing.T) { // must not panic zeroing the payload of the ECH of inner type
+		record := echTestSealClientHelloOuter(t, config, echTestClientHelloBody(nil, nil), []echTestExtension{
+			{EXTENSION_ENCRYPTED_CLIENT_HELLO, []byte{ECH_CLIENT_HELLO_TYPE_INNER}},
+		})
+		ch, err := ReadClientHello(bytes.NewReader(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch.SetECHKeys(keys)
+		if err = ch.ParseClientHello(); err != nil {
+			t.Fatal(err)
+		}
+		if !ch.EncryptedClientHello.Decrypted {
+			t.Errorf("encrypted_client_hello is expected to be decrypted, got %+v", ch.EncryptedClientHello)
+		}
+	})
+
+	t.Run("MalformedInner", func(t *testing.T) {
+		record := echTestSealClientHelloOuter(t, config, echTestClientHelloBody(make([]byte, 32), nil), nil) // legacy_session_id not empty
+		ch, err := ReadClientHello(bytes.NewReader(record))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch.SetECHKeys(keys)
+		if err = ch.ParseClientHello(); err != nil {
+			t.Fatalf("ClientHelloOuter is expected to be parsed, got %v", err)
+		}
+		if !ch.EncryptedClientHello.Decrypted || ch.EncryptedClientHello.InnerError == "" || ch.InnerClientHello != nil {
+			t.Errorf("ClientHelloInner is expected to fail, got %+v", ch.EncryptedClientHello)
+		}
+		if ch.HexID == "" {
+			t.Errorf("ClientHelloOuter is expected to be fingerprinted")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package clienthellod
+
+import (
+	"errors"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// StatusRequestExtension is the decoded status_request(5) extension.
+type StatusRequestExtension struct {
+	StatusType              uint8  `json:"status_type"`               // 1 for OCSP
+	ResponderIDListLength   uint16 `json:"responder_id_list_length"`  // OCSP only
+	RequestExtensionsLength uint16 `json:"request_extensions_length"` // OCSP only
+}
+
+// SessionTicketExtension is the decoded session_ticket(35) extension.
+type SessionTicketExtension struct {
+	TicketPresent bool `json:"ticket_present"`
+	TicketLength  int  `json:"ticket_length"`
+}
+
+// PreSharedKeyExtension is the decoded pre_shared_key(41) extension.
+type PreSharedKeyExtension struct {
+	IdentityCount        int      `json:"identity_count"`
+	IdentityLengths      []int    `json:"identity_lengths"`
+	ObfuscatedTicketAges []uint32 `json:"obfuscated_ticket_ages"`
+	BinderLengths        []int    `json:"binder_lengths"`
+}
+
+// RenegotiationInfoExtension is the decoded renegotiation_info(65281) extension.
+type RenegotiationInfoExtension struct {
+	RenegotiatedConnection utils.Uint8Arr `json:"renegotiated_connection"` // empty for initial handshakes
+}
+
+// parseExtensionPayload decodes the payload of extensions into the fields
+// describing them, beyond the lists fingerprinted. An extension is malformed
+// if its payload can't be read or has trailing data after it is read, in which
+// case its field is left unset.
+func (ch *ClientHello) parseExtensionPayload(extensionID uint16, extensionData cryptobyte.String) error { // skipcq: GO-R1005
+	switch extensionID {
+	case dicttls.ExtType_status_request:
+		sr := &StatusRequestExtension{}
+		if !extensionData.ReadUint8(&sr.StatusType) {
+			return errors.New("unable to read status_request status type")
+		}
+		if sr.StatusType == 1 { // ocsp
+			var responderIDList, requestExtensions cryptobyte.String
+			if !extensionData.ReadUint16LengthPrefixed(&responderIDList) ||
+				!extensionData.ReadUint16LengthPrefixed(&requestExtensions) {
+				return errors.New("unable to read status_request OCSP request")
+			}
+			if !extensionData.Empty() {
+				return errors.New("trailing data after status_request OCSP request")
+			}
+			sr.ResponderIDListLength = uint16(len(responderIDList))
+			sr.RequestExtensionsLength = uint16(len(requestExtensions))
+		}
+		ch.StatusRequest = sr
+	case dicttls.ExtType_extended_master_secret:
+		ch.ExtendedMasterSecret = true
+	case dicttls.ExtType_encrypt_then_mac:
+		ch.EncryptThenMAC = true
+	case dicttls.ExtType_signed_certificate_timestamp:
+		ch.SignedCertificateTimestamp = true
+	case dicttls.ExtType_padding:
+		ch.PaddingLength = len(extensionData)
+	case dicttls.ExtType_delegated_credentials:
+		var sigSchemes cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&sigSchemes) {
+			return errors.New("unable to read delegated_credentials signature schemes")
+		}
+		if !extensionData.Empty() {
+			return errors.New("trailing data after delegated_credentials signature schemes")
+		}
+		delegatedCredentials := []uint16{}
+		for !sigSchemes.Empty() {
+			var sigScheme uint16
+			if !sigSchemes.ReadUint16(&sigScheme) {
+				return errors.New("unable to read delegated_credentials signature scheme")
+			}
+			delegatedCredentials = append(delegatedCredentials, sigScheme)
+		}
+		ch.DelegatedCredentials = delegatedCredentials
+	case dicttls.ExtType_session_ticket:
+		ch.SessionTicket = &SessionTicketExtension{
+			TicketPresent: len(extensionData) > 0,
+			TicketLength:  len(extensionData),
+		}
+	case dicttls.ExtType_pre_shared_key:
+		psk := &PreSharedKeyExtension{}
+		var identities, binders cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&identities) ||
+			!extensionData.ReadUint16LengthPrefixed(&binders) {
+			return errors.New("unable to read pre_shared_key identities and binders")
+		}
+		if !extensionData.Empty() {
+			return errors.New("trailing data after pre_shared_key binders")
+		}
+		for !identities.Empty() {
+			var identity cryptobyte.String
+			var obfuscatedTicketAge uint32
+			if !identities.ReadUint16LengthPrefixed(&identity) || !identities.ReadUint32(&obfuscatedTicketAge) {
+				return errors.New("unable to read pre_shared_key identity")
+			}
+			psk.IdentityLengths = append(psk.IdentityLengths, len(identity))
+			psk.ObfuscatedTicketAges = append(psk.ObfuscatedTicketAges, obfuscatedTicketAge)
+		}
+		psk.IdentityCount = len(psk.IdentityLengths)
+		for !binders.Empty() {
+			var binder cryptobyte.String
+			if !binders.ReadUint8LengthPrefixed(&binder) {
+				return errors.New("unable to read pre_shared_key binder")
+			}
+			psk.BinderLengths = append(psk.BinderLengths, len(binder))
+		}
+		ch.PreSharedKey = psk
+	case dicttls.ExtType_early_data:
+		ch.EarlyData = true
+	case dicttls.ExtType_cookie:
+		var cookie cryptobyte.String
+		if !extensionData.ReadUint16LengthPrefixed(&cookie) {
+			return errors.New("unable to read cookie")
+		}
+		if !extensionData.Empty() {
+			return errors.New("trailing data after cookie")
+		}
+		ch.CookieLength = len(cookie)
+	case dicttls.ExtType_post_handshake_auth:
+		ch.PostHandshakeAuth = true
+	case EXTENSION_ENCRYPTED_CLIENT_HELLO:
+		ech, err := parseEncryptedClientHello(extensionData)
+		if err != nil {
+			return err
+		}
+		ch.EncryptedClientHello = ech
+	case dicttls.ExtType_renegotiation_info:
+		var renegotiatedConnection cryptobyte.String
+		if !extensionData.ReadUint8LengthPrefixed(&renegotiatedConnection) {
+			return errors.New("unable to read renegotiation_info")
+		}
+		if !extensionData.Empty() {
+			return errors.New("trailing data after renegotiation_info")
+		}
+		ch.RenegotiationInfo = &RenegotiationInfoExtension{
+			RenegotiatedConnection: utils.Uint8Arr(renegotiatedConnection),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	"golang.org/x/exp/slices"
+)
+
+func TestParseExtensionPayloads(t *testing.T) {
+	t.Run("Firefox126", testParseExtensionPayloadsFirefox126)
+	t.Run("QUIC_Firefox126_0-RTT", testParseExtensionPayloadsQUICFirefox126ZeroRTT)
+	t.Run("Malformed", testParseExtensionPayloadsMalformed)
+}
+
+func testParseExtensionPayloadsFirefox126(t *testing.T) {
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(ch.StatusRequest, &StatusRequestExtension{StatusType: 1}) {
+		t.Errorf("status_request mismatch, got %+v", ch.StatusRequest)
+	}
+
+	if !ch.ExtendedMasterSecret {
+		t.Errorf("extended_master_secret is expected to be present")
+	}
+
+	if ch.EncryptThenMAC || ch.SignedCertificateTimestamp || ch.EarlyData || ch.PostHandshakeAuth {
+		t.Errorf("unexpected empty extension(s) present")
+	}
+
+	if !slices.Equal(ch.DelegatedCredentials, []uint16{0x0403, 0x0503, 0x0603, 0x0203}) {
+		t.Errorf("delegated_credentials mismatch, got %v", ch.DelegatedCredentials)
+	}
+
+	if !reflect.DeepEqual(ch.SessionTicket, &SessionTicketExtension{}) {
+		t.Errorf("session_ticket mismatch, got %+v", ch.SessionTicket)
+	}
+
+	if ch.RenegotiationInfo == nil || len(ch.RenegotiationInfo.RenegotiatedConnection) != 0 {
+		t.Errorf("renegotiation_info mismatch, got %+v", ch.RenegotiationInfo)
+	}
+
+	if ch.PreSharedKey != nil {
+		t.Errorf("pre_shared_key is not expected, got %+v", ch.PreSharedKey)
+	}
+}
+
+func testParseExtensionPayloadsQUICFirefox126ZeroRTT(t *testing.T) {
+	ch := parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials["Firefox126_0-RTT"], NormalizationPolicy{})
+
+	if !ch.EarlyData {
+		t.Errorf("early_data is expected to be present")
+	}
+
+	if !reflect.DeepEqual(ch.PreSharedKey, &PreSharedKeyExtension{
+		IdentityCount:        1,
+		IdentityLengths:      []int{163},
+		ObfuscatedTicketAges: []uint32{91509},
+		BinderLengths:        []int{32},
+	}) {
+		t.Errorf("pre_shared_key mismatch, got %+v", ch.PreSharedKey)
+	}
+
+	if ch.SessionTicket != nil {
+		t.Errorf("session_ticket is not expected, got %+v", ch.SessionTicket)
+	}
+}
+
+func testParseExtensionPayloadsMalformed(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ext  lintExtension
+		ok   func(ch *ClientHello) bool
+	}{
+		{"status_request", lintExtension{5, []byte{1, 0}}, func(ch *ClientHello) bool { return ch.StatusRequest == nil }}, // truncated OCSP request
+		{"delegated_credentials", lintExtension{34, []byte{0, 3, 4, 3, 5}}, func(ch *ClientHello) bool { return ch.DelegatedCredentials == nil }},
+		{"pre_shared_key", lintExtension{41, []byte{0, 10, 0}}, func(ch *ClientHello) bool { return ch.PreSharedKey == nil }},
+		{"cookie", lintExtension{44, []byte{0, 8, 1}}, func(ch *ClientHello) bool { return ch.CookieLength == 0 }},
+		{"renegotiation_info", lintExtension{65281, []byte{4}}, func(ch *ClientHello) bool { return ch.RenegotiationInfo == nil }},
+		{"status_request_trailing", lintExtension{5, []byte{1, 0, 0, 0, 0, 0}}, func(ch *ClientHello) bool { return ch.StatusRequest == nil }},
+		{"delegated_credentials_trailing", lintExtension{34, []byte{0, 2, 4, 3, 5}}, func(ch *ClientHello) bool { return ch.DelegatedCredentials == nil }},
+		{"pre_shared_key_trailing", lintExtension{41, append(slices.Clone(lintPreSharedKey), 0)}, func(ch *ClientHello) bool { return ch.PreSharedKey == nil }},
+		{"cookie_trailing", lintExtension{44, []byte{0, 1, 1, 2}}, func(ch *ClientHello) bool { return ch.CookieLength == 0 }},
+		{"renegotiation_info_trailing", lintExtension{65281, []byte{0, 0}}, func(ch *ClientHello) bool { return ch.RenegotiationInfo == nil }},
+		{"encrypted_client_hello_trailing", lintExtension{0xfe0d, []byte{1, 0}}, func(ch *ClientHello) bool { return ch.EncryptedClientHello == nil }}, // inner
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := lintClientHello(t, 0x0303, []uint8{0}, []lintExtension{{22, nil}, tc.ext, {23, nil}})
+
+			if !tc.ok(ch) {
+				t.Errorf("malformed %s is expected to be left unset", tc.name)
+			}
+			if !slices.Equal(ch.MalformedExtensions, []uint16{tc.ext.id}) {
+				t.Errorf("malformed extensions mismatch, expecting [%d], got %v", tc.ext.id, ch.MalformedExtensions)
+			}
+			if !slices.Equal(ch.Extensions, []uint16{22, tc.ext.id, 23}) || !ch.ExtendedMasterSecret {
+				t.Errorf("extensions after the malformed one are expected to be parsed, got %v", ch.Extensions)
+			}
+			if ch.HexID == "" || ch.JA4 == "" {
+				t.Errorf("ClientHello with a malformed %s is expected to be fingerprinted", tc.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package clienthellod
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+// Locations of GREASE values, named after the JSON fields of the lists.
+const (
+	GREASE_LOCATION_CIPHER_SUITE             = "cipher_suites"
+	GREASE_LOCATION_EXTENSION                = "extensions"
+	GREASE_LOCATION_SUPPORTED_GROUP          = "supported_groups"
+	GREASE_LOCATION_SIGNATURE_ALGORITHM      = "signature_algorithms"
+	GREASE_LOCATION_SUPPORTED_VERSION        = "supported_versions"
+	GREASE_LOCATION_PSK_KEY_EXCHANGE_MODE    = "psk_key_exchange_modes"
+	GREASE_LOCATION_KEY_SHARE                = "key_share"
+	GREASE_LOCATION_QUIC_TRANSPORT_PARAMETER = "quic_transport_parameters"
+)
+
+// GREASEAnomalyCode identifies a kind of GREASE use no BoringSSL-based client
+// would show.
+type GREASEAnomalyCode string
+
+// Codes of the anomalies reported in [GREASEAnalysis] and by
+// [GREASETracker.Observe].
+const (
+	GREASE_ANOMALY_REUSED_VALUE        GREASEAnomalyCode = "reused_value"        // the same value where BoringSSL picks different ones
+	GREASE_ANOMALY_MISMATCHED_VALUE    GREASEAnomalyCode = "mismatched_value"    // different values where BoringSSL sends the same one
+	GREASE_ANOMALY_UNEXPECTED_POSITION GREASEAnomalyCode = "unexpected_position" // a value where BoringSSL never puts one
+	GREASE_ANOMALY_STATIC_VALUE        GREASEAnomalyCode = "static_value"        // the same values across connections from one source
+)
+
+// GREASEValue is a GREASE value as sent, before being replaced with
+// tls.GREASE_PLACEHOLDER (or QTP_GREASE) in the parsed fields.
+type GREASEValue struct {
+	Location string `json:"location"` // e.g., GREASE_LOCATION_CIPHER_SUITE
+	Position int    `json:"position"` // index in the list as sent
+	Value    uint64 `json:"value"`
+}
+
+// GREASEAnomaly is a use of GREASE telling an imitation of a BoringSSL-based
+// client, e.g., Chrome, apart from the real one.
+type GREASEAnomaly struct {
+	Code    GREASEAnomalyCode `json:"code"`
+	Message string            `json:"message"`
+}
+
+// GREASEAnalysis describes the GREASE values sent in a ClientHello.
+type GREASEAnalysis struct {
+	Values    []GREASEValue   `json:"values"`
+	Anomalies []GREASEAnomaly `json:"anomalies,omitempty"`
+}
+
+// analyzeGREASE analyzes the GREASE values recorded while parsing, or
+// returns nil if none is sent.
+func (ch *ClientHello) analyzeGREASE() *GREASEAnalysis {
+	if len(ch.greaseValues) == 0 {
+		return nil
+	}
+
+	ga := &GREASEAnalysis{Values: ch.greaseValues}
+	ga.Anomalies = append(ga.Anomalies, ch.greaseReusedValues()...)
+	ga.Anomalies = append(ga.Anomalies, ch.greaseMismatchedValues()...)
+	ga.Anomalies = append(ga.Anomalies, ch.greaseUnexpectedPositions()...)
+	return ga
+}
+
+// greaseTransportParameters returns the GREASE transport parameters in the
+// extension data of quic_transport_parameters, which are replaced with
+// QTP_GREASE and sorted by ParseQUICTransportParameters.
+func greaseTransportParameters(extData []byte) []GREASEValue {
+	var values []GREASEValue
+	r := bytes.NewReader(extData)
+	for position := 0; r.Len() > 0; position++ {
+		paramType, _, err := ReadNextVLI(r)
+		if err != nil {
+			return values
+		}
+		paramValLen, _, err := ReadNextVLI(r)
+		if err != nil || paramValLen > uint64(r.Len()) {
+			return values
+		}
+		if IsGREASETransportParameter(paramType) {
+			values = append(values, GREASEValue{GREASE_LOCATION_QUIC_TRANSPORT_PARAMETER, position, paramType})
+		}
+		if _, err = r.Seek(int64(paramValLen), io.SeekCurrent); err != nil {
+			return values
+		}
+	}
+	return values
+}
+
+// greaseReusedValues checks the GREASE values against BoringSSL, which picks
+// the value of each of cipher_suites, supported_groups (and key_share),
+// supported_versions and the two GREASE extensions at random, making sure
+// the two extensions differ.
+//
+// Only the two GREASE extensions sharing a value is conclusive. The same value
+// in all 4 of the lists is reported too, though a real client sends it by
+// chance once in 4096 connections. The same value in only 3 of them, sent by
+// chance once in 256 connections, is not reported.
+func (ch *ClientHello) greaseReusedValues() []GREASEAnomaly {
+	var anomalies []GREASEAnomaly
+
+	var extensions []uint64
+	slots := map[string]uint64{}
+	for _, v := range ch.greaseValues {
+		switch v.Location {
+		case GREASE_LOCATION_EXTENSION:
+			extensions = append(extensions, v.Value)
+			if len(extensions) == 1 {
+				slots[v.Location] = v.Value
+			}
+		case GREASE_LOCATION_CIPHER_SUITE, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION:
+			if _, ok := slots[v.Location]; !ok {
+				slots[v.Location] = v.Value
+			}
+		}
+	}
+
+	for i := 1; i < len(extensions); i++ {
+		if slices.Contains(extensions[:i], extensions[i]) {
+			anomalies = append(anomalies, GREASEAnomaly{
+				Code:    GREASE_ANOMALY_REUSED_VALUE,
+				Message: fmt.Sprintf("GREASE extension 0x%04x is sent more than once", extensions[i]),
+			})
+		}
+	}
+
+	if len(slots) == 4 {
+		locations := make([]string, 0, len(slots))
+		var value uint64
+		reused := true
+		for location, v := range slots {
+			if len(locations) > 0 && v != value {
+				reused = false
+				break
+			}
+			value = v
+			locations = append(locations, location)
+		}
+		if reused {
+			slices.Sort(locations)
+			anomalies = append(anomalies, GREASEAnomaly{
+				Code:    GREASE_ANOMALY_REUSED_VALUE,
+				Message: fmt.Sprintf("the same GREASE value 0x%04x is sent in %s", value, strings.Join(locations, ", ")),
+			})
+		}
+	}
+	return anomalies
+}
+
+// greaseMismatchedValues checks the GREASE values against BoringSSL, which
+// sends the GREASE group of supported_groups in key_share as well.
+func (ch *ClientHello) greaseMismatchedValues() []GREASEAnomaly {
+	var group, keyShare *GREASEValue
+	for i, v := range ch.greaseValues {
+		switch {
+		case v.Location == GREASE_LOCATION_SUPPORTED_GROUP && group == nil:
+			group = &ch.greaseValues[i]
+		case v.Location == GREASE_LOCATION_KEY_SHARE && keyShare == nil:
+			keyShare = &ch.greaseValues[i]
+		}
+	}
+
+	if group == nil || keyShare == nil || group.Value == keyShare.Value {
+		return nil
+	}
+	return []GREASEAnomaly{{
+		Code:    GREASE_ANOMALY_MISMATCHED_VALUE,
+		Message: fmt.Sprintf("GREASE key share 0x%04x differs from GREASE group 0x%04x", keyShare.Value, group.Value),
+	}}
+}
+
+// greaseUnexpectedPositions checks the positions of the GREASE values
+// against BoringSSL, which puts them first in cipher_suites,
+// supported_groups, supported_versions and key_share, sends a GREASE
+// extension first and another one last, before padding and pre_shared_key,
+// and never sends any in signature_algorithms.
+func (ch *ClientHello) greaseUnexpectedPositions() []GREASEAnomaly {
+	last := len(ch.Extensions) - 1
+	for last > 0 && (ch.Extensions[last] == dicttls.ExtType_padding || ch.Extensions[last] == dicttls.ExtType_pre_shared_key) {
+		last--
+	}
+
+	var anomalies []GREASEAnomaly
+	for _, v := range ch.greaseValues {
+		switch v.Location {
+		case GREASE_LOCATION_CIPHER_SUITE, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION, GREASE_LOCATION_KEY_SHARE:
+			if v.Position == 0 {
+				continue
+			}
+		case GREASE_LOCATION_EXTENSION:
+			if v.Position == 0 || v.Position == last {
+				continue
+			}
+		case GREASE_LOCATION_SIGNATURE_ALGORITHM: // anywhere
+		default:
+			continue
+		}
+		anomalies = append(anomalies, GREASEAnomaly{
+			Code:    GREASE_ANOMALY_UNEXPECTED_POSITION,
+			Message: fmt.Sprintf("GREASE value 0x%04x is at position %d of %s", v.Value, v.Position, v.Location),
+		})
+	}
+	return anomalies
+}
+
+// DEFAULT_GREASE_TRACKER_EXPIRY is the default time the state of a source is
+// kept by [GREASETracker] after its last connection.
+const DEFAULT_GREASE_TRACKER_EXPIRY = 10 * time.Minute
+
+// DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS is the default number of
+// connections in a row from one source sending the same GREASE values for
+// [GREASETracker] to report them as static. A BoringSSL-based client sends
+// the same values in 3 connections in a row once in millions.
+const DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS = 3
+
+// GREASETracker follows the GREASE values sent by each source, e.g., an IP
+// address, across connections. A real client picks new GREASE values for
+// every connection, while imitation stacks often send hardcoded ones.
+//
+// It keeps a small state for every source observed until
+// [GREASETracker.Forget] is called or the source sends nothing for
+// [DEFAULT_GREASE_TRACKER_EXPIRY] (or the timeout set). It is safe for
+// concurrent use.
+type GREASETracker struct {
+	mutex           sync.Mutex
+	sources         map[string]*greaseHistory
+	minObservations int
+	timeout         time.Duration
+}
+
+type greaseHistory struct {
+	values   string // GREASE values sent in the last connection
+	streak   int    // connections in a row sending values
+	lastSeen time.Time
+	timer    *time.Timer // expiring the history
+}
+
+// NewGREASETracker creates a new GREASETracker reporting GREASE values as
+// static after [DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS] connections.
+func NewGREASETracker() *GREASETracker {
+	return NewGREASETrackerWithMinObservations(DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS)
+}
+
+// NewGREASETrackerWithMinObservations creates a new GREASETracker reporting
+// GREASE values as static after minObservations connections in a row from
+// one source, at least 2.
+func NewGREASETrackerWithMinObservations(minObservations int) *GREASETracker {
+	return &GREASETracker{
+		sources:         make(map[string]*greaseHistory),
+		minObservations: max(minObservations, 2),
+	}
+}
+
+// SetTimeout sets the time the state of a source is kept after its last
+// connection. A non-positive timeout means [DEFAULT_GREASE_TRACKER_EXPIRY].
+func (gt *GREASETracker) SetTimeout(timeout time.Duration) {
+	gt.mutex.Lock()
+	defer gt.mutex.Unlock()
+
+	gt.timeout = timeout
+}
+
+func (gt *GREASETracker) expiry() time.Duration {
+	if gt.timeout <= 0 {
+		return DEFAULT_GREASE_TRACKER_EXPIRY
+	}
+	return gt.timeout
+}
+
+// Observe records the GREASE values of the ClientHello of a new connection
+// from the source and returns the anomalies found in the ClientHello,
+// including GREASE_ANOMALY_STATIC_VALUE if the source keeps sending the same
+// values. A ClientHello sending no GREASE is ignored.
+//
+// GREASE transport parameters are left out of the comparison, since QUIC
+// clients such as Firefox send a fixed one.
+//
+// Each connection must be observed once, e.g., not for every QUIC Initial
+// packet retransmitted.
+func (gt *GREASETracker) Observe(source string, ch *ClientHello) []GREASEAnomaly {
+	if ch.GREASE == nil {
+		return nil
+	}
+	anomalies := slices.Clone(ch.GREASE.Anomalies)
+
+	var b strings.Builder
+	for _, v := range ch.GREASE.Values {
+		if v.Location != GREASE_LOCATION_QUIC_TRANSPORT_PARAMETER {
+			fmt.Fprintf(&b, "%s:%d:%x,", v.Location, v.Position, v.Value)
+		}
+	}
+	values := b.String()
+	if values == "" {
+		return anomalies
+	}
+
+	gt.mutex.Lock()
+	history, ok := gt.sources[source]
+	if !ok {
+		history = &greaseHistory{}
+		history.timer = time.AfterFunc(gt.expiry(), func() { gt.expire(source, history) })
+		gt.sources[source] = history
+	} else {
+		history.timer.Reset(gt.expiry())
+	}
+	history.lastSeen = time.Now()
+	if history.values == values {
+		history.streak++
+	} else {
+		history.values, history.streak = values, 1
+	}
+	streak := history.streak
+	gt.mutex.Unlock()
+
+	if streak >= gt.minObservations {
+		anomalies = append(anomalies, GREASEAnomaly{
+			Code:    GREASE_ANOMALY_STATIC_VALUE,
+			Message: fmt.Sprintf("the same GREASE values are sent in %d connections in a row", streak),
+		})
+	}
+	return anomalies
+}
+
+// Forget drops the state kept for the source, e.g., when it goes idle.
+func (gt *GREASETracker) Forget(source string) {
+	gt.mutex.Lock()
+	defer gt.mutex.Unlock()
+
+	if history, ok := gt.sources[source]; ok {
+		history.timer.Stop()
+		delete(gt.sources, source)
+	}
+}
+
+// expire drops the history of the source if it has not been observed since
+// the expiry, or reschedules the expiry otherwise.
+func (gt *GREASETracker) expire(source string, history *greaseHistory) {
+	gt.mutex.Lock()
+	defer gt.mutex.Unlock()
+
+	if gt.sources[source] != history {
+		return // forgotten
+	}
+	if idle := time.Since(history.lastSeen); idle < gt.expiry() {
+		history.timer.Reset(gt.expiry() - idle)
+		return
+	}
+	delete(gt.sources, source)
+}
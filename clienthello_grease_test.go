@@ -0,0 +1,209 @@
+package clienthellod_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+	"golang.org/x/exp/slices"
+)
+
+// greaseCipherSuiteClientHello builds and parses a ClientHello with the given
+// extensions, sending the GREASE cipher suite 0x0a0a in place of 0x1301.
+func greaseCipherSuiteClientHello(t *testing.T, extensions []lintExtension) *ClientHello {
+	record := lintClientHelloRecord(tls.VersionTLS12, []uint8{0}, extensions)
+	record[5+4+2+32+1+2], record[5+4+2+32+1+2+1] = 0x0a, 0x0a // record and handshake headers, version, random, session ID, cipher suites length
+	ch, err := UnmarshalClientHello(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestClientHelloGREASE(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reused := []lintExtension{
+		{0x0a0a, nil},
+		{10, lintUint16List(2, 0x0a0a, 29)},
+		{43, lintUint16List(1, 0x0a0a, tls.VersionTLS13)},
+		{0x0a0a, nil},
+	}
+	reusedInThreeLists := slices.Clone(reused)
+	reusedInThreeLists[3] = lintExtension{0x1a1a, nil}
+
+	for _, tc := range []struct {
+		name      string
+		ch        *ClientHello
+		locations []string // in any order, as extensions are shuffled by Chrome
+		anomalies []GREASEAnomalyCode
+	}{
+		{"Chrome120", uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10), []string{
+			GREASE_LOCATION_CIPHER_SUITE, GREASE_LOCATION_EXTENSION, GREASE_LOCATION_EXTENSION,
+			GREASE_LOCATION_KEY_SHARE, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION,
+		}, nil},
+		{"Firefox126", firefox, nil, nil},
+		{"Reused", lintClientHello(t, tls.VersionTLS12, []uint8{0}, reused), []string{
+			GREASE_LOCATION_EXTENSION, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION, GREASE_LOCATION_EXTENSION,
+		}, []GREASEAnomalyCode{GREASE_ANOMALY_REUSED_VALUE}}, // only the extensions, as 3 lists share a value by chance
+		{"ReusedInThreeLists", lintClientHello(t, tls.VersionTLS12, []uint8{0}, reusedInThreeLists), []string{
+			GREASE_LOCATION_EXTENSION, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION, GREASE_LOCATION_EXTENSION,
+		}, nil},
+		{"ReusedInEveryList", greaseCipherSuiteClientHello(t, reusedInThreeLists), []string{
+			GREASE_LOCATION_CIPHER_SUITE, GREASE_LOCATION_EXTENSION, GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_SUPPORTED_VERSION, GREASE_LOCATION_EXTENSION,
+		}, []GREASEAnomalyCode{GREASE_ANOMALY_REUSED_VALUE}},
+		{"Position", lintClientHello(t, tls.VersionTLS12, []uint8{0}, []lintExtension{
+			{10, lintUint16List(2, 29, 0x1a1a)},
+			{0x2a2a, nil},
+			{51, lintKeyShare(29, 0x1a1a)},
+			{21, make([]byte, 8)}, // padding
+		}), []string{
+			GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_EXTENSION, GREASE_LOCATION_KEY_SHARE,
+		}, []GREASEAnomalyCode{GREASE_ANOMALY_UNEXPECTED_POSITION, GREASE_ANOMALY_UNEXPECTED_POSITION, GREASE_ANOMALY_UNEXPECTED_POSITION}},
+		{"KeyShareMismatch", lintClientHello(t, tls.VersionTLS12, []uint8{0}, []lintExtension{
+			{10, lintUint16List(2, 0x1a1a, 29)},
+			{51, lintKeyShare(0x2a2a, 29)},
+		}), []string{
+			GREASE_LOCATION_SUPPORTED_GROUP, GREASE_LOCATION_KEY_SHARE,
+		}, []GREASEAnomalyCode{GREASE_ANOMALY_MISMATCHED_VALUE}},
+		{"SignatureAlgorithm", lintClientHello(t, tls.VersionTLS12, []uint8{0}, []lintExtension{
+			{13, lintUint16List(2, 0x0a0a, 0x0403)},
+		}), []string{
+			GREASE_LOCATION_SIGNATURE_ALGORITHM,
+		}, []GREASEAnomalyCode{GREASE_ANOMALY_UNEXPECTED_POSITION}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.locations == nil {
+				if tc.ch.GREASE != nil {
+					t.Fatalf("no GREASE expected, got %+v", tc.ch.GREASE)
+				}
+				return
+			}
+
+			if len(tc.ch.GREASE.Values) != len(tc.locations) {
+				t.Fatalf("GREASE values mismatch, expecting %v, got %+v", tc.locations, tc.ch.GREASE.Values)
+			}
+			locations := make([]string, 0, len(tc.ch.GREASE.Values))
+			for _, v := range tc.ch.GREASE.Values {
+				if v.Value&0x0f0f != 0x0a0a {
+					t.Errorf("0x%04x in %s is not a GREASE value", v.Value, v.Location)
+				}
+				locations = append(locations, v.Location)
+			}
+			expected := slices.Clone(tc.locations)
+			slices.Sort(expected)
+			slices.Sort(locations)
+			if !slices.Equal(locations, expected) {
+				t.Errorf("GREASE locations mismatch, expecting %v, got %v", expected, locations)
+			}
+			anomalies := tc.ch.GREASE.Anomalies
+			if tc.name == "Chrome120" { // GREASE values picked at random collide once in 4096
+				anomalies = slices.DeleteFunc(slices.Clone(anomalies), func(a GREASEAnomaly) bool { return a.Code == GREASE_ANOMALY_REUSED_VALUE })
+			}
+			if len(anomalies) != len(tc.anomalies) {
+				t.Fatalf("anomalies mismatch, expecting %v, got %+v", tc.anomalies, anomalies)
+			}
+			for i, code := range tc.anomalies {
+				if anomalies[i].Code != code {
+					t.Errorf("anomaly #%d mismatch, expecting %s, got %+v", i, code, anomalies[i])
+				}
+			}
+		})
+	}
+}
+
+func TestClientHelloGREASEPositions(t *testing.T) {
+	ch := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+	if ch.CipherSuites[0] != tls.GREASE_PLACEHOLDER || ch.Extensions[0] != tls.GREASE_PLACEHOLDER {
+		t.Fatalf("GREASE placeholders expected in the parsed fields, got %v and %v", ch.CipherSuites, ch.Extensions)
+	}
+
+	var extensions []GREASEValue
+	for _, v := range ch.GREASE.Values {
+		if v.Location == GREASE_LOCATION_EXTENSION {
+			extensions = append(extensions, v)
+			if ch.Extensions[v.Position] != tls.GREASE_PLACEHOLDER {
+				t.Errorf("GREASE extension at position %d expected, got %v", v.Position, ch.Extensions)
+			}
+		}
+	}
+	if len(extensions) != 2 || extensions[0].Position != 0 || extensions[0].Value == extensions[1].Value {
+		t.Errorf("2 different GREASE extensions expected, the first one first, got %+v", extensions)
+	}
+}
+
+func TestQUICClientHelloGREASE(t *testing.T) {
+	gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+	for _, d := range mapGatheredClientInitials["Chrome125"] {
+		cip, err := UnmarshalQUICClientInitialPacket(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = gci.AddPacket(cip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	qfp, err := GenerateQUICFingerprint(gci)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ga := qfp.ClientInitials.ClientHello.GREASE
+	if ga == nil || len(ga.Values) != 1 || ga.Values[0].Location != GREASE_LOCATION_QUIC_TRANSPORT_PARAMETER {
+		t.Fatalf("a GREASE transport parameter is expected, got %+v", ga)
+	}
+	if !IsGREASETransportParameter(ga.Values[0].Value) {
+		t.Errorf("0x%x is not a GREASE transport parameter", ga.Values[0].Value)
+	}
+}
+
+func TestGREASETracker(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+
+	static := func(anomalies []GREASEAnomaly) bool {
+		for _, anomaly := range anomalies {
+			if anomaly.Code == GREASE_ANOMALY_STATIC_VALUE {
+				return true
+			}
+		}
+		return false
+	}
+
+	gt := NewGREASETracker()
+	for i := 0; i < 5; i++ { // new GREASE values for every connection
+		if static(gt.Observe("chrome", uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10))) {
+			t.Fatalf("connection #%d: static GREASE values not expected", i)
+		}
+	}
+	for i := 0; i < 5; i++ { // no GREASE
+		if anomalies := gt.Observe("firefox", firefox); anomalies != nil {
+			t.Fatalf("connection #%d: no anomaly expected, got %+v", i, anomalies)
+		}
+	}
+
+	for i := 1; i <= DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS; i++ { // hardcoded GREASE values
+		if static(gt.Observe("utls", chrome)) != (i == DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS) {
+			t.Fatalf("connection #%d: static GREASE values expected after %d connections", i, DEFAULT_GREASE_TRACKER_MIN_OBSERVATIONS)
+		}
+	}
+	gt.Forget("utls")
+	if static(gt.Observe("utls", chrome)) {
+		t.Errorf("static GREASE values not expected after Forget")
+	}
+
+	gt.SetTimeout(10 * time.Millisecond)
+	gt.Observe("idle", chrome)
+	gt.Observe("idle", chrome)
+	time.Sleep(50 * time.Millisecond)
+	if static(gt.Observe("idle", chrome)) {
+		t.Errorf("static GREASE values not expected after the source expires")
+	}
+}
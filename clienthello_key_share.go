@@ -0,0 +1,108 @@
+package clienthellod
+
+import (
+	"github.com/gaukas/clienthellod/internal/utils"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+// Post-quantum hybrid groups, which are not in dicttls.
+const (
+	GROUP_X25519_KYBER768_DRAFT00 uint16 = 0x6399 // X25519Kyber768Draft00, sent by Chrome 124 to 130
+	GROUP_SECP256R1_MLKEM768      uint16 = 0x11eb // SecP256r1MLKEM768
+	GROUP_X25519_MLKEM768         uint16 = 0x11ec // X25519MLKEM768, sent by Chrome since 131 and Firefox since 132
+	GROUP_SECP384R1_MLKEM1024     uint16 = 0x11ed // SecP384r1MLKEM1024
+)
+
+// keyShareLengths are the lengths of key_exchange in a KeyShareEntry of each
+// group, as specified by RFC 8446 Section 4.2.8.2, RFC 7919 and the drafts
+// of the hybrid groups.
+var keyShareLengths = map[uint16]int{
+	dicttls.SupportedGroups_secp256r1: 65, // uncompressed point
+	dicttls.SupportedGroups_secp384r1: 97,
+	dicttls.SupportedGroups_secp521r1: 133,
+	dicttls.SupportedGroups_x25519:    32,
+	dicttls.SupportedGroups_x448:      56,
+	dicttls.SupportedGroups_ffdhe2048: 256,
+	dicttls.SupportedGroups_ffdhe3072: 384,
+	dicttls.SupportedGroups_ffdhe4096: 512,
+	dicttls.SupportedGroups_ffdhe6144: 768,
+	dicttls.SupportedGroups_ffdhe8192: 1024,
+
+	GROUP_X25519_KYBER768_DRAFT00: 32 + 1184, // X25519 || Kyber768 public key
+	GROUP_SECP256R1_MLKEM768:      65 + 1184, // secp256r1 || ML-KEM-768 encapsulation key
+	GROUP_X25519_MLKEM768:         1184 + 32, // ML-KEM-768 encapsulation key || X25519
+	GROUP_SECP384R1_MLKEM1024:     97 + 1568, // secp384r1 || ML-KEM-1024 encapsulation key
+}
+
+var pqHybridGroups = map[uint16]bool{
+	GROUP_X25519_KYBER768_DRAFT00: true,
+	GROUP_SECP256R1_MLKEM768:      true,
+	GROUP_X25519_MLKEM768:         true,
+	GROUP_SECP384R1_MLKEM1024:     true,
+}
+
+// KeyShareEntry is a KeyShareEntry in key_share(51).
+type KeyShareEntry struct {
+	Group          uint16 `json:"group"`                     // GREASE replaced by tls.GREASE_PLACEHOLDER
+	Name           string `json:"name,omitempty"`            // name of the group, empty if unknown
+	Length         int    `json:"length"`                    // length of key_exchange
+	ExpectedLength int    `json:"expected_length,omitempty"` // length of key_exchange expected for the group, 0 if unknown, e.g., GREASE
+	LengthMismatch bool   `json:"length_mismatch,omitempty"` // Length is not ExpectedLength
+	PQHybrid       bool   `json:"pq_hybrid,omitempty"`       // the group is a post-quantum hybrid, e.g., X25519MLKEM768
+}
+
+// KeyShareAnalysis describes the key shares sent in a ClientHello, in
+// particular the rollout of post-quantum hybrid groups.
+type KeyShareAnalysis struct {
+	Entries []KeyShareEntry `json:"entries"`
+
+	PQHybridOffered  bool `json:"pq_hybrid_offered"`   // a post-quantum hybrid group is in supported_groups
+	PQHybridKeyShare bool `json:"pq_hybrid_key_share"` // a key share of a post-quantum hybrid group is sent
+	LengthMismatch   bool `json:"length_mismatch"`     // any key share is not of the length expected for its group
+}
+
+// analyzeKeyShare analyzes the key shares parsed from key_share against the
+// groups in supported_groups, or returns nil if neither is sent. key_share
+// may be empty, e.g., for the server to pick a group with HelloRetryRequest.
+func (ch *ClientHello) analyzeKeyShare() *KeyShareAnalysis {
+	if !slices.Contains(ch.Extensions, dicttls.ExtType_supported_groups) && !slices.Contains(ch.Extensions, dicttls.ExtType_key_share) {
+		return nil
+	}
+
+	ksa := &KeyShareAnalysis{
+		Entries: make([]KeyShareEntry, 0, len(ch.keyshareGroupsWithLengths)/2),
+	}
+	for _, group := range ch.NamedGroupList {
+		if pqHybridGroups[group] {
+			ksa.PQHybridOffered = true
+		}
+	}
+	for i := 0; i+1 < len(ch.keyshareGroupsWithLengths); i += 2 {
+		entry := KeyShareEntry{
+			Group:          ch.keyshareGroupsWithLengths[i],
+			Length:         int(ch.keyshareGroupsWithLengths[i+1]),
+			ExpectedLength: keyShareLengths[ch.keyshareGroupsWithLengths[i]],
+			PQHybrid:       pqHybridGroups[ch.keyshareGroupsWithLengths[i]],
+		}
+		entry.Name = groupName(entry.Group)
+		entry.LengthMismatch = entry.ExpectedLength != 0 && entry.Length != entry.ExpectedLength
+
+		ksa.PQHybridKeyShare = ksa.PQHybridKeyShare || entry.PQHybrid
+		ksa.LengthMismatch = ksa.LengthMismatch || entry.LengthMismatch
+		ksa.Entries = append(ksa.Entries, entry)
+	}
+	return ksa
+}
+
+// groupName returns the name of a supported group, or an empty string if
+// unknown.
+func groupName(group uint16) string {
+	if utils.IsGREASEUint16(group) {
+		return "GREASE"
+	}
+	if name, ok := extraGroupNames[group]; ok {
+		return name
+	}
+	return dicttls.DictSupportedGroupsValueIndexed[group]
+}
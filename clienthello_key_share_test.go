@@ -0,0 +1,108 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestKeyShareAnalysis(t *testing.T) {
+	t.Run("Firefox126", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &KeyShareAnalysis{
+			Entries: []KeyShareEntry{
+				{Group: 0x001d, Name: "x25519", Length: 32, ExpectedLength: 32},
+				{Group: 0x0017, Name: "secp256r1", Length: 65, ExpectedLength: 65},
+			},
+		}
+		if !reflect.DeepEqual(ch.KeyShareAnalysis, expected) {
+			t.Errorf("key share analysis mismatch, expecting %+v, got %+v", expected, ch.KeyShareAnalysis)
+		}
+	})
+
+	t.Run("Chrome120_PQ", func(t *testing.T) {
+		ch := uTLSClientHello(t, tls.HelloChrome_120_PQ, nil, tls.VersionTLS10)
+
+		expected := &KeyShareAnalysis{
+			Entries: []KeyShareEntry{
+				{Group: tls.GREASE_PLACEHOLDER, Name: "GREASE", Length: 1},
+				{Group: GROUP_X25519_KYBER768_DRAFT00, Name: "X25519Kyber768Draft00", Length: 1216, ExpectedLength: 1216, PQHybrid: true},
+				{Group: 0x001d, Name: "x25519", Length: 32, ExpectedLength: 32},
+			},
+			PQHybridOffered:  true,
+			PQHybridKeyShare: true,
+		}
+		if !reflect.DeepEqual(ch.KeyShareAnalysis, expected) {
+			t.Errorf("key share analysis mismatch, expecting %+v, got %+v", expected, ch.KeyShareAnalysis)
+		}
+	})
+
+	t.Run("QUIC Chrome125", func(t *testing.T) {
+		gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+		for _, d := range mapGatheredClientInitials["Chrome125"] {
+			cip, err := UnmarshalQUICClientInitialPacket(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = gci.AddPacket(cip); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := gci.Wait(); err != nil {
+			t.Fatal(err)
+		}
+
+		ksa := gci.ClientHello.KeyShareAnalysis
+		if ksa == nil || !ksa.PQHybridOffered || !ksa.PQHybridKeyShare || ksa.LengthMismatch {
+			t.Errorf("a post-quantum hybrid key share of the right length is expected, got %+v", ksa)
+		}
+	})
+
+	t.Run("Fake codepoint", func(t *testing.T) {
+		ch := lintClientHello(t, tls.VersionTLS12, []uint8{0}, []lintExtension{
+			{10, lintUint16List(2, GROUP_X25519_MLKEM768, 0x001d)},
+			{51, lintKeyShare(GROUP_X25519_MLKEM768)}, // 32 bytes, as x25519
+		})
+
+		expected := &KeyShareAnalysis{
+			Entries: []KeyShareEntry{
+				{Group: GROUP_X25519_MLKEM768, Name: "X25519MLKEM768", Length: 32, ExpectedLength: 1216, LengthMismatch: true, PQHybrid: true},
+			},
+			PQHybridOffered:  true,
+			PQHybridKeyShare: true,
+			LengthMismatch:   true,
+		}
+		if !reflect.DeepEqual(ch.KeyShareAnalysis, expected) {
+			t.Errorf("key share analysis mismatch, expecting %+v, got %+v", expected, ch.KeyShareAnalysis)
+		}
+	})
+
+	t.Run("Empty key_share", func(t *testing.T) {
+		ch := lintClientHello(t, tls.VersionTLS12, []uint8{0}, []lintExtension{
+			{10, lintUint16List(2, GROUP_X25519_MLKEM768, 0x001d)},
+			{51, lintKeyShare()},
+		})
+
+		expected := &KeyShareAnalysis{
+			Entries:         []KeyShareEntry{},
+			PQHybridOffered: true,
+		}
+		if !reflect.DeepEqual(ch.KeyShareAnalysis, expected) {
+			t.Errorf("key share analysis mismatch, expecting %+v, got %+v", expected, ch.KeyShareAnalysis)
+		}
+	})
+
+	t.Run("No key_share", func(t *testing.T) {
+		ch := lintClientHello(t, tls.VersionTLS12, []uint8{0}, nil)
+		if ch.KeyShareAnalysis != nil {
+			t.Errorf("no key share analysis is expected, got %+v", ch.KeyShareAnalysis)
+		}
+	})
+}
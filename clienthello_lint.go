@@ -0,0 +1,232 @@
+package clienthellod
+
+import (
+	"fmt"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/crypto/cryptobyte"
+)
+
+// LintCode identifies a kind of protocol violation found in a ClientHello.
+type LintCode string
+
+// Codes of the findings reported by [ClientHello.Lint].
+const (
+	LINT_DUPLICATE_EXTENSION                 LintCode = "duplicate_extension"
+	LINT_PRE_SHARED_KEY_NOT_LAST             LintCode = "pre_shared_key_not_last"
+	LINT_KEY_SHARE_GROUP_NOT_OFFERED         LintCode = "key_share_group_not_offered"
+	LINT_TLS13_WITHOUT_KEY_SHARE             LintCode = "tls13_without_key_share"
+	LINT_TLS13_WITHOUT_SUPPORTED_GROUPS      LintCode = "tls13_without_supported_groups"
+	LINT_TLS13_WITHOUT_SIGNATURE_ALGORITHMS  LintCode = "tls13_without_signature_algorithms"
+	LINT_TLS13_NON_NULL_COMPRESSION          LintCode = "tls13_non_null_compression"
+	LINT_LEGACY_VERSION                      LintCode = "legacy_version"
+	LINT_INVALID_GREASE                      LintCode = "invalid_grease"
+	LINT_EARLY_DATA_WITHOUT_PRE_SHARED_KEY   LintCode = "early_data_without_pre_shared_key"
+	LINT_PRE_SHARED_KEY_WITHOUT_PSK_KE_MODES LintCode = "pre_shared_key_without_psk_key_exchange_modes"
+)
+
+// LintFinding is a protocol violation found in a ClientHello.
+type LintFinding struct {
+	Code      LintCode `json:"code"`
+	Message   string   `json:"message"`
+	Reference string   `json:"reference,omitempty"` // the RFC section violated, e.g., "RFC 8446 Section 4.2"
+}
+
+// rawExtension is an extension as sent, with GREASE values untouched.
+type rawExtension struct {
+	id   uint16
+	data cryptobyte.String
+}
+
+// Lint checks the ClientHello against the MUSTs of the TLS specifications
+// and returns all violations found, or nil if none is found. Real browsers
+// and mainstream TLS libraries do not violate them, so most findings are
+// tells of hand-crafted or buggy ClientHellos.
+//
+// Unlike the parsed fields, GREASE values are checked as sent. The
+// ClientHello must have been parsed. An SSLv2-compatible ClientHello is not
+// linted. A DTLS ClientHello is checked against the DTLS versions of RFC 9147.
+func (ch *ClientHello) Lint() []LintFinding { // skipcq: GO-R1005
+	if ch.SSLv2 || len(ch.handshake) == 0 {
+		return nil
+	}
+	extensions := ch.rawExtensions()
+
+	var findings []LintFinding
+	report := func(code LintCode, reference, format string, args ...any) {
+		findings = append(findings, LintFinding{
+			Code:      code,
+			Message:   fmt.Sprintf(format, args...),
+			Reference: reference,
+		})
+	}
+
+	// extensions
+	seen := make(map[uint16]bool, len(extensions))
+	present := make(map[uint16]cryptobyte.String, len(extensions))
+	for i, ext := range extensions {
+		if seen[ext.id] {
+			report(LINT_DUPLICATE_EXTENSION, "RFC 8446 Section 4.2", "extension 0x%04x is sent more than once", ext.id)
+		}
+		seen[ext.id] = true
+		present[ext.id] = ext.data
+
+		if ext.id == dicttls.ExtType_pre_shared_key && i != len(extensions)-1 {
+			report(LINT_PRE_SHARED_KEY_NOT_LAST, "RFC 8446 Section 4.2.11", "pre_shared_key is not the last extension")
+		}
+	}
+	_, hasPSK := present[dicttls.ExtType_pre_shared_key]
+	if _, ok := present[dicttls.ExtType_early_data]; ok && !hasPSK {
+		report(LINT_EARLY_DATA_WITHOUT_PRE_SHARED_KEY, "RFC 8446 Section 4.2.10", "early_data is sent without pre_shared_key")
+	}
+	if _, ok := present[dicttls.ExtType_psk_key_exchange_modes]; hasPSK && !ok {
+		report(LINT_PRE_SHARED_KEY_WITHOUT_PSK_KE_MODES, "RFC 8446 Section 4.2.9", "pre_shared_key is sent without psk_key_exchange_modes")
+	}
+
+	// key_share and supported_groups
+	offeredGroups := make(map[uint16]bool)
+	for _, group := range lintReadUint16List(present[dicttls.ExtType_supported_groups], 2) {
+		offeredGroups[group] = true
+	}
+	if data, ok := present[dicttls.ExtType_key_share]; ok {
+		for _, group := range lintReadKeyShareGroups(data) {
+			if offeredGroups[group] {
+				continue
+			}
+			if utils.IsGREASEUint16(group) {
+				report(LINT_INVALID_GREASE, "RFC 8701 Section 3.1", "GREASE key_share group 0x%04x is not a GREASE value in supported_groups", group)
+			} else {
+				report(LINT_KEY_SHARE_GROUP_NOT_OFFERED, "RFC 8446 Section 4.2.8", "key_share group 0x%04x is not in supported_groups", group)
+			}
+		}
+	}
+
+	// TLS 1.3, or DTLS 1.3 whose legacy_version is DTLS 1.2
+	var versionTLS12, versionTLS13 uint16 = tls.VersionTLS12, tls.VersionTLS13
+	legacyVersionReference := "RFC 8446 Section 4.1.2"
+	if ch.isDTLS() {
+		versionTLS12, versionTLS13 = 0xfefd, 0xfefc
+		legacyVersionReference = "RFC 9147 Section 5.3"
+	}
+	_, hasSupportedVersions := present[dicttls.ExtType_supported_versions]
+	offersTLS13 := false
+	for _, version := range ch.SupportedVersions {
+		if version == versionTLS13 {
+			offersTLS13 = true
+		}
+	}
+	if offersTLS13 {
+		if _, ok := present[dicttls.ExtType_key_share]; !ok {
+			report(LINT_TLS13_WITHOUT_KEY_SHARE, "RFC 8446 Section 9.2", "TLS 1.3 is offered without key_share")
+		}
+		if _, ok := present[dicttls.ExtType_supported_groups]; !ok {
+			report(LINT_TLS13_WITHOUT_SUPPORTED_GROUPS, "RFC 8446 Section 9.2", "TLS 1.3 is offered without supported_groups")
+		}
+		if _, ok := present[dicttls.ExtType_signature_algorithms]; !ok {
+			report(LINT_TLS13_WITHOUT_SIGNATURE_ALGORITHMS, "RFC 8446 Section 9.2", "TLS 1.3 is offered without signature_algorithms")
+		}
+		if len(ch.CompressionMethods) != 1 || ch.CompressionMethods[0] != 0 {
+			report(LINT_TLS13_NON_NULL_COMPRESSION, "RFC 8446 Section 4.1.2", "TLS 1.3 is offered with compression methods %v, not only null", []uint8(ch.CompressionMethods))
+		}
+	}
+	switch {
+	case hasSupportedVersions && ch.TLSHandshakeVersion != versionTLS12:
+		report(LINT_LEGACY_VERSION, legacyVersionReference, "legacy_version is 0x%04x with supported_versions, not 0x%04x", ch.TLSHandshakeVersion, versionTLS12)
+	case !hasSupportedVersions && dtlsToTLSVersion(ch.TLSHandshakeVersion) > tls.VersionTLS12:
+		report(LINT_LEGACY_VERSION, legacyVersionReference, "legacy_version is 0x%04x, above 0x%04x", ch.TLSHandshakeVersion, versionTLS12)
+	}
+
+	// GREASE is reserved for the lists listed in RFC 8701 only
+	if utils.IsGREASEUint16(ch.TLSHandshakeVersion) {
+		report(LINT_INVALID_GREASE, "RFC 8701 Section 3.1", "legacy_version is a GREASE value 0x%04x", ch.TLSHandshakeVersion)
+	}
+	for _, algo := range lintReadUint16List(present[dicttls.ExtType_compress_certificate], 1) {
+		if utils.IsGREASEUint16(algo) {
+			report(LINT_INVALID_GREASE, "RFC 8701 Section 3.1", "compress_certificate has a GREASE value 0x%04x", algo)
+		}
+	}
+	for _, scheme := range lintReadUint16List(present[dicttls.ExtType_delegated_credentials], 2) {
+		if utils.IsGREASEUint16(scheme) {
+			report(LINT_INVALID_GREASE, "RFC 8701 Section 3.1", "delegated_credentials has a GREASE value 0x%04x", scheme)
+		}
+	}
+	return findings
+}
+
+// isDTLS reports whether the ClientHello is sent over DTLS, as told by the
+// version of its record or handshake message.
+func (ch *ClientHello) isDTLS() bool {
+	return dtlsToTLSVersion(ch.TLSRecordVersion) != ch.TLSRecordVersion || dtlsToTLSVersion(ch.TLSHandshakeVersion) != ch.TLSHandshakeVersion
+}
+
+// rawExtensions walks the ClientHello handshake message and returns the
+// extensions as sent. The ClientHello must have been parsed successfully.
+func (ch *ClientHello) rawExtensions() []rawExtension {
+	s := cryptobyte.String(ch.handshake)
+	var skipped cryptobyte.String
+	if !s.Skip(4+2+32) || // handshake header, legacy_version, random
+		!s.ReadUint8LengthPrefixed(&skipped) || // legacy_session_id
+		!s.ReadUint16LengthPrefixed(&skipped) || // cipher_suites
+		!s.ReadUint8LengthPrefixed(&skipped) { // legacy_compression_methods
+		return nil
+	}
+
+	var extensions cryptobyte.String
+	if !s.ReadUint16LengthPrefixed(&extensions) {
+		return nil
+	}
+	var raw []rawExtension
+	for !extensions.Empty() {
+		var ext rawExtension
+		if !extensions.ReadUint16(&ext.id) || !extensions.ReadUint16LengthPrefixed(&ext.data) {
+			return raw
+		}
+		raw = append(raw, ext)
+	}
+	return raw
+}
+
+// lintReadUint16List reads a list of uint16 prefixed with its length in
+// lengthSize bytes, ignoring any malformed tail.
+func lintReadUint16List(data cryptobyte.String, lengthSize int) []uint16 {
+	var list cryptobyte.String
+	switch lengthSize {
+	case 1:
+		if !data.ReadUint8LengthPrefixed(&list) {
+			return nil
+		}
+	case 2:
+		if !data.ReadUint16LengthPrefixed(&list) {
+			return nil
+		}
+	}
+
+	var values []uint16
+	var v uint16
+	for list.ReadUint16(&v) {
+		values = append(values, v)
+	}
+	return values
+}
+
+// lintReadKeyShareGroups reads the groups of KeyShareEntry in key_share,
+// ignoring any malformed tail.
+func lintReadKeyShareGroups(data cryptobyte.String) []uint16 {
+	var shares cryptobyte.String
+	if !data.ReadUint16LengthPrefixed(&shares) {
+		return nil
+	}
+
+	var groups []uint16
+	for !shares.Empty() {
+		var group uint16
+		var keyExchange cryptobyte.String
+		if !shares.ReadUint16(&group) || !shares.ReadUint16LengthPrefixed(&keyExchange) {
+			break
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
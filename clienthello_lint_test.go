@@ -0,0 +1,207 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/exp/slices"
+)
+
+type lintExtension struct {
+	id   uint16
+	data []byte
+}
+
+// lintClientHello builds and parses a ClientHello with the given legacy
+// version, compression methods and extensions.
+func lintClientHello(t *testing.T, version uint16, compressionMethods []uint8, extensions []lintExtension) *ClientHello {
+	ch, err := UnmarshalClientHello(lintClientHelloRecord(version, compressionMethods, extensions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+// lintClientHelloRecord builds a TLS record carrying a ClientHello with the
+// given legacy version, compression methods and extensions.
+func lintClientHelloRecord(version uint16, compressionMethods []uint8, extensions []lintExtension) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(0x16) // handshake
+	b.AddUint16(0x0301)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddUint8(0x01) // ClientHello
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(version)
+			b.AddBytes(make([]byte, 32))                                                   // random
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(nil) })      // session id
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint16(0x1301) }) // cipher suites
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(compressionMethods) })
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				for _, ext := range extensions {
+					b.AddUint16(ext.id)
+					b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(ext.data) })
+				}
+			})
+		})
+	})
+	return b.BytesOrPanic()
+}
+
+func lintUint16List(lengthSize int, values ...uint16) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	add := func(b *cryptobyte.Builder) {
+		for _, v := range values {
+			b.AddUint16(v)
+		}
+	}
+	if lengthSize == 1 {
+		b.AddUint8LengthPrefixed(add)
+	} else {
+		b.AddUint16LengthPrefixed(add)
+	}
+	return b.BytesOrPanic()
+}
+
+func lintKeyShare(groups ...uint16) []byte {
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+		for _, group := range groups {
+			b.AddUint16(group)
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(make([]byte, 32)) })
+		}
+	})
+	return b.BytesOrPanic()
+}
+
+var lintPreSharedKey = []byte{
+	0x00, 0x0a, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04, 0x00, 0x00, 0x00, 0x00, // identities
+	0x00, 0x21, 0x20, // binders
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func TestClientHelloLint(t *testing.T) {
+	t.Run("Browsers", func(t *testing.T) {
+		firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chrome := uTLSClientHello(t, tls.HelloChrome_120, nil, 0x0301)
+		for _, ch := range []*ClientHello{firefox, chrome} {
+			if findings := ch.Lint(); len(findings) != 0 {
+				t.Errorf("no finding is expected, got %v", findings)
+			}
+		}
+	})
+
+	var (
+		supportedVersions = lintExtension{43, lintUint16List(1, 0x0304, 0x0303)}
+		supportedGroups   = lintExtension{10, lintUint16List(2, 0x0a0a, 0x001d)}
+		keyShare          = lintExtension{51, lintKeyShare(0x0a0a, 0x001d)}
+		signatureAlgos    = lintExtension{13, lintUint16List(2, 0x0403)}
+		pskModes          = lintExtension{45, []byte{0x01, 0x01}}
+		preSharedKey      = lintExtension{41, lintPreSharedKey}
+		earlyData         = lintExtension{42, nil}
+		grease            = lintExtension{0x1a1a, nil}
+		tls13             = []lintExtension{grease, supportedVersions, supportedGroups, keyShare, signatureAlgos, pskModes}
+	)
+
+	for _, tc := range []struct {
+		name       string
+		version    uint16
+		extensions []lintExtension
+		expected   []LintCode
+	}{
+		{"Valid", 0x0303, tls13, nil},
+		{"ValidPSK", 0x0303, append(slices.Clone(tls13), earlyData, preSharedKey), nil},
+		{"ValidTLS12", 0x0303, []lintExtension{supportedGroups, signatureAlgos}, nil},
+		{"DuplicateExtension", 0x0303, append(slices.Clone(tls13), signatureAlgos), []LintCode{LINT_DUPLICATE_EXTENSION}},
+		{"DuplicateGREASE", 0x0303, append(slices.Clone(tls13), grease), []LintCode{LINT_DUPLICATE_EXTENSION}},
+		{"PreSharedKeyNotLast", 0x0303, append([]lintExtension{preSharedKey}, tls13...), []LintCode{LINT_PRE_SHARED_KEY_NOT_LAST}},
+		{"PreSharedKeyWithoutModes", 0x0303, []lintExtension{supportedVersions, supportedGroups, keyShare, signatureAlgos, preSharedKey}, []LintCode{LINT_PRE_SHARED_KEY_WITHOUT_PSK_KE_MODES}},
+		{"EarlyDataWithoutPreSharedKey", 0x0303, append(slices.Clone(tls13), earlyData), []LintCode{LINT_EARLY_DATA_WITHOUT_PRE_SHARED_KEY}},
+		{
+			"KeyShareGroupNotOffered", 0x0303,
+			[]lintExtension{supportedVersions, supportedGroups, {51, lintKeyShare(0x0017)}, signatureAlgos},
+			[]LintCode{LINT_KEY_SHARE_GROUP_NOT_OFFERED},
+		},
+		{
+			"GREASEKeyShareNotOffered", 0x0303,
+			[]lintExtension{supportedVersions, supportedGroups, {51, lintKeyShare(0x2a2a, 0x001d)}, signatureAlgos},
+			[]LintCode{LINT_INVALID_GREASE},
+		},
+		{
+			"GREASECompressCertificate", 0x0303,
+			append(slices.Clone(tls13), lintExtension{27, lintUint16List(1, 0x3a3a, 0x0002)}),
+			[]LintCode{LINT_INVALID_GREASE},
+		},
+		{
+			"TLS13WithoutKeyShare", 0x0303,
+			[]lintExtension{supportedVersions, supportedGroups, signatureAlgos},
+			[]LintCode{LINT_TLS13_WITHOUT_KEY_SHARE},
+		},
+		{
+			"TLS13Bare", 0x0303,
+			[]lintExtension{supportedVersions},
+			[]LintCode{LINT_TLS13_WITHOUT_KEY_SHARE, LINT_TLS13_WITHOUT_SUPPORTED_GROUPS, LINT_TLS13_WITHOUT_SIGNATURE_ALGORITHMS},
+		},
+		{"LegacyVersion", 0x0304, tls13, []LintCode{LINT_LEGACY_VERSION}},
+		{"LegacyVersionWithoutSupportedVersions", 0x0304, []lintExtension{supportedGroups, signatureAlgos}, []LintCode{LINT_LEGACY_VERSION}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := lintClientHello(t, tc.version, []uint8{0}, tc.extensions)
+			var codes []LintCode
+			for _, finding := range ch.Lint() {
+				codes = append(codes, finding.Code)
+				if finding.Message == "" || finding.Reference == "" {
+					t.Errorf("finding is expected to have a message and a reference, got %+v", finding)
+				}
+			}
+			if !slices.Equal(codes, tc.expected) {
+				t.Errorf("findings mismatch, expecting %v, got %v", tc.expected, ch.Lint())
+			}
+		})
+	}
+
+	t.Run("DTLS", func(t *testing.T) {
+		dtls13 := []lintExtension{{43, lintUint16List(1, 0xfefc, 0xfefd)}, supportedGroups, keyShare, signatureAlgos}
+		for _, tc := range []struct {
+			name       string
+			version    uint16
+			extensions []lintExtension
+			expected   []LintCode
+		}{
+			{"ValidDTLS12", 0xfefd, []lintExtension{supportedGroups, signatureAlgos}, nil},
+			{"ValidDTLS10", 0xfeff, []lintExtension{supportedGroups, signatureAlgos}, nil},
+			{"ValidDTLS13", 0xfefd, dtls13, nil},
+			{"LegacyVersion", 0xfefc, dtls13, []LintCode{LINT_LEGACY_VERSION}},
+			{"LegacyVersionWithoutSupportedVersions", 0xfefc, []lintExtension{supportedGroups, signatureAlgos}, []LintCode{LINT_LEGACY_VERSION}},
+			{"DTLS13Bare", 0xfefd, dtls13[:1], []LintCode{LINT_TLS13_WITHOUT_KEY_SHARE, LINT_TLS13_WITHOUT_SUPPORTED_GROUPS, LINT_TLS13_WITHOUT_SIGNATURE_ALGORITHMS}},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				record := lintClientHelloRecord(tc.version, []uint8{0}, tc.extensions)
+				dch, err := UnmarshalDTLSClientHello(dtlsRecordsFromTLS(record, nil, 0, 1<<16)[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				var codes []LintCode
+				for _, finding := range dch.Lint() {
+					codes = append(codes, finding.Code)
+				}
+				if !slices.Equal(codes, tc.expected) {
+					t.Errorf("findings mismatch, expecting %v, got %v", tc.expected, dch.Lint())
+				}
+			})
+		}
+	})
+
+	t.Run("TLS13NonNullCompression", func(t *testing.T) {
+		ch := lintClientHello(t, 0x0303, []uint8{1, 0}, tls13)
+		findings := ch.Lint()
+		if len(findings) != 1 || findings[0].Code != LINT_TLS13_NON_NULL_COMPRESSION {
+			t.Errorf("findings mismatch, expecting %v, got %v", LINT_TLS13_NON_NULL_COMPRESSION, findings)
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package clienthellod
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+// SecurityFindingCode identifies a kind of weakness found in the offer of a
+// ClientHello.
+type SecurityFindingCode string
+
+// Codes of the findings reported by [ClientHello.GradeSecurity].
+const (
+	SECURITY_INSECURE_CIPHER_SUITE     SecurityFindingCode = "insecure_cipher_suite" // RC4, NULL, EXPORT, anonymous or single DES
+	SECURITY_LEGACY_CIPHER_SUITE       SecurityFindingCode = "legacy_cipher_suite"   // 3DES
+	SECURITY_CBC_ONLY                  SecurityFindingCode = "cbc_only"              // no AEAD cipher suite
+	SECURITY_NO_TLS13                  SecurityFindingCode = "no_tls13"
+	SECURITY_SHA1_SIGNATURE_ALGORITHM  SecurityFindingCode = "sha1_signature_algorithm"
+	SECURITY_NO_EXTENDED_MASTER_SECRET SecurityFindingCode = "no_extended_master_secret"
+	SECURITY_NO_SECURE_RENEGOTIATION   SecurityFindingCode = "no_secure_renegotiation"
+	SECURITY_NON_NULL_COMPRESSION      SecurityFindingCode = "non_null_compression"
+)
+
+// Severities of security findings.
+const (
+	SECURITY_SEVERITY_HIGH   = "high"
+	SECURITY_SEVERITY_MEDIUM = "medium"
+	SECURITY_SEVERITY_LOW    = "low"
+)
+
+// securityPenalties are the points deducted from the score of a ClientHello
+// for each kind of finding, and their severities.
+var securityPenalties = map[SecurityFindingCode]struct {
+	severity string
+	points   int
+}{
+	SECURITY_INSECURE_CIPHER_SUITE:     {SECURITY_SEVERITY_HIGH, 30},
+	SECURITY_NON_NULL_COMPRESSION:      {SECURITY_SEVERITY_HIGH, 30},
+	SECURITY_CBC_ONLY:                  {SECURITY_SEVERITY_HIGH, 20},
+	SECURITY_NO_TLS13:                  {SECURITY_SEVERITY_MEDIUM, 20},
+	SECURITY_LEGACY_CIPHER_SUITE:       {SECURITY_SEVERITY_MEDIUM, 10},
+	SECURITY_NO_EXTENDED_MASTER_SECRET: {SECURITY_SEVERITY_MEDIUM, 10},
+	SECURITY_NO_SECURE_RENEGOTIATION:   {SECURITY_SEVERITY_MEDIUM, 10},
+	SECURITY_SHA1_SIGNATURE_ALGORITHM:  {SECURITY_SEVERITY_LOW, 5}, // still offered by all major browsers for compatibility
+}
+
+// SecurityFinding is a weakness found in the offer of a ClientHello.
+type SecurityFinding struct {
+	Code     SecurityFindingCode `json:"code"`
+	Severity string              `json:"severity"` // e.g., SECURITY_SEVERITY_HIGH
+	Penalty  int                 `json:"penalty"`  // points deducted from the score
+	Message  string              `json:"message"`
+}
+
+// SecurityReport grades the offer of a ClientHello.
+type SecurityReport struct {
+	Score    int               `json:"score"` // from 0 to 100, 100 if no finding
+	Grade    string            `json:"grade"` // from "A" to "F", by score
+	Findings []SecurityFinding `json:"findings,omitempty"`
+}
+
+// GradeSecurity grades the security posture of the cipher suites, versions,
+// signature algorithms, extensions and compression methods offered in the
+// ClientHello. A weakness offered does not mean it will be negotiated, but
+// servers supporting it may be led to, and it is a tell of an outdated
+// client.
+//
+// Findings about TLS 1.2 and below, e.g., a missing extended_master_secret,
+// are not reported for a ClientHello offering TLS 1.3 only.
+func (ch *ClientHello) GradeSecurity() *SecurityReport { // skipcq: GO-R1005
+	report := &SecurityReport{}
+	add := func(code SecurityFindingCode, format string, args ...any) {
+		penalty := securityPenalties[code]
+		report.Findings = append(report.Findings, SecurityFinding{
+			Code:     code,
+			Severity: penalty.severity,
+			Penalty:  penalty.points,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	// cipher suites
+	var insecure, legacy []string
+	var cbc, aead int
+	for _, suite := range ch.CipherSuites {
+		if utils.IsGREASEUint16(suite) {
+			continue
+		}
+		name, ok := dicttls.DictCipherSuiteValueIndexed[suite]
+		if !ok || strings.HasSuffix(name, "_SCSV") {
+			continue
+		}
+		switch {
+		case strings.Contains(name, "_RC4_"), strings.Contains(name, "_NULL"),
+			strings.Contains(name, "_EXPORT"), strings.Contains(name, "_anon_"), strings.Contains(name, "_WITH_DES_"):
+			insecure = append(insecure, name)
+		case strings.Contains(name, "_3DES_"):
+			legacy = append(legacy, name)
+		}
+		switch {
+		case strings.Contains(name, "_GCM_"), strings.Contains(name, "_CCM"), strings.Contains(name, "_CHACHA20_POLY1305_"):
+			aead++
+		case strings.Contains(name, "_CBC_"):
+			cbc++
+		}
+	}
+	if len(insecure) > 0 {
+		add(SECURITY_INSECURE_CIPHER_SUITE, "insecure cipher suites are offered: %s", strings.Join(insecure, ", "))
+	}
+	if len(legacy) > 0 {
+		add(SECURITY_LEGACY_CIPHER_SUITE, "legacy 3DES cipher suites are offered: %s", strings.Join(legacy, ", "))
+	}
+	if cbc > 0 && aead == 0 {
+		add(SECURITY_CBC_ONLY, "only CBC cipher suites are offered, no AEAD cipher suite such as AES-GCM or ChaCha20-Poly1305")
+	}
+
+	// versions
+	tls13 := slices.Contains(ch.SupportedVersions, tls.VersionTLS13)
+	if !tls13 {
+		add(SECURITY_NO_TLS13, "TLS 1.3 is not offered")
+	}
+	tls12OrBelow := len(ch.SupportedVersions) == 0 || slices.ContainsFunc(ch.SupportedVersions, func(v uint16) bool {
+		return v <= tls.VersionTLS12
+	})
+
+	// signature algorithms
+	var sha1 []string
+	for _, scheme := range ch.SignatureSchemeList {
+		switch scheme {
+		case 0x0201, 0x0202, 0x0203: // rsa_pkcs1_sha1, dsa_sha1, ecdsa_sha1
+			sha1 = append(sha1, dicttls.DictSignatureSchemeValueIndexed[scheme])
+		}
+	}
+	if len(sha1) > 0 {
+		add(SECURITY_SHA1_SIGNATURE_ALGORITHM, "SHA-1 signature algorithms are offered: %s", strings.Join(sha1, ", "))
+	}
+
+	// extensions protecting TLS 1.2 and below
+	if tls12OrBelow {
+		if !ch.ExtendedMasterSecret {
+			add(SECURITY_NO_EXTENDED_MASTER_SECRET, "extended_master_secret is not sent, leaving TLS 1.2 and below open to triple handshake attacks")
+		}
+		if ch.RenegotiationInfo == nil && !slices.Contains(ch.CipherSuites, dicttls.TLS_EMPTY_RENEGOTIATION_INFO_SCSV) {
+			add(SECURITY_NO_SECURE_RENEGOTIATION, "neither renegotiation_info nor TLS_EMPTY_RENEGOTIATION_INFO_SCSV is sent, leaving TLS 1.2 and below open to renegotiation attacks")
+		}
+	}
+
+	// compression
+	if slices.ContainsFunc(ch.CompressionMethods, func(m uint8) bool { return m != 0 }) {
+		add(SECURITY_NON_NULL_COMPRESSION, "compression methods other than null are offered: %v, enabling CRIME attacks", []uint8(ch.CompressionMethods))
+	}
+
+	report.Score = 100
+	for _, finding := range report.Findings {
+		report.Score -= finding.Penalty
+	}
+	report.Score = max(report.Score, 0)
+	report.Grade = securityGrade(report.Score)
+	return report
+}
+
+// GradeSecurity grades the security posture of the ClientHello in the QUIC
+// Initial packets. See [ClientHello.GradeSecurity].
+func (qfp *QUICFingerprint) GradeSecurity() *SecurityReport {
+	if qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+		return nil
+	}
+	return qfp.ClientInitials.ClientHello.GradeSecurity()
+}
+
+func securityGrade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 65:
+		return "C"
+	case score >= 50:
+		return "D"
+	}
+	return "F"
+}
@@ -0,0 +1,66 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestClientHelloGradeSecurity(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy := &tls.ClientHelloSpec{
+		TLSVersMin: tls.VersionTLS10,
+		TLSVersMax: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_RSA_WITH_RC4_128_SHA,
+			tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		},
+		Extensions: []tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519}},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{tls.PKCS1WithSHA256, tls.PKCS1WithSHA1}},
+		},
+	}
+
+	for _, tc := range []struct {
+		name  string
+		ch    *ClientHello
+		score int
+		grade string
+		codes []SecurityFindingCode
+	}{
+		{"Firefox126", firefox, 95, "A", []SecurityFindingCode{SECURITY_SHA1_SIGNATURE_ALGORITHM}},
+		{"Chrome120", uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10), 100, "A", nil},
+		{"Chrome58", uTLSClientHello(t, tls.HelloChrome_58, nil, tls.VersionTLS10), 65, "C", []SecurityFindingCode{
+			SECURITY_LEGACY_CIPHER_SUITE, SECURITY_NO_TLS13, SECURITY_SHA1_SIGNATURE_ALGORITHM,
+		}},
+		{"Legacy", uTLSClientHello(t, tls.HelloCustom, legacy, tls.VersionTLS10), 0, "F", []SecurityFindingCode{
+			SECURITY_INSECURE_CIPHER_SUITE, SECURITY_LEGACY_CIPHER_SUITE, SECURITY_CBC_ONLY, SECURITY_NO_TLS13,
+			SECURITY_SHA1_SIGNATURE_ALGORITHM, SECURITY_NO_EXTENDED_MASTER_SECRET, SECURITY_NO_SECURE_RENEGOTIATION,
+		}},
+		{"Compression", lintClientHello(t, tls.VersionTLS12, []uint8{1, 0}, nil), 30, "F", []SecurityFindingCode{ // DEFLATE, null
+			SECURITY_NO_TLS13, SECURITY_NO_EXTENDED_MASTER_SECRET, SECURITY_NO_SECURE_RENEGOTIATION, SECURITY_NON_NULL_COMPRESSION,
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			report := tc.ch.GradeSecurity()
+			if report.Score != tc.score || report.Grade != tc.grade {
+				t.Errorf("score mismatch, expecting %d (%s), got %d (%s)", tc.score, tc.grade, report.Score, report.Grade)
+			}
+			if len(report.Findings) != len(tc.codes) {
+				t.Fatalf("findings mismatch, expecting %v, got %+v", tc.codes, report.Findings)
+			}
+			for i, code := range tc.codes {
+				if report.Findings[i].Code != code {
+					t.Errorf("finding #%d mismatch, expecting %s, got %+v", i, code, report.Findings[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package clienthellod
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	SSLV2_HEADER_LENGTH   = 2      // 2-byte record header, with the most significant bit set
+	SSLV2_CLIENT_HELLO    = 0x01   // msg_type of SSLv2 CLIENT-HELLO
+	SSLV2_RECORD_VERSION  = 0x0002 // pseudo TLS record version of an SSLv2-compatible ClientHello
+	SSLV2_CIPHER_SPEC_LEN = 3      // length of each SSLv2 cipher spec
+)
+
+// isSSLv2ClientHelloHeader reports whether the first 5 bytes read from a
+// connection are the beginning of an SSLv2-compatible ClientHello, i.e.,
+// a 2-byte SSLv2 record header followed by msg_type and version.
+func isSSLv2ClientHelloHeader(header []byte) bool {
+	return len(header) >= 3 && header[0]&0x80 != 0 && header[2] == SSLV2_CLIENT_HELLO
+}
+
+// readSSLv2ClientHello reads the rest of an SSLv2-compatible ClientHello
+// (RFC 6101 Appendix E.2, RFC 5246 Appendix E.2) whose first 5 bytes are
+// already read into ch.raw.
+func (ch *ClientHello) readSSLv2ClientHello(r io.Reader, maxSize int) error {
+	msgLen := int(binary.BigEndian.Uint16(ch.raw[:SSLV2_HEADER_LENGTH]) & 0x7fff)
+	if msgLen < 9 { // msg_type(1) || version(2) || cipher_spec_length(2) || session_id_length(2) || challenge_length(2)
+		return errors.New("SSLv2 ClientHello too short")
+	}
+	if msgLen > maxSize {
+		return fmt.Errorf("ClientHello exceeds the maximum size of %d bytes", maxSize)
+	}
+
+	read := len(ch.raw)
+	ch.raw = append(ch.raw, make([]byte, SSLV2_HEADER_LENGTH+msgLen-read)...)
+	n, err := io.ReadFull(r, ch.raw[read:])
+	ch.raw = ch.raw[:read+n]
+	if err != nil {
+		return err
+	}
+
+	ch.SSLv2 = true
+	ch.TLSRecordCount = 1
+	ch.TLSRecordLengths = []int{msgLen}
+	ch.handshake = ch.raw[SSLV2_HEADER_LENGTH:]
+	return nil
+}
+
+// parseSSLv2 parses the fingerprintable fields from an SSLv2-compatible
+// ClientHello and calculates the fingerprints.
+//
+// Cipher specs in the TLS range (0x00XXXX) are also listed in CipherSuites
+// and there are neither compression methods nor extensions.
+func (ch *ClientHello) parseSSLv2() error {
+	s := cryptobyte.String(ch.handshake)
+	var msgType uint8
+	var version, cipherSpecLength, sessionIDLength, challengeLength uint16
+	var cipherSpecs cryptobyte.String
+	if !s.ReadUint8(&msgType) ||
+		!s.ReadUint16(&version) ||
+		!s.ReadUint16(&cipherSpecLength) ||
+		!s.ReadUint16(&sessionIDLength) ||
+		!s.ReadUint16(&challengeLength) ||
+		!s.ReadBytes((*[]byte)(&cipherSpecs), int(cipherSpecLength)) ||
+		!s.Skip(int(sessionIDLength)) ||
+		!s.Skip(int(challengeLength)) {
+		return errors.New("failed to parse SSLv2 ClientHello, cryptobyte.String(): false")
+	}
+	if msgType != SSLV2_CLIENT_HELLO {
+		return errors.New("handshake message is not a ClientHello")
+	}
+	if cipherSpecLength%SSLV2_CIPHER_SPEC_LEN != 0 {
+		return errors.New("SSLv2 cipher specs length is not a multiple of 3")
+	}
+
+	ch.TLSRecordVersion = SSLV2_RECORD_VERSION
+	ch.TLSHandshakeVersion = version
+	ch.sessionIDLength = uint8(sessionIDLength)
+	ch.SSLv2ChallengeLength = int(challengeLength)
+
+	ch.SSLv2CipherSpecs = make([]uint32, 0, len(cipherSpecs)/SSLV2_CIPHER_SPEC_LEN)
+	ch.CipherSuites = make([]uint16, 0, len(cipherSpecs)/SSLV2_CIPHER_SPEC_LEN)
+	for !cipherSpecs.Empty() {
+		var cipherSpec uint32
+		if !cipherSpecs.ReadUint24(&cipherSpec) {
+			return errors.New("unable to read SSLv2 cipher spec")
+		}
+		ch.SSLv2CipherSpecs = append(ch.SSLv2CipherSpecs, cipherSpec)
+		if cipherSpec <= 0xffff { // TLS cipher suite
+			ch.CipherSuites = append(ch.CipherSuites, unGREASEUint16(uint16(cipherSpec)))
+		}
+	}
+
+	ch.ExtensionsNormalized = ch.normPolicy.normalizeExtensions(ch.Extensions)
+	ch.calcFingerprints()
+
+	return nil
+}
+
+// sslv2CipherSpecsBytes returns the SSLv2 cipher specs in wire format.
+func (ch *ClientHello) sslv2CipherSpecsBytes() []byte {
+	b := make([]byte, 0, len(ch.SSLv2CipherSpecs)*SSLV2_CIPHER_SPEC_LEN)
+	for _, cipherSpec := range ch.SSLv2CipherSpecs {
+		b = append(b, byte(cipherSpec>>16), byte(cipherSpec>>8), byte(cipherSpec))
+	}
+	return b
+}
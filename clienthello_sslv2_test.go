@@ -0,0 +1,111 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	"golang.org/x/exp/slices"
+)
+
+// sslv2ClientHello is an SSLv2-compatible ClientHello advertising TLS 1.0,
+// in the format sent by OpenSSL 0.9.8 with SSLv2 enabled.
+var sslv2ClientHello = []byte{
+	0x80, 0x2e, // SSLv2 record header, length 46
+	0x01,       // CLIENT-HELLO
+	0x03, 0x01, // TLS 1.0
+	0x00, 0x15, // cipher_spec_length: 21
+	0x00, 0x00, // session_id_length: 0
+	0x00, 0x10, // challenge_length: 16
+	0x00, 0x00, 0x39, // TLS_DHE_RSA_WITH_AES_256_CBC_SHA
+	0x00, 0x00, 0x35, // TLS_RSA_WITH_AES_256_CBC_SHA
+	0x07, 0x00, 0xc0, // SSL_CK_DES_192_EDE3_CBC_WITH_MD5
+	0x00, 0x00, 0x0a, // TLS_RSA_WITH_3DES_EDE_CBC_SHA
+	0x01, 0x00, 0x80, // SSL_CK_RC4_128_WITH_MD5
+	0x00, 0x00, 0x05, // TLS_RSA_WITH_RC4_128_SHA
+	0x00, 0x00, 0xff, // TLS_EMPTY_RENEGOTIATION_INFO_SCSV
+	0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, // challenge
+	0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff, 0x00,
+}
+
+func TestUnmarshalSSLv2ClientHello(t *testing.T) {
+	ch, err := UnmarshalClientHello(sslv2ClientHello)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ch.SSLv2 || ch.TLSRecordVersion != SSLV2_RECORD_VERSION || ch.TLSHandshakeVersion != 0x0301 {
+		t.Errorf("SSLv2 ClientHello mismatch, got sslv2 %v, record 0x%04x, handshake 0x%04x", ch.SSLv2, ch.TLSRecordVersion, ch.TLSHandshakeVersion)
+	}
+	if ch.TLSRecordCount != 1 || !slices.Equal(ch.TLSRecordLengths, []int{46}) {
+		t.Errorf("SSLv2 record mismatch, got %d records of %v", ch.TLSRecordCount, ch.TLSRecordLengths)
+	}
+	if !bytes.Equal(ch.Raw(), sslv2ClientHello) {
+		t.Errorf("raw bytes mismatch")
+	}
+
+	if !slices.Equal(ch.SSLv2CipherSpecs, []uint32{0x000039, 0x000035, 0x0700c0, 0x00000a, 0x010080, 0x000005, 0x0000ff}) {
+		t.Errorf("SSLv2 cipher specs mismatch, got %x", ch.SSLv2CipherSpecs)
+	}
+	if !slices.Equal(ch.CipherSuites, []uint16{0x0039, 0x0035, 0x000a, 0x0005, 0x00ff}) {
+		t.Errorf("cipher suites mismatch, got %x", ch.CipherSuites)
+	}
+	if ch.SSLv2ChallengeLength != 16 || len(ch.Extensions) != 0 {
+		t.Errorf("unexpected challenge length %d or extensions %v", ch.SSLv2ChallengeLength, ch.Extensions)
+	}
+
+	if ch.HexID == "" || ch.NormHexID == "" || ch.JA3Hash == "" {
+		t.Errorf("SSLv2 ClientHello is expected to be fingerprinted")
+	}
+	if !strings.HasPrefix(ch.JA4, "ts2i0500") {
+		t.Errorf("JA4 of SSLv2 ClientHello is expected to be marked with s2, got %s", ch.JA4)
+	}
+
+	t.Run("DistinctFromTLS", func(t *testing.T) {
+		// The same TLS cipher suites in a TLS 1.0 ClientHello without extensions
+		tlsCh, err := UnmarshalClientHello([]byte{
+			0x16, 0x03, 0x01, 0x00, 0x35, // TLS record
+			0x01, 0x00, 0x00, 0x31, // ClientHello
+			0x03, 0x01, // TLS 1.0
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // random
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00,       // session_id
+			0x00, 0x0a, // cipher_suites
+			0x00, 0x39, 0x00, 0x35, 0x00, 0x0a, 0x00, 0x05, 0x00, 0xff,
+			0x01, 0x00, // compression_methods: null
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tlsCh.SSLv2 {
+			t.Errorf("TLS ClientHello is not expected to be marked as SSLv2")
+		}
+		if tlsCh.HexID == "" || tlsCh.HexID == ch.HexID || tlsCh.JA4 == ch.JA4 {
+			t.Errorf("SSLv2 ClientHello is expected to be fingerprinted differently from TLS, got %s and %s", ch.JA4, tlsCh.JA4)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		ch, err := ReadClientHello(bytes.NewReader(sslv2ClientHello[:30]))
+		if err == nil {
+			t.Fatal("truncated SSLv2 ClientHello is expected to fail")
+		}
+		if !bytes.Equal(ch.Raw(), sslv2ClientHello[:30]) {
+			t.Errorf("all bytes read are expected to be kept, got %d bytes", len(ch.Raw()))
+		}
+	})
+
+	t.Run("TLSFingerprinter", func(t *testing.T) {
+		tfp := NewTLSFingerprinter()
+		defer tfp.Close()
+		if err := tfp.HandleMessage("legacy", sslv2ClientHello); err != nil {
+			t.Fatal(err)
+		}
+		if fch := tfp.Pop("legacy"); fch == nil || !fch.SSLv2 || fch.HexID != ch.HexID {
+			t.Errorf("SSLv2 ClientHello is expected to be handled by TLSFingerprinter, got %+v", fch)
+		}
+	})
+}
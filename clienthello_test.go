@@ -0,0 +1,231 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+// uTLSParsedClientHello parses the fields which used to be parsed by uTLS
+// (with (*tls.Fingerprinter).RawClientHello and tls.UnmarshalClientHello)
+// before the native parser is introduced, as the truth for the equivalence
+// test.
+func uTLSParsedClientHello(t *testing.T, raw []byte) *ClientHello {
+	fingerprinter := tls.Fingerprinter{
+		AllowBluntMimicry: true,
+	}
+	chs, err := fingerprinter.RawClientHello(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	truth := &ClientHello{
+		CipherSuites:       chs.CipherSuites,
+		CompressionMethods: chs.CompressionMethods,
+	}
+	for _, ext := range chs.Extensions {
+		switch ext := ext.(type) {
+		case *tls.SupportedCurvesExtension:
+			for _, curve := range ext.Curves {
+				truth.NamedGroupList = append(truth.NamedGroupList, uint16(curve))
+			}
+		case *tls.SupportedPointsExtension:
+			truth.ECPointFormatList = ext.SupportedPoints
+		case *tls.SignatureAlgorithmsExtension:
+			for _, sig := range ext.SupportedSignatureAlgorithms {
+				truth.SignatureSchemeList = append(truth.SignatureSchemeList, uint16(sig))
+			}
+		case *tls.ALPNExtension:
+			truth.ALPN = ext.AlpnProtocols
+		case *tls.UtlsCompressCertExtension:
+			for _, algo := range ext.Algorithms {
+				truth.CertCompressAlgo = append(truth.CertCompressAlgo, uint16(algo))
+			}
+		case *tls.FakeRecordSizeLimitExtension:
+			truth.RecordSizeLimit = append(truth.RecordSizeLimit, uint8(ext.Limit>>8), uint8(ext.Limit))
+		case *tls.SupportedVersionsExtension:
+			for _, ver := range ext.Versions {
+				truth.SupportedVersions = append(truth.SupportedVersions, uint16(ver))
+			}
+		case *tls.PSKKeyExchangeModesExtension:
+			truth.PSKKeyExchangeModes = ext.Modes
+		case *tls.KeyShareExtension:
+			for _, ks := range ext.KeyShares {
+				truth.KeyShare = append(truth.KeyShare, uint16(ks.Group))
+			}
+		case *tls.ApplicationSettingsExtension:
+			truth.ApplicationSettings = ext.SupportedProtocols
+		}
+	}
+
+	chm := tls.UnmarshalClientHello(raw[5:])
+	if chm == nil {
+		t.Fatal("tls.UnmarshalClientHello(): nil")
+	}
+	truth.ServerName = chm.ServerName
+
+	return truth
+}
+
+func TestParseClientHelloEquivalence(t *testing.T) {
+	records := map[string][]byte{
+		"Firefox126":           tlsClientHello_Firefox126,
+		"QUIC_Chrome124":       quicClientHelloRecord(quicClientHelloTruth_Chrome124),
+		"QUIC_Chrome125":       quicClientHelloRecord(gatheredClientHello(t, "Chrome125")),
+		"QUIC_Firefox126":      quicClientHelloRecord(gatheredClientHello(t, "Firefox126")),
+		"QUIC_Firefox126_0RTT": quicClientHelloRecord(gatheredClientHello(t, "Firefox126_0-RTT")),
+	}
+
+	for name, record := range records {
+		t.Run(name, func(t *testing.T) {
+			ch, err := UnmarshalClientHello(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			truth := uTLSParsedClientHello(t, record)
+
+			for field, pair := range map[string][2]any{
+				"CipherSuites":        {truth.CipherSuites, ch.CipherSuites},
+				"CompressionMethods":  {truth.CompressionMethods, ch.CompressionMethods},
+				"ServerName":          {truth.ServerName, ch.ServerName},
+				"NamedGroupList":      {truth.NamedGroupList, ch.NamedGroupList},
+				"ECPointFormatList":   {truth.ECPointFormatList, ch.ECPointFormatList},
+				"SignatureSchemeList": {truth.SignatureSchemeList, ch.SignatureSchemeList},
+				"ALPN":                {truth.ALPN, ch.ALPN},
+				"CertCompressAlgo":    {truth.CertCompressAlgo, ch.CertCompressAlgo},
+				"RecordSizeLimit":     {truth.RecordSizeLimit, ch.RecordSizeLimit},
+				"SupportedVersions":   {truth.SupportedVersions, ch.SupportedVersions},
+				"PSKKeyExchangeModes": {truth.PSKKeyExchangeModes, ch.PSKKeyExchangeModes},
+				"KeyShare":            {truth.KeyShare, ch.KeyShare},
+				"ApplicationSettings": {truth.ApplicationSettings, ch.ApplicationSettings},
+			} {
+				if !reflect.DeepEqual(pair[0], pair[1]) {
+					t.Errorf("%s mismatch, expecting %v, got %v", field, pair[0], pair[1])
+				}
+			}
+		})
+	}
+}
+
+// fragmentClientHello splits the ClientHello carried by a single TLS record
+// into consecutive TLS records of the given lengths, and the rest.
+func fragmentClientHello(record []byte, lengths ...int) []byte {
+	var records []byte
+	msg := record[5:]
+	for _, n := range append(lengths, len(msg)-sum(lengths)) {
+		records = append(records, 0x16, record[1], record[2], byte(n>>8), byte(n))
+		records = append(records, msg[:n]...)
+		msg = msg[n:]
+	}
+	return records
+}
+
+func sum(s []int) (total int) {
+	for _, v := range s {
+		total += v
+	}
+	return
+}
+
+func TestReadClientHelloFragmented(t *testing.T) {
+	truth, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truth.TLSRecordCount != 1 || !reflect.DeepEqual(truth.TLSRecordLengths, []int{len(tlsClientHello_Firefox126) - 5}) {
+		t.Fatalf("unexpected records of unfragmented ClientHello: %d %v", truth.TLSRecordCount, truth.TLSRecordLengths)
+	}
+
+	for name, lengths := range map[string][]int{
+		"SplitHeader":  {2, 100},     // handshake header split across records
+		"ThreeRecords": {256, 256},   // evenly fragmented
+		"TinyRecords":  {1, 1, 1, 1}, // one byte per record for the handshake header
+	} {
+		t.Run(name, func(t *testing.T) {
+			records := fragmentClientHello(tlsClientHello_Firefox126, lengths...)
+			ch, err := UnmarshalClientHello(records)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(ch.Raw(), records) {
+				t.Errorf("Raw() must return all TLS records read")
+			}
+			wantLengths := append(lengths, len(tlsClientHello_Firefox126)-5-sum(lengths))
+			if ch.TLSRecordCount != len(wantLengths) || !reflect.DeepEqual(ch.TLSRecordLengths, wantLengths) {
+				t.Errorf("records mismatch, expecting %v, got %d %v", wantLengths, ch.TLSRecordCount, ch.TLSRecordLengths)
+			}
+
+			if ch.HexID != truth.HexID || ch.NormHexID != truth.NormHexID || ch.JA4 != truth.JA4 || ch.ServerName != truth.ServerName {
+				t.Errorf("fragmented ClientHello mismatch, expecting %s/%s/%s, got %s/%s/%s",
+					truth.HexID, truth.NormHexID, truth.JA4, ch.HexID, ch.NormHexID, ch.JA4)
+			}
+		})
+	}
+
+	t.Run("MaxSize", func(t *testing.T) {
+		records := fragmentClientHello(tlsClientHello_Firefox126, 256)
+		if _, err := ReadClientHelloWithMaxSize(bytes.NewReader(records), 300); err == nil {
+			t.Errorf("ClientHello larger than the maximum size is expected to be rejected")
+		}
+		if _, err := ReadClientHelloWithMaxSize(bytes.NewReader(records), len(records)); err != nil {
+			t.Errorf("ClientHello within the maximum size is expected to be read, got %v", err)
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		records := fragmentClientHello(tlsClientHello_Firefox126, 256)
+		if _, err := ReadClientHello(bytes.NewReader(records[:300])); err == nil {
+			t.Errorf("truncated ClientHello is expected to be rejected")
+		}
+	})
+}
+
+// quicClientHelloRecord wraps a QUIC ClientHello (handshake message) into a
+// TLS record as done by ParseQUICClientHello.
+func quicClientHelloRecord(p []byte) []byte {
+	return append([]byte{0x16, 0x00, 0x00, byte(len(p) >> 8), byte(len(p))}, p...)
+}
+
+func gatheredClientHello(t *testing.T, name string) []byte {
+	return parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials[name], NormalizationPolicy{}).Raw()[5:]
+}
+
+func BenchmarkParseClientHello(b *testing.B) {
+	b.Run("Native", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			ch, err := ReadClientHello(bytes.NewReader(tlsClientHello_Firefox126))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err = ch.ParseClientHello(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	// baseline: the same read followed by the uTLS passes the native parser
+	// replaced, which also leave the fields and fingerprints uncalculated
+	b.Run("uTLS", func(b *testing.B) {
+		b.ReportAllocs()
+		fingerprinter := tls.Fingerprinter{
+			AllowBluntMimicry: true,
+		}
+		for i := 0; i < b.N; i++ {
+			ch, err := ReadClientHello(bytes.NewReader(tlsClientHello_Firefox126))
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err = fingerprinter.RawClientHello(ch.Raw()); err != nil {
+				b.Fatal(err)
+			}
+			if tls.UnmarshalClientHello(ch.Raw()[5:]) == nil {
+				b.Fatal("tls.UnmarshalClientHello(): nil")
+			}
+		}
+	})
+}
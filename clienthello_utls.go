@@ -0,0 +1,220 @@
+package clienthellod
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// ClientHelloSpec re-encodes the ClientHello into a uTLS ClientHelloSpec,
+// which can be applied to a uTLS client with [tls.UConn.ApplyPreset] to
+// replay the captured ClientHello.
+//
+// GREASE values, padding, application_settings and the groups in key_share
+// are kept as observed. Unknown extensions are kept as-is with their payload.
+// Key shares, the pre_shared_key and the encrypted_client_hello payload are
+// regenerated by uTLS on every handshake.
+func (ch *ClientHello) ClientHelloSpec() (*tls.ClientHelloSpec, error) {
+	if ch.SSLv2 {
+		return nil, errors.New("SSLv2-compatible ClientHello can't be re-encoded into a ClientHelloSpec")
+	}
+	if len(ch.handshake) == 0 {
+		return nil, errors.New("ClientHello not read")
+	}
+
+	// uTLS expects a single TLS record, even if the ClientHello was fragmented
+	if len(ch.handshake) > 0xffff {
+		return nil, fmt.Errorf("ClientHello of %d bytes exceeds the maximum size of a TLS record", len(ch.handshake))
+	}
+	record := make([]byte, 5, 5+len(ch.handshake))
+	record[0] = 0x16
+	binary.BigEndian.PutUint16(record[1:3], ch.TLSRecordVersion)
+	binary.BigEndian.PutUint16(record[3:5], uint16(len(ch.handshake)))
+	record = append(record, ch.handshake...)
+
+	f := &tls.Fingerprinter{AllowBluntMimicry: true}
+	return f.RawClientHello(record)
+}
+
+// ClientHelloSpecJSON encodes the parsed ClientHello into the JSON format of
+// uTLS ClientHelloSpec, which can be loaded with
+// [tls.Fingerprinter.UnmarshalJSONClientHello].
+//
+// The JSON format of uTLS is not able to express every extension (e.g.,
+// encrypted_client_hello and quic_transport_parameters). Such extensions are
+// omitted from the JSON and their IDs are returned in omitted. An error is
+// returned if any cipher suite, group, signature scheme, etc. has no name
+// known to uTLS.
+func (ch *ClientHello) ClientHelloSpecJSON() (b []byte, omitted []uint16, err error) {
+	if ch.SSLv2 {
+		return nil, nil, errors.New("SSLv2-compatible ClientHello can't be re-encoded into a ClientHelloSpec")
+	}
+
+	spec := utlsClientHelloSpecJSON{
+		Extensions: []map[string]any{},
+	}
+	if spec.CipherSuites, err = utlsJSONNames(ch.CipherSuites, dicttls.DictCipherSuiteValueIndexed, "cipher suite"); err != nil {
+		return nil, nil, err
+	}
+	if spec.CompressionMethods, err = utlsJSONNames(ch.CompressionMethods, dicttls.DictCompMethValueIndexed, "compression method"); err != nil {
+		return nil, nil, err
+	}
+
+	for _, extensionID := range ch.Extensions {
+		ext, err := ch.utlsExtensionJSON(extensionID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if ext == nil {
+			omitted = append(omitted, extensionID)
+			continue
+		}
+		spec.Extensions = append(spec.Extensions, ext)
+	}
+
+	b, err = json.Marshal(spec)
+	return b, omitted, err
+}
+
+// utlsClientHelloSpecJSON is the JSON format accepted by
+// [tls.ClientHelloSpecJSONUnmarshaler].
+type utlsClientHelloSpecJSON struct {
+	CipherSuites       []string         `json:"cipher_suites"`
+	CompressionMethods []string         `json:"compression_methods"`
+	Extensions         []map[string]any `json:"extensions"`
+}
+
+// utlsExtensionJSON returns the JSON object of an extension in the format of
+// uTLS, or nil if the extension can't be expressed in the format.
+func (ch *ClientHello) utlsExtensionJSON(extensionID uint16) (map[string]any, error) { // skipcq: GO-R1005
+	if utils.IsGREASEUint16(extensionID) {
+		return map[string]any{"name": "GREASE"}, nil
+	}
+
+	name, ok := dicttls.DictExtTypeValueIndexed[extensionID]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := tls.ExtensionFromID(extensionID).(tls.TLSExtensionJSON); !ok {
+		return nil, nil
+	}
+
+	ext := map[string]any{"name": name}
+	var err error
+	switch extensionID {
+	case dicttls.ExtType_supported_groups:
+		ext["named_group_list"], err = utlsJSONNames(ch.NamedGroupList, dicttls.DictSupportedGroupsValueIndexed, "supported group")
+	case dicttls.ExtType_ec_point_formats:
+		ext["ec_point_format_list"], err = utlsJSONNames(ch.ECPointFormatList, dicttls.DictECPointFormatValueIndexed, "ec point format")
+	case dicttls.ExtType_signature_algorithms:
+		ext["supported_signature_algorithms"], err = utlsJSONNames(ch.SignatureSchemeList, dicttls.DictSignatureSchemeValueIndexed, "signature scheme")
+	case dicttls.ExtType_delegated_credentials:
+		ext["supported_signature_algorithms"], err = utlsJSONNames(ch.DelegatedCredentials, dicttls.DictSignatureSchemeValueIndexed, "signature scheme")
+	case dicttls.ExtType_application_layer_protocol_negotiation:
+		ext["protocol_name_list"] = ch.ALPN
+	case dicttls.ExtType_application_settings:
+		ext["supported_protocols"] = ch.ApplicationSettings
+	case dicttls.ExtType_compress_certificate:
+		ext["algorithms"], err = utlsJSONNames(ch.CertCompressAlgo, dicttls.DictCertificateCompressionAlgorithmValueIndexed, "certificate compression algorithm")
+	case dicttls.ExtType_record_size_limit:
+		if len(ch.RecordSizeLimit) == 2 {
+			ext["record_size_limit"] = binary.BigEndian.Uint16(ch.RecordSizeLimit)
+		}
+	case dicttls.ExtType_supported_versions:
+		ext["versions"], err = utlsJSONVersions(ch.SupportedVersions)
+	case dicttls.ExtType_psk_key_exchange_modes:
+		ext["ke_modes"], err = utlsJSONNames(ch.PSKKeyExchangeModes, dicttls.DictPSKKeyExchangeModeValueIndexed, "psk key exchange mode")
+	case dicttls.ExtType_key_share:
+		ext["client_shares"], err = ch.utlsJSONKeyShares()
+	case dicttls.ExtType_padding:
+		ext["len"] = 0 // BoringSSL padding style
+	case dicttls.ExtType_pre_shared_key:
+		if ch.PreSharedKey != nil { // dummy identities and binders of the observed lengths
+			identities := make([]tls.PskIdentity, 0, ch.PreSharedKey.IdentityCount)
+			for i, length := range ch.PreSharedKey.IdentityLengths {
+				identities = append(identities, tls.PskIdentity{
+					Label:               make([]byte, length),
+					ObfuscatedTicketAge: ch.PreSharedKey.ObfuscatedTicketAges[i],
+				})
+			}
+			binders := make([][]byte, 0, len(ch.PreSharedKey.BinderLengths))
+			for _, length := range ch.PreSharedKey.BinderLengths {
+				binders = append(binders, make([]byte, length))
+			}
+			ext["identities"] = identities
+			ext["binders"] = binders
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return ext, nil
+}
+
+// utlsJSONKeyShares returns the client_shares of key_share in the JSON format
+// of uTLS. Only GREASE key shares carry key_exchange (zeros of the observed
+// length), the others are generated by uTLS.
+func (ch *ClientHello) utlsJSONKeyShares() ([]map[string]any, error) {
+	shares := make([]map[string]any, 0, len(ch.keyshareGroupsWithLengths)/2)
+	for i := 0; i+1 < len(ch.keyshareGroupsWithLengths); i += 2 {
+		group, length := ch.keyshareGroupsWithLengths[i], ch.keyshareGroupsWithLengths[i+1]
+		if utils.IsGREASEUint16(group) {
+			shares = append(shares, map[string]any{"group": "GREASE", "key_exchange": make([]int, length)})
+			continue
+		}
+
+		name, ok := dicttls.DictSupportedGroupsValueIndexed[group]
+		if !ok {
+			return nil, fmt.Errorf("key share group 0x%04x has no name known to uTLS", group)
+		}
+		shares = append(shares, map[string]any{"group": name})
+	}
+	return shares, nil
+}
+
+// utlsJSONVersions returns the supported_versions in the JSON format of uTLS.
+func utlsJSONVersions(versions []uint16) ([]string, error) {
+	names := make([]string, 0, len(versions))
+	for _, version := range versions {
+		switch {
+		case utils.IsGREASEUint16(version):
+			names = append(names, "GREASE")
+		case version == tls.VersionTLS13:
+			names = append(names, "TLS 1.3")
+		case version == tls.VersionTLS12:
+			names = append(names, "TLS 1.2")
+		case version == tls.VersionTLS11:
+			names = append(names, "TLS 1.1")
+		case version == tls.VersionTLS10:
+			names = append(names, "TLS 1.0")
+		default:
+			return nil, fmt.Errorf("version 0x%04x has no name known to uTLS", version)
+		}
+	}
+	return names, nil
+}
+
+// utlsJSONNames looks up the names of values in a dicttls dictionary, with
+// GREASE values named "GREASE".
+func utlsJSONNames[T uint8 | uint16](values []T, dict map[T]string, what string) ([]string, error) {
+	names := make([]string, 0, len(values))
+	for _, v := range values {
+		if utils.IsGREASEUint16(uint16(v)) {
+			names = append(names, "GREASE")
+			continue
+		}
+
+		name, ok := dict[v]
+		if !ok {
+			return nil, fmt.Errorf("%s 0x%x has no name known to uTLS", what, v)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,139 @@
+package clienthellod_test
+
+import (
+	"net"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/exp/slices"
+)
+
+// uTLSClientHello builds a ClientHello with a uTLS client applying the given
+// ClientHelloSpec (or ClientHelloID if spec is nil) and parses it back, with
+// the TLS record version of the record set to recordVersion.
+func uTLSClientHello(t *testing.T, id tls.ClientHelloID, spec *tls.ClientHelloSpec, recordVersion uint16) *ClientHello {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	uconn := tls.UClient(c, &tls.Config{ServerName: "example.com"}, id)
+	if spec != nil {
+		if err := uconn.ApplyPreset(spec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		t.Fatal(err)
+	}
+
+	handshake := uconn.HandshakeState.Hello.Raw
+	record := append([]byte{0x16, byte(recordVersion >> 8), byte(recordVersion), byte(len(handshake) >> 8), byte(len(handshake))}, handshake...)
+	ch, err := UnmarshalClientHello(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestClientHelloSpec(t *testing.T) {
+	chrome := uTLSClientHello(t, tls.HelloChrome_102, nil, 0x0301) // GREASE, padding and ALPS
+	if !slices.Contains(chrome.Extensions, 21) || !slices.Contains(chrome.Extensions, 17513) {
+		t.Fatalf("padding and application_settings are expected in Chrome 102, got %v", chrome.Extensions)
+	}
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		ch      *ClientHello
+		omitted []uint16 // extensions not expressible in the JSON format of uTLS
+	}{
+		{"Chrome102", chrome, nil},
+		{"Firefox126", firefox, []uint16{EXTENSION_ENCRYPTED_CLIENT_HELLO}},
+	} {
+		ch := tc.ch
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := ch.ClientHelloSpec()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replayed := uTLSClientHello(t, tls.HelloCustom, spec, ch.TLSRecordVersion)
+			if replayed.NormHexID != ch.NormHexID {
+				t.Errorf("NormHexID mismatch after round trip, expecting %s, got %s", ch.NormHexID, replayed.NormHexID)
+			}
+			if replayed.JA4 != ch.JA4 {
+				t.Errorf("JA4 mismatch after round trip, expecting %s, got %s", ch.JA4, replayed.JA4)
+			}
+		})
+
+		t.Run(tc.name+"_JSON", func(t *testing.T) {
+			b, omitted, err := ch.ClientHelloSpecJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(omitted, tc.omitted) {
+				t.Errorf("omitted extensions mismatch, expecting %v, got %v", tc.omitted, omitted)
+			}
+
+			f := &tls.Fingerprinter{}
+			spec, err := f.UnmarshalJSONClientHello(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replayed := uTLSClientHello(t, tls.HelloCustom, spec, ch.TLSRecordVersion)
+			expectedExtensions := slices.DeleteFunc(slices.Clone(ch.Extensions), func(ext uint16) bool {
+				return slices.Contains(omitted, ext)
+			})
+			if !slices.Equal(replayed.Extensions, expectedExtensions) {
+				t.Errorf("extensions mismatch after JSON round trip, expecting %v, got %v", expectedExtensions, replayed.Extensions)
+			}
+			if !slices.Equal(replayed.CipherSuites, ch.CipherSuites) ||
+				!slices.Equal(replayed.NamedGroupList, ch.NamedGroupList) ||
+				!slices.Equal(replayed.KeyShare, ch.KeyShare) ||
+				!slices.Equal(replayed.ApplicationSettings, ch.ApplicationSettings) {
+				t.Errorf("ClientHello mismatch after JSON round trip, expecting %+v, got %+v", ch, replayed)
+			}
+		})
+	}
+
+	t.Run("SSLv2", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(sslv2ClientHello)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ch.ClientHelloSpec(); err == nil {
+			t.Error("SSLv2-compatible ClientHello is not expected to be re-encoded")
+		}
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		b := cryptobyte.NewBuilder(nil)
+		b.AddUint8(0x01) // ClientHello
+		b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+			b.AddUint16(tls.VersionTLS12)
+			b.AddBytes(make([]byte, 32))                                                   // random
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) {})                       // session id
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint16(0x1301) }) // cipher suites
+			b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddUint8(0) })        // compression methods
+			b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) {
+				b.AddUint16(21) // padding to the maximum size of a ClientHello
+				b.AddUint16LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(make([]byte, DEFAULT_CLIENTHELLO_MAX_SIZE-47)) })
+			})
+		})
+		record := append([]byte{0x16, 0x03, 0x01, 0x00, 0x00}, b.BytesOrPanic()...)
+
+		ch, err := UnmarshalClientHello(fragmentClientHello(record, 1<<14, 1<<14, 1<<14, 1<<14))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ch.ClientHelloSpec(); err == nil {
+			t.Error("ClientHello exceeding a TLS record is not expected to be re-encoded")
+		}
+	})
+}
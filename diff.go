@@ -0,0 +1,336 @@
+package clienthellod
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	"golang.org/x/exp/slices"
+)
+
+// FingerprintDiff is the field-by-field difference from one fingerprint (a)
+// to another (b), e.g., before and after a browser update.
+type FingerprintDiff struct {
+	Fields []FieldDiff `json:"fields,omitempty"` // only fields with differences, in a fixed order
+}
+
+// FieldDiff is the difference of a single field.
+//
+// For list fields (e.g., cipher_suites), Added and Removed are the values
+// only in b and only in a respectively, and Reordered is set if the values
+// in both are in different orders. For other fields, From and To are the
+// values in a and b, empty if the field is absent.
+type FieldDiff struct {
+	Field     string   `json:"field"`
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Reordered bool     `json:"reordered,omitempty"`
+	From      string   `json:"from,omitempty"`
+	To        string   `json:"to,omitempty"`
+}
+
+// Equal reports whether no difference is found.
+func (d *FingerprintDiff) Equal() bool {
+	return len(d.Fields) == 0
+}
+
+// Field returns the difference of the named field, or nil if the field is
+// not different.
+func (d *FingerprintDiff) Field(field string) *FieldDiff {
+	for i := range d.Fields {
+		if d.Fields[i].Field == field {
+			return &d.Fields[i]
+		}
+	}
+	return nil
+}
+
+// String renders the difference as text, one field per line, e.g.,
+//
+//	cipher_suites: +0x1301 -0x002f (reordered)
+//	tls_record_version: 0x0301 -> 0x0303
+func (d *FingerprintDiff) String() string {
+	var sb strings.Builder
+	for i, f := range d.Fields {
+		if i > 0 {
+			sb.WriteByte('\n')
+		}
+		sb.WriteString(f.String())
+	}
+	return sb.String()
+}
+
+// String renders the difference of the field as a single line of text.
+func (f FieldDiff) String() string {
+	var parts []string
+	for _, v := range f.Added {
+		parts = append(parts, "+"+v)
+	}
+	for _, v := range f.Removed {
+		parts = append(parts, "-"+v)
+	}
+	if f.Reordered {
+		parts = append(parts, "(reordered)")
+	}
+	if len(parts) == 0 {
+		from, to := f.From, f.To
+		if from == "" {
+			from = "none"
+		}
+		if to == "" {
+			to = "none"
+		}
+		parts = append(parts, from+" -> "+to)
+	}
+	return f.Field + ": " + strings.Join(parts, " ")
+}
+
+// diffList records the difference of a list field, if any.
+func diffList[T comparable](d *FingerprintDiff, field string, a, b []T, format func(T) string) {
+	added, removed, reordered := diffValues(a, b, format)
+	if len(added) == 0 && len(removed) == 0 && !reordered {
+		return
+	}
+	d.Fields = append(d.Fields, FieldDiff{
+		Field:     field,
+		Added:     added,
+		Removed:   removed,
+		Reordered: reordered,
+	})
+}
+
+// value records the difference of a non-list field, if any.
+func (d *FingerprintDiff) value(field, from, to string) {
+	if from == to {
+		return
+	}
+	d.Fields = append(d.Fields, FieldDiff{
+		Field: field,
+		From:  from,
+		To:    to,
+	})
+}
+
+// merge records the differences of a nested fingerprint, with the field
+// names prefixed.
+func (d *FingerprintDiff) merge(prefix string, nested *FingerprintDiff) {
+	for _, f := range nested.Fields {
+		f.Field = prefix + "." + f.Field
+		d.Fields = append(d.Fields, f)
+	}
+}
+
+// Diff compares two ClientHellos field by field, reporting the changes from
+// a to b. Transport parameters of QUIC ClientHellos are not compared, see
+// [DiffQUICTransportParameters].
+//
+// Both ClientHellos are expected to be parsed. GREASE values are compared
+// as the placeholder they are replaced with.
+func Diff(a, b *ClientHello) *FingerprintDiff { // skipcq: GO-R1005
+	if a == nil {
+		a = &ClientHello{}
+	}
+	if b == nil {
+		b = &ClientHello{}
+	}
+	d := &FingerprintDiff{}
+
+	d.value("tls_record_version", diffHex16(a.TLSRecordVersion), diffHex16(b.TLSRecordVersion))
+	d.value("tls_handshake_version", diffHex16(a.TLSHandshakeVersion), diffHex16(b.TLSHandshakeVersion))
+	d.value("tls_record_count", strconv.Itoa(a.TLSRecordCount), strconv.Itoa(b.TLSRecordCount))
+	d.value("sslv2", diffBool(a.SSLv2), diffBool(b.SSLv2))
+	diffList(d, "sslv2_cipher_specs", a.SSLv2CipherSpecs, b.SSLv2CipherSpecs, func(v uint32) string { return fmt.Sprintf("0x%06x", v) })
+	d.value("session_id_length", strconv.Itoa(int(a.sessionIDLength)), strconv.Itoa(int(b.sessionIDLength)))
+
+	diffList(d, "cipher_suites", a.CipherSuites, b.CipherSuites, diffHex16)
+	diffList(d, "compression_methods", a.CompressionMethods, b.CompressionMethods, diffHex8)
+	diffList(d, "extensions", a.Extensions, b.Extensions, diffHex16)
+
+	d.value("server_name", a.ServerName, b.ServerName)
+	diffList(d, "supported_groups", a.NamedGroupList, b.NamedGroupList, diffHex16)
+	diffList(d, "ec_point_formats", a.ECPointFormatList, b.ECPointFormatList, diffHex8)
+	diffList(d, "signature_algorithms", a.SignatureSchemeList, b.SignatureSchemeList, diffHex16)
+	diffList(d, "alpn", a.ALPN, b.ALPN, strconv.Quote)
+	diffList(d, "compress_certificate", a.CertCompressAlgo, b.CertCompressAlgo, diffHex16)
+	d.value("record_size_limit", diffHexBytes(a.RecordSizeLimit), diffHexBytes(b.RecordSizeLimit))
+	diffList(d, "supported_versions", a.SupportedVersions, b.SupportedVersions, diffHex16)
+	diffList(d, "psk_key_exchange_modes", a.PSKKeyExchangeModes, b.PSKKeyExchangeModes, diffHex8)
+	diffList(d, "key_share", a.KeyShare, b.KeyShare, diffHex16)
+	diffList(d, "application_settings", a.ApplicationSettings, b.ApplicationSettings, strconv.Quote)
+	diffList(d, "delegated_credentials", a.DelegatedCredentials, b.DelegatedCredentials, diffHex16)
+
+	d.value("status_request", diffBool(a.StatusRequest != nil), diffBool(b.StatusRequest != nil))
+	d.value("signed_certificate_timestamp", diffBool(a.SignedCertificateTimestamp), diffBool(b.SignedCertificateTimestamp))
+	d.value("padding_length", strconv.Itoa(a.PaddingLength), strconv.Itoa(b.PaddingLength))
+	d.value("encrypt_then_mac", diffBool(a.EncryptThenMAC), diffBool(b.EncryptThenMAC))
+	d.value("extended_master_secret", diffBool(a.ExtendedMasterSecret), diffBool(b.ExtendedMasterSecret))
+	d.value("session_ticket", diffBool(a.SessionTicket != nil), diffBool(b.SessionTicket != nil))
+	d.value("pre_shared_key", diffBool(a.PreSharedKey != nil), diffBool(b.PreSharedKey != nil))
+	d.value("early_data", diffBool(a.EarlyData), diffBool(b.EarlyData))
+	d.value("cookie_length", strconv.Itoa(a.CookieLength), strconv.Itoa(b.CookieLength))
+	d.value("post_handshake_auth", diffBool(a.PostHandshakeAuth), diffBool(b.PostHandshakeAuth))
+	d.value("encrypted_client_hello", diffBool(a.EncryptedClientHello != nil), diffBool(b.EncryptedClientHello != nil))
+	d.value("renegotiation_info", diffBool(a.RenegotiationInfo != nil), diffBool(b.RenegotiationInfo != nil))
+
+	d.value("hex_id", a.HexID, b.HexID)
+	d.value("norm_hex_id", a.NormHexID, b.NormHexID)
+	d.value("ja3_hash", a.JA3Hash, b.JA3Hash)
+	d.value("ja4", a.JA4, b.JA4)
+
+	return d
+}
+
+// DiffQUICTransportParameters compares two QUIC transport parameters
+// combinations field by field, reporting the changes from a to b.
+func DiffQUICTransportParameters(a, b *QUICTransportParameters) *FingerprintDiff {
+	if a == nil {
+		a = &QUICTransportParameters{}
+	}
+	if b == nil {
+		b = &QUICTransportParameters{}
+	}
+	d := &FingerprintDiff{}
+
+	diffList(d, "tpids", a.QTPIDs, b.QTPIDs, func(v uint64) string { return fmt.Sprintf("0x%x", v) })
+	d.value("max_idle_timeout", diffHexBytes(a.MaxIdleTimeout), diffHexBytes(b.MaxIdleTimeout))
+	d.value("max_udp_payload_size", diffHexBytes(a.MaxUDPPayloadSize), diffHexBytes(b.MaxUDPPayloadSize))
+	d.value("initial_max_data", diffHexBytes(a.InitialMaxData), diffHexBytes(b.InitialMaxData))
+	d.value("initial_max_stream_data_bidi_local", diffHexBytes(a.InitialMaxStreamDataBidiLocal), diffHexBytes(b.InitialMaxStreamDataBidiLocal))
+	d.value("initial_max_stream_data_bidi_remote", diffHexBytes(a.InitialMaxStreamDataBidiRemote), diffHexBytes(b.InitialMaxStreamDataBidiRemote))
+	d.value("initial_max_stream_data_uni", diffHexBytes(a.InitialMaxStreamDataUni), diffHexBytes(b.InitialMaxStreamDataUni))
+	d.value("initial_max_streams_bidi", diffHexBytes(a.InitialMaxStreamsBidi), diffHexBytes(b.InitialMaxStreamsBidi))
+	d.value("initial_max_streams_uni", diffHexBytes(a.InitialMaxStreamsUni), diffHexBytes(b.InitialMaxStreamsUni))
+	d.value("ack_delay_exponent", diffHexBytes(a.AckDelayExponent), diffHexBytes(b.AckDelayExponent))
+	d.value("max_ack_delay", diffHexBytes(a.MaxAckDelay), diffHexBytes(b.MaxAckDelay))
+	d.value("active_connection_id_limit", diffHexBytes(a.ActiveConnectionIDLimit), diffHexBytes(b.ActiveConnectionIDLimit))
+	d.value("hex_id", a.HexID, b.HexID)
+
+	return d
+}
+
+// DiffQUICFingerprint compares two QUIC fingerprints field by field,
+// reporting the changes from a to b. The differences of the Client Initial
+// packets, the ClientHello and the transport parameters are prefixed with
+// "client_initials.", "client_hello." and "transport_parameters." respectively.
+func DiffQUICFingerprint(a, b *QUICFingerprint) *FingerprintDiff {
+	gciA, gciB := &GatheredClientInitials{}, &GatheredClientInitials{}
+	if a != nil && a.ClientInitials != nil {
+		gciA = a.ClientInitials
+	}
+	if b != nil && b.ClientInitials != nil {
+		gciB = b.ClientInitials
+	}
+	d := &FingerprintDiff{}
+
+	d.merge("client_initials", diffGatheredClientInitials(gciA, gciB))
+
+	var chA, chB *ClientHello
+	if gciA.ClientHello != nil {
+		chA = &gciA.ClientHello.ClientHello
+	}
+	if gciB.ClientHello != nil {
+		chB = &gciB.ClientHello.ClientHello
+	}
+	d.merge("client_hello", Diff(chA, chB))
+	d.merge("transport_parameters", DiffQUICTransportParameters(gciA.TransportParameters, gciB.TransportParameters))
+
+	var hexIDA, hexIDB string
+	if a != nil {
+		hexIDA = a.HexID
+	}
+	if b != nil {
+		hexIDB = b.HexID
+	}
+	d.value("hex_id", hexIDA, hexIDB)
+
+	return d
+}
+
+// diffGatheredClientInitials compares the fingerprintable fields of two
+// gathered Client Initial packets, i.e., the header of the first packet and
+// the frame types in all packets.
+func diffGatheredClientInitials(a, b *GatheredClientInitials) *FingerprintDiff {
+	d := &FingerprintDiff{}
+
+	hdrA, hdrB := &QUICHeader{}, &QUICHeader{}
+	if len(a.Packets) > 0 && a.Packets[0].Header != nil {
+		hdrA = a.Packets[0].Header
+	}
+	if len(b.Packets) > 0 && b.Packets[0].Header != nil {
+		hdrB = b.Packets[0].Header
+	}
+	d.value("version", diffHexBytes(hdrA.Version), diffHexBytes(hdrB.Version))
+	d.value("dest_conn_id_len", strconv.Itoa(int(hdrA.DCIDLength)), strconv.Itoa(int(hdrB.DCIDLength)))
+	d.value("source_conn_id_len", strconv.Itoa(int(hdrA.SCIDLength)), strconv.Itoa(int(hdrB.SCIDLength)))
+	d.value("packet_number", diffHexBytes(hdrA.PacketNumber), diffHexBytes(hdrB.PacketNumber))
+	d.value("token", diffBool(hdrA.HasToken), diffBool(hdrB.HasToken))
+	d.value("packet_count", strconv.Itoa(len(a.Packets)), strconv.Itoa(len(b.Packets)))
+
+	// frames are compared as the deduplicated and sorted set, same as the fingerprint
+	frameTypes := func(gci *GatheredClientInitials) []uint8 {
+		var all []uint8
+		for _, p := range gci.Packets {
+			all = append(all, p.frames.FrameTypesUint8()...)
+		}
+		return utils.DedupIntArr(all)
+	}
+	diffList(d, "frames", frameTypes(a), frameTypes(b), diffHex8)
+	d.value("hex_id", a.HexID, b.HexID)
+
+	return d
+}
+
+// diffValues compares two lists as multisets, returning the values only in
+// b (missing from a), the values only in a (extra in a), and whether the
+// values in both lists are in different orders.
+func diffValues[T comparable](a, b []T, format func(T) string) (missing, extra []string, reordered bool) {
+	countA := make(map[T]int, len(a))
+	for _, v := range a {
+		countA[v]++
+	}
+	countB := make(map[T]int, len(b))
+	for _, v := range b {
+		countB[v]++
+	}
+
+	commonA := make([]T, 0, len(a))
+	for _, v := range a {
+		if countB[v] > 0 {
+			countB[v]--
+			commonA = append(commonA, v)
+		} else {
+			extra = append(extra, format(v))
+		}
+	}
+	commonB := make([]T, 0, len(b))
+	for _, v := range b {
+		if countA[v] > 0 {
+			countA[v]--
+			commonB = append(commonB, v)
+		} else {
+			missing = append(missing, format(v))
+		}
+	}
+
+	return missing, extra, !slices.Equal(commonA, commonB)
+}
+
+func diffHex16(v uint16) string { return fmt.Sprintf("0x%04x", v) }
+
+func diffHex8(v uint8) string { return fmt.Sprintf("0x%02x", v) }
+
+func diffHexBytes(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func diffBool(b bool) string {
+	if !b {
+		return ""
+	}
+	return "true"
+}
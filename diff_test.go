@@ -0,0 +1,125 @@
+package clienthellod_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+)
+
+func TestDiff(t *testing.T) {
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d := Diff(ch, ch); !d.Equal() || d.String() != "" {
+		t.Errorf("no difference is expected, got %s", d)
+	}
+
+	var firefox105 *ClientHello
+	for _, parrot := range UTLSParrots() {
+		if parrot.ID.Str() == "Firefox-105" {
+			firefox105 = parrot.ClientHello
+		}
+	}
+	if firefox105 == nil {
+		t.Fatal("Firefox-105 parrot not found")
+	}
+
+	d := Diff(firefox105, ch)
+	for _, expected := range []FieldDiff{
+		{Field: "extensions", Added: []string{"0xfe0d"}, Removed: []string{"0x0015"}},
+		{Field: "server_name", From: UTLSParrotServerName, To: "client.tlsfingerprint.io"},
+		{Field: "encrypted_client_hello", To: "true"},
+	} {
+		if f := d.Field(expected.Field); f == nil || !reflect.DeepEqual(*f, expected) {
+			t.Errorf("difference mismatch, expecting %+v, got %+v", expected, f)
+		}
+	}
+	for _, field := range []string{"cipher_suites", "supported_groups", "signature_algorithms", "key_share"} {
+		if f := d.Field(field); f != nil {
+			t.Errorf("no difference is expected in %s, got %s", field, f)
+		}
+	}
+	if text := d.Field("extensions").String(); text != "extensions: +0xfe0d -0x0015" {
+		t.Errorf("text rendering mismatch, got %s", text)
+	}
+
+	b, err := json.Marshal(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshaled FingerprintDiff
+	if err = json.Unmarshal(b, &unmarshaled); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&unmarshaled, d) {
+		t.Errorf("JSON round trip mismatch, expecting %+v, got %+v", d, unmarshaled)
+	}
+}
+
+func TestDiffQUICFingerprint(t *testing.T) {
+	generate := func(data [][]byte) *QUICFingerprint {
+		gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+		for _, d := range data {
+			cip, err := UnmarshalQUICClientInitialPacket(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = gci.AddPacket(cip); err != nil {
+				t.Fatal(err)
+			}
+		}
+		qfp, err := GenerateQUICFingerprint(gci)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return qfp
+	}
+
+	firefox := generate(mapGatheredClientInitials["Firefox126"])
+	firefox0RTT := generate(mapGatheredClientInitials["Firefox126_0-RTT"])
+	chrome := generate(mapGatheredClientInitials["Chrome125"])
+
+	if d := DiffQUICFingerprint(firefox, firefox); !d.Equal() {
+		t.Errorf("no difference is expected, got %s", d)
+	}
+
+	t.Run("0-RTT", func(t *testing.T) {
+		d := DiffQUICFingerprint(firefox, firefox0RTT)
+		for _, expected := range []FieldDiff{
+			{Field: "client_initials.token", To: "true"},
+			{Field: "client_hello.extensions", Added: []string{"0x002a", "0x0029"}, Removed: []string{"0xfe0d"}},
+			{Field: "client_hello.pre_shared_key", To: "true"},
+		} {
+			if f := d.Field(expected.Field); f == nil || !reflect.DeepEqual(*f, expected) {
+				t.Errorf("difference mismatch, expecting %+v, got %+v", expected, f)
+			}
+		}
+		if f := d.Field("transport_parameters.tpids"); f != nil {
+			t.Errorf("no difference is expected in transport parameters, got %s", f)
+		}
+	})
+
+	t.Run("Chrome", func(t *testing.T) {
+		d := DiffQUICFingerprint(firefox, chrome)
+		for _, expected := range []FieldDiff{
+			{Field: "client_initials.packet_count", From: "1", To: "2"},
+			{Field: "client_hello.cipher_suites", Reordered: true},
+			{Field: "transport_parameters.initial_max_data", From: "0x01800000", To: "0x00f00000"},
+			{Field: "transport_parameters.max_ack_delay", From: "0x14"},
+		} {
+			if f := d.Field(expected.Field); f == nil || !reflect.DeepEqual(*f, expected) {
+				t.Errorf("difference mismatch, expecting %+v, got %+v", expected, f)
+			}
+		}
+
+		tpd := DiffQUICTransportParameters(firefox.ClientInitials.TransportParameters, chrome.ClientInitials.TransportParameters)
+		if f := tpd.Field("tpids"); f == nil || len(f.Added) == 0 || len(f.Removed) == 0 {
+			t.Errorf("transport parameters are expected to be added and removed, got %+v", f)
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package clienthellod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const DTLS_RECORD_HEADER_LENGTH = 13 // content_type(1) || version(2) || epoch(2) || sequence_number(6) || length(2)
+
+var (
+	ErrNotDTLSHandshakeRecord = errors.New("not a DTLS handshake record")
+	ErrNotDTLSClientHello     = errors.New("not a DTLS ClientHello")
+	errDTLSMessageSeqMismatch = errors.New("fragment of a different DTLS handshake message")
+)
+
+// dtlsToTLSVersion returns the TLS version a DTLS version is based on, so
+// that versions can be compared even though DTLS version numbers go down as
+// versions go up, or the version itself if it is not a DTLS version.
+func dtlsToTLSVersion(version uint16) uint16 {
+	switch version {
+	case 0xfeff: // DTLS 1.0
+		return 0x0302
+	case 0xfefd: // DTLS 1.2
+		return 0x0303
+	case 0xfefc: // DTLS 1.3
+		return 0x0304
+	default:
+		return version
+	}
+}
+
+// DTLSClientHello represents a DTLS ClientHello.
+//
+// The fingerprintable fields and IDs are calculated from the ClientHello with
+// the DTLS-only cookie field removed, so they are directly comparable with
+// the ones of a TLS ClientHello. JA4 fingerprints are prefixed with 'd'.
+type DTLSClientHello struct {
+	ClientHello
+
+	DTLSCookieLength int    `json:"dtls_cookie_length"` // length of the cookie echoed from HelloVerifyRequest, 0 for the initial ClientHello
+	DTLSMessageSeq   uint16 `json:"dtls_message_seq"`   // message_seq of the ClientHello, 0 for the initial ClientHello
+}
+
+// ReadDTLSClientHello reads DTLS records from an io.Reader until a complete
+// ClientHello is reassembled from the handshake fragments, and returns a
+// DTLSClientHello struct.
+//
+// All bytes read from the reader will be stored in the DTLSClientHello
+// struct even if an error is returned.
+//
+// This function does not automatically call [DTLSClientHello.ParseClientHello].
+func ReadDTLSClientHello(r io.Reader) (dch *DTLSClientHello, err error) {
+	reassembler := newDTLSReassembler(DEFAULT_CLIENTHELLO_MAX_SIZE)
+	for {
+		// Read a DTLS record
+		record := make([]byte, DTLS_RECORD_HEADER_LENGTH)
+		n, err := io.ReadFull(r, record)
+		if err == nil {
+			record = append(record, make([]byte, binary.BigEndian.Uint16(record[11:13]))...)
+			var m int
+			m, err = io.ReadFull(r, record[DTLS_RECORD_HEADER_LENGTH:])
+			n += m
+		}
+		if err != nil {
+			return &DTLSClientHello{ClientHello: ClientHello{raw: append(reassembler.raw, record[:n]...)}}, err
+		}
+
+		done, err := reassembler.addRecord(record)
+		if err != nil {
+			return &DTLSClientHello{ClientHello: ClientHello{raw: reassembler.raw}}, err
+		}
+		if done {
+			return reassembler.clientHello()
+		}
+	}
+}
+
+// UnmarshalDTLSClientHello unmarshals a DTLS ClientHello from a byte slice
+// of one or more DTLS records and returns a DTLSClientHello struct. Any extra
+// bytes after the ClientHello will be ignored.
+//
+// This function automatically calls [DTLSClientHello.ParseClientHello].
+func UnmarshalDTLSClientHello(p []byte) (dch *DTLSClientHello, err error) {
+	dch, err = ReadDTLSClientHello(bytes.NewReader(p))
+	if err != nil {
+		return
+	}
+
+	err = dch.ParseClientHello()
+	return
+}
+
+// ParseClientHello parses the reassembled DTLS ClientHello.
+func (dch *DTLSClientHello) ParseClientHello() error {
+	if err := dch.ClientHello.ParseClientHello(); err != nil {
+		return err
+	}
+
+	// JA4 fingerprints of DTLS ClientHello are prefixed with 'd' instead of 't'
+	dch.JA4, dch.JA4R, dch.JA4O = dch.calcJA4(ja4ProtocolDTLS)
+	dch.Fingerprints = dch.calcFingerprintSet()
+
+	return nil
+}
+
+// dtlsReassembler reassembles a DTLS ClientHello from handshake fragments,
+// which may arrive out of order, overlap or be duplicated.
+type dtlsReassembler struct {
+	mutex sync.Mutex
+
+	maxSize       int
+	raw           []byte // all DTLS records added
+	recordLengths []int
+
+	messageSeq uint16
+	msgLen     int                 // -1 until the first fragment is added
+	ranges     []dtlsFragmentRange // of the message received, sorted and merged
+	body       []byte              // msgLen bytes, filled in with the bytes of each fragment not received before
+}
+
+// dtlsFragmentRange is the range [start, end) of a handshake message.
+type dtlsFragmentRange struct {
+	start, end int
+}
+
+func newDTLSReassembler(maxSize int) *dtlsReassembler {
+	return &dtlsReassembler{
+		maxSize: maxSize,
+		msgLen:  -1,
+	}
+}
+
+// reset discards everything added to the reassembler.
+func (r *dtlsReassembler) reset() {
+	r.raw = nil
+	r.recordLengths = nil
+	r.messageSeq = 0
+	r.msgLen = -1
+	r.ranges = nil
+	r.body = nil
+}
+
+// addRecord adds a DTLS record carrying one or more ClientHello fragments
+// and reports whether the ClientHello is complete. The reassembler is reset
+// on any error.
+func (r *dtlsReassembler) addRecord(record []byte) (done bool, err error) {
+	defer func() {
+		if err != nil {
+			r.reset()
+		}
+	}()
+	r.raw = append(r.raw, record...)
+
+	s := cryptobyte.String(record)
+	var contentType uint8
+	var epoch uint16
+	var fragments cryptobyte.String
+	if !s.ReadUint8(&contentType) ||
+		!s.Skip(2) || // version
+		!s.ReadUint16(&epoch) ||
+		!s.Skip(6) || // sequence_number
+		!s.ReadUint16LengthPrefixed(&fragments) {
+		return false, errors.New("unable to read DTLS record")
+	}
+	if contentType != 0x16 || epoch != 0 {
+		return false, ErrNotDTLSHandshakeRecord
+	}
+	r.recordLengths = append(r.recordLengths, len(fragments))
+
+	for !fragments.Empty() {
+		var msgType uint8
+		var msgLen, fragmentOffset, fragmentLength uint32
+		var messageSeq uint16
+		var fragment []byte
+		if !fragments.ReadUint8(&msgType) ||
+			!fragments.ReadUint24(&msgLen) ||
+			!fragments.ReadUint16(&messageSeq) ||
+			!fragments.ReadUint24(&fragmentOffset) ||
+			!fragments.ReadUint24(&fragmentLength) ||
+			!fragments.ReadBytes(&fragment, int(fragmentLength)) {
+			return false, errors.New("unable to read DTLS handshake fragment")
+		}
+		if msgType != 0x01 {
+			return false, ErrNotDTLSClientHello
+		}
+
+		if r.msgLen < 0 {
+			if int(msgLen) > r.maxSize {
+				return false, fmt.Errorf("ClientHello exceeds the maximum size of %d bytes", r.maxSize)
+			}
+			r.messageSeq = messageSeq
+			r.msgLen = int(msgLen)
+			r.body = make([]byte, r.msgLen)
+		} else if messageSeq != r.messageSeq || int(msgLen) != r.msgLen {
+			return false, errDTLSMessageSeqMismatch
+		}
+
+		if int(fragmentOffset)+int(fragmentLength) > r.msgLen {
+			return false, errors.New("DTLS handshake fragment out of bounds")
+		}
+		if len(fragment) == 0 {
+			continue
+		}
+		for _, gap := range r.addRange(int(fragmentOffset), int(fragmentOffset+fragmentLength)) {
+			copy(r.body[gap.start:gap.end], fragment[gap.start-int(fragmentOffset):])
+		}
+	}
+
+	done = r.msgLen == 0 || (r.msgLen > 0 && len(r.ranges) == 1 && r.ranges[0] == dtlsFragmentRange{0, r.msgLen})
+	return done, nil
+}
+
+// addRange merges [start, end) into the ranges received and returns the
+// parts of it not received before.
+func (r *dtlsReassembler) addRange(start, end int) (gaps []dtlsFragmentRange) {
+	cursor := start
+	for _, rg := range r.ranges {
+		if rg.end <= cursor {
+			continue
+		}
+		if rg.start >= end {
+			break
+		}
+		if rg.start > cursor {
+			gaps = append(gaps, dtlsFragmentRange{cursor, rg.start})
+		}
+		cursor = rg.end
+	}
+	if cursor < end {
+		gaps = append(gaps, dtlsFragmentRange{cursor, end})
+	}
+	if len(gaps) == 0 {
+		return nil // nothing new
+	}
+
+	merged := dtlsFragmentRange{start, end}
+	ranges := make([]dtlsFragmentRange, 0, len(r.ranges)+1)
+	added := false
+	for _, rg := range r.ranges {
+		switch {
+		case rg.end < merged.start: // before
+			ranges = append(ranges, rg)
+		case merged.end < rg.start: // after
+			if !added {
+				ranges = append(ranges, merged)
+				added = true
+			}
+			ranges = append(ranges, rg)
+		default: // overlapping or adjacent
+			merged.start = min(merged.start, rg.start)
+			merged.end = max(merged.end, rg.end)
+		}
+	}
+	if !added {
+		ranges = append(ranges, merged)
+	}
+	r.ranges = ranges
+	return gaps
+}
+
+// clientHello converts the reassembled DTLS ClientHello into a DTLSClientHello
+// by removing the cookie from the handshake message.
+func (r *dtlsReassembler) clientHello() (*DTLSClientHello, error) {
+	dch := &DTLSClientHello{
+		ClientHello: ClientHello{
+			raw:              r.raw,
+			TLSRecordCount:   len(r.recordLengths),
+			TLSRecordLengths: r.recordLengths,
+		},
+		DTLSMessageSeq: r.messageSeq,
+	}
+
+	s := cryptobyte.String(r.body)
+	var versionRandom []byte
+	var sessionID, cookie cryptobyte.String
+	if !s.ReadBytes(&versionRandom, 2+32) ||
+		!s.ReadUint8LengthPrefixed(&sessionID) ||
+		!s.ReadUint8LengthPrefixed(&cookie) {
+		return dch, errors.New("unable to read DTLS ClientHello cookie")
+	}
+	dch.DTLSCookieLength = len(cookie)
+
+	b := cryptobyte.NewBuilder(nil)
+	b.AddUint8(0x01) // ClientHello
+	b.AddUint24LengthPrefixed(func(b *cryptobyte.Builder) {
+		b.AddBytes(versionRandom)
+		b.AddUint8LengthPrefixed(func(b *cryptobyte.Builder) { b.AddBytes(sessionID) })
+		b.AddBytes(s) // cipher_suites, compression_methods and extensions
+	})
+	handshake, err := b.Bytes()
+	if err != nil {
+		return dch, err
+	}
+	dch.handshake = handshake
+
+	return dch, nil
+}
@@ -0,0 +1,210 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	"golang.org/x/exp/slices"
+)
+
+// dtlsClientHelloRecords converts the Firefox 126 TLS ClientHello into a DTLS
+// 1.2 ClientHello with the given cookie and message_seq, fragmented into DTLS
+// records carrying at most fragmentSize bytes each.
+func dtlsClientHelloRecords(cookie []byte, messageSeq uint16, fragmentSize int) [][]byte {
+	record := bytes.Clone(tlsClientHello_Firefox126)
+	record[5+4], record[5+4+1] = 0xfe, 0xfd // legacy_version of DTLS 1.2
+	return dtlsRecordsFromTLS(record, cookie, messageSeq, fragmentSize)
+}
+
+// dtlsRecordsFromTLS converts a TLS record carrying a ClientHello into a DTLS
+// ClientHello the same way as dtlsClientHelloRecords. The legacy_version and
+// the extensions, including supported_versions, are kept as-is.
+func dtlsRecordsFromTLS(tlsRecord, cookie []byte, messageSeq uint16, fragmentSize int) [][]byte {
+	tlsBody := tlsRecord[5+4:] // skip TLS record and handshake header
+	sessionIDEnd := 2 + 32 + 1 + int(tlsBody[2+32])
+
+	body := append([]byte{}, tlsBody[:sessionIDEnd]...)
+	body = append(body, byte(len(cookie)))
+	body = append(body, cookie...)
+	body = append(body, tlsBody[sessionIDEnd:]...)
+
+	var records [][]byte
+	for offset := 0; offset < len(body); offset += fragmentSize {
+		fragment := body[offset:min(offset+fragmentSize, len(body))]
+		record := []byte{
+			0x16,       // handshake
+			0xfe, 0xfd, // DTLS 1.2
+			0x00, 0x00, // epoch
+			0x00, 0x00, 0x00, 0x00, 0x00, byte(len(records)), // sequence_number
+			byte((12 + len(fragment)) >> 8), byte(12 + len(fragment)),
+			0x01, // ClientHello
+			byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body)),
+			byte(messageSeq >> 8), byte(messageSeq),
+			byte(offset >> 16), byte(offset >> 8), byte(offset),
+			byte(len(fragment) >> 16), byte(len(fragment) >> 8), byte(len(fragment)),
+		}
+		records = append(records, append(record, fragment...))
+	}
+	return records
+}
+
+func TestUnmarshalDTLSClientHello(t *testing.T) {
+	tlsCh, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records := dtlsClientHelloRecords(nil, 0, 1<<16)
+	dch, err := UnmarshalDTLSClientHello(records[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dch.TLSRecordVersion != 0xfefd || dch.TLSHandshakeVersion != 0xfefd {
+		t.Errorf("DTLS versions mismatch, got record 0x%04x and handshake 0x%04x", dch.TLSRecordVersion, dch.TLSHandshakeVersion)
+	}
+	if dch.DTLSCookieLength != 0 || dch.DTLSMessageSeq != 0 || dch.TLSRecordCount != 1 {
+		t.Errorf("unexpected initial DTLS ClientHello %d/%d/%d", dch.DTLSCookieLength, dch.DTLSMessageSeq, dch.TLSRecordCount)
+	}
+	if !slices.Equal(dch.CipherSuites, tlsCh.CipherSuites) || !slices.Equal(dch.Extensions, tlsCh.Extensions) || dch.ServerName != tlsCh.ServerName {
+		t.Errorf("DTLS ClientHello fields mismatch with the TLS ClientHello")
+	}
+	if dch.JA4 != "d"+tlsCh.JA4[1:] {
+		t.Errorf("JA4 mismatch, expecting d%s, got %s", tlsCh.JA4[1:], dch.JA4)
+	}
+
+	t.Run("FragmentedWithCookie", func(t *testing.T) {
+		records := dtlsClientHelloRecords(bytes.Repeat([]byte{0xc0}, 32), 1, 200)
+		slices.Reverse(records) // out of order
+		fragmented, err := UnmarshalDTLSClientHello(bytes.Join(records, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if fragmented.DTLSCookieLength != 32 || fragmented.DTLSMessageSeq != 1 || fragmented.TLSRecordCount != len(records) {
+			t.Errorf("unexpected DTLS ClientHello %d/%d/%d", fragmented.DTLSCookieLength, fragmented.DTLSMessageSeq, fragmented.TLSRecordCount)
+		}
+		if fragmented.HexID != dch.HexID || fragmented.NormHexID != dch.NormHexID || fragmented.JA4 != dch.JA4 {
+			t.Errorf("cookie and fragmentation must not affect the fingerprint, expecting %s/%s, got %s/%s", dch.HexID, dch.JA4, fragmented.HexID, fragmented.JA4)
+		}
+	})
+
+	t.Run("Overlapping", func(t *testing.T) {
+		records := append(dtlsClientHelloRecords(nil, 0, 200), dtlsClientHelloRecords(nil, 0, 300)...)
+		records = append(records, records[1]) // duplicate
+		slices.Reverse(records)
+		overlapping, err := UnmarshalDTLSClientHello(bytes.Join(records, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if overlapping.HexID != dch.HexID {
+			t.Errorf("overlapping fragments must not affect the fingerprint, expecting %s, got %s", dch.HexID, overlapping.HexID)
+		}
+	})
+
+	t.Run("Sliding", func(t *testing.T) {
+		// overlapping fragments each moving forward by a few bytes
+		body := dtlsClientHelloRecords(nil, 0, 1<<16)[0][DTLS_RECORD_HEADER_LENGTH+12:]
+		var records [][]byte
+		for offset := 0; offset < len(body); offset += 7 {
+			fragment := body[offset:min(offset+300, len(body))]
+			record := []byte{
+				0x16, 0xfe, 0xfd, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, byte(len(records) >> 8), byte(len(records)),
+				byte((12 + len(fragment)) >> 8), byte(12 + len(fragment)),
+				0x01, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body)),
+				0x00, 0x00,
+				byte(offset >> 16), byte(offset >> 8), byte(offset),
+				byte(len(fragment) >> 16), byte(len(fragment) >> 8), byte(len(fragment)),
+			}
+			records = append(records, append(record, fragment...))
+		}
+		sliding, err := UnmarshalDTLSClientHello(bytes.Join(records, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sliding.HexID != dch.HexID {
+			t.Errorf("sliding fragments must not affect the fingerprint, expecting %s, got %s", dch.HexID, sliding.HexID)
+		}
+	})
+
+	t.Run("DTLSVersions", func(t *testing.T) {
+		for _, tc := range []struct {
+			name     string
+			versions []uint16
+			ja4      string
+		}{
+			{"DTLS 1.3", []uint16{0xfefc, 0xfefd}, "dd3"},
+			{"DTLS 1.2", []uint16{0xfefd, 0xfeff}, "dd2"},
+			{"DTLS 1.3 with GREASE", []uint16{0x4a4a, 0xfeff, 0xfefd, 0xfefc}, "dd3"}, // in any order
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				record := lintClientHelloRecord(0xfefd, []uint8{0}, []lintExtension{{43, lintUint16List(1, tc.versions...)}})
+				dch, err := UnmarshalDTLSClientHello(dtlsRecordsFromTLS(record, nil, 0, 1<<16)[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !strings.HasPrefix(dch.JA4, tc.ja4) {
+					t.Errorf("JA4 version mismatch, expecting %s, got %s", tc.ja4, dch.JA4)
+				}
+			})
+		}
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		records := dtlsClientHelloRecords(nil, 0, 200)
+		if _, err := UnmarshalDTLSClientHello(bytes.Join(records[:len(records)-1], nil)); err == nil {
+			t.Errorf("incomplete DTLS ClientHello is expected to be rejected")
+		}
+	})
+}
+
+func TestDTLSFingerprinter(t *testing.T) {
+	truth, err := UnmarshalDTLSClientHello(dtlsClientHelloRecords(nil, 0, 1<<16)[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dfp := NewDTLSFingerprinter()
+	defer dfp.Close()
+
+	if err := dfp.HandlePacket("test", []byte("not a DTLS record")); err != nil {
+		t.Fatalf("non DTLS packets are expected to be ignored, got %v", err)
+	}
+
+	// the initial ClientHello is interrupted by the one answering HelloVerifyRequest
+	initial := dtlsClientHelloRecords(nil, 0, 300)
+	if err := dfp.HandlePacket("test", initial[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	records := dtlsClientHelloRecords(bytes.Repeat([]byte{0xc0}, 20), 1, 300)
+
+	// a fragment out of bounds is rejected without leaving anything behind
+	outOfBounds := bytes.Clone(records[1])
+	outOfBounds[19], outOfBounds[20], outOfBounds[21] = 0xff, 0xff, 0xff // fragment_offset
+	if err := dfp.HandlePacket("test", outOfBounds); err == nil {
+		t.Fatal("DTLS handshake fragment out of bounds is expected to be rejected")
+	}
+
+	for i, record := range records {
+		if dfp.Peek("test") != nil {
+			t.Fatalf("DTLS ClientHello is not expected to be complete after %d fragments", i)
+		}
+		if err := dfp.HandlePacket("test", record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dch := dfp.Pop("test")
+	if dch == nil {
+		t.Fatal("DTLSClientHello not found in DTLSFingerprinter")
+	}
+	if dch.TLSRecordCount != len(records) {
+		t.Errorf("records of other ClientHellos are expected to be discarded, got %d records instead of %d", dch.TLSRecordCount, len(records))
+	}
+	if dch.DTLSMessageSeq != 1 || dch.DTLSCookieLength != 20 || dch.HexID != truth.HexID {
+		t.Errorf("DTLSClientHello mismatch, got message_seq %d, cookie length %d, HexID %s", dch.DTLSMessageSeq, dch.DTLSCookieLength, dch.HexID)
+	}
+}
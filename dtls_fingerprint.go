@@ -0,0 +1,183 @@
+package clienthellod
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const DEFAULT_DTLSFINGERPRINT_EXPIRY = 10 * time.Second
+
+// DTLSFingerprinter can be used to fingerprint DTLS connections.
+type DTLSFingerprinter struct {
+	mapReassemblers *sync.Map
+	mapClientHellos *sync.Map
+
+	timeout time.Duration
+	closed  atomic.Bool
+}
+
+// NewDTLSFingerprinter creates a new DTLSFingerprinter.
+func NewDTLSFingerprinter() *DTLSFingerprinter {
+	return &DTLSFingerprinter{
+		mapReassemblers: new(sync.Map),
+		mapClientHellos: new(sync.Map),
+		closed:          atomic.Bool{},
+	}
+}
+
+// NewDTLSFingerprinterWithTimeout creates a new DTLSFingerprinter with a timeout.
+func NewDTLSFingerprinterWithTimeout(timeout time.Duration) *DTLSFingerprinter {
+	return &DTLSFingerprinter{
+		mapReassemblers: new(sync.Map),
+		mapClientHellos: new(sync.Map),
+		timeout:         timeout,
+		closed:          atomic.Bool{},
+	}
+}
+
+// SetTimeout sets the timeout for reassembling and keeping DTLS ClientHellos.
+func (dfp *DTLSFingerprinter) SetTimeout(timeout time.Duration) {
+	dfp.timeout = timeout
+}
+
+// HandlePacket handles a UDP datagram carrying one or more DTLS records.
+//
+// A ClientHello fragmented across multiple datagrams is reassembled per
+// source address before being parsed.
+func (dfp *DTLSFingerprinter) HandlePacket(from string, p []byte) error {
+	if dfp.closed.Load() {
+		return errors.New("DTLSFingerprinter closed")
+	}
+
+	if len(p) < DTLS_RECORD_HEADER_LENGTH || p[0] != 0x16 || p[1] != 0xfe {
+		return nil // totally fine, we don't care about non DTLS handshakes
+	}
+
+	testReassembler := newDTLSReassembler(DEFAULT_CLIENTHELLO_MAX_SIZE)
+	chosenReassembler, existing := dfp.mapReassemblers.LoadOrStore(from, testReassembler)
+	if !existing {
+		go func(d time.Duration) {
+			<-time.After(d)
+			dfp.mapReassemblers.CompareAndDelete(from, testReassembler)
+		}(dfp.expiry())
+	}
+
+	reassembler, ok := chosenReassembler.(*dtlsReassembler)
+	if !ok {
+		return errors.New("dtlsReassembler loaded from sync.Map failed type assertion")
+	}
+
+	reassembler.mutex.Lock()
+	defer reassembler.mutex.Unlock()
+
+	s := cryptobyte.String(p)
+	for !s.Empty() {
+		var record []byte
+		if len(s) < DTLS_RECORD_HEADER_LENGTH ||
+			!s.ReadBytes(&record, DTLS_RECORD_HEADER_LENGTH+int(binary.BigEndian.Uint16(s[11:13]))) {
+			return errors.New("unable to read DTLS record")
+		}
+
+		done, err := reassembler.addRecord(record)
+		if errors.Is(err, errDTLSMessageSeqMismatch) {
+			// a new ClientHello, e.g., the one responding to HelloVerifyRequest
+			reassembler.reset()
+			done, err = reassembler.addRecord(record)
+		}
+		if err != nil {
+			return err
+		}
+		if !done {
+			continue
+		}
+
+		dfp.mapReassemblers.CompareAndDelete(from, reassembler)
+		dch, err := reassembler.clientHello()
+		if err != nil {
+			return err
+		}
+		if err = dch.ParseClientHello(); err != nil {
+			return err
+		}
+
+		dfp.mapClientHellos.Store(from, dch)
+		go func(d time.Duration, key string, oldDch *DTLSClientHello) {
+			<-time.After(d)
+			dfp.mapClientHellos.CompareAndDelete(key, oldDch)
+		}(dfp.expiry(), from, dch)
+
+		return nil // ignore anything after the ClientHello
+	}
+
+	return nil
+}
+
+// HandleUDPConn handles DTLS connections over UDP.
+func (dfp *DTLSFingerprinter) HandleUDPConn(pc net.PacketConn) error {
+	var buf [2048]byte
+	for {
+		if dfp.closed.Load() {
+			return errors.New("DTLSFingerprinter closed")
+		}
+
+		n, addr, err := pc.ReadFrom(buf[:])
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) || errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			continue // ignore errors unless connection is closed
+		}
+
+		dfp.HandlePacket(addr.String(), buf[:n])
+	}
+}
+
+// Peek looks up a DTLSClientHello for a given key.
+func (dfp *DTLSFingerprinter) Peek(from string) *DTLSClientHello {
+	dch, ok := dfp.mapClientHellos.Load(from)
+	if !ok {
+		return nil
+	}
+
+	dtlsClientHello, ok := dch.(*DTLSClientHello)
+	if !ok {
+		return nil
+	}
+
+	return dtlsClientHello
+}
+
+// Pop looks up a DTLSClientHello for a given key and deletes it from the
+// fingerprinter if found.
+func (dfp *DTLSFingerprinter) Pop(from string) *DTLSClientHello {
+	dch, ok := dfp.mapClientHellos.LoadAndDelete(from)
+	if !ok {
+		return nil
+	}
+
+	dtlsClientHello, ok := dch.(*DTLSClientHello)
+	if !ok {
+		return nil
+	}
+
+	return dtlsClientHello
+}
+
+// Close closes the DTLSFingerprinter.
+func (dfp *DTLSFingerprinter) Close() {
+	dfp.closed.Store(true)
+}
+
+func (dfp *DTLSFingerprinter) expiry() time.Duration {
+	if dfp.timeout == time.Duration(0) {
+		return DEFAULT_DTLSFINGERPRINT_EXPIRY
+	}
+	return dfp.timeout
+}
@@ -32,37 +32,47 @@ func (id FingerprintID) AsHex() string {
 	return hex.EncodeToString(hid)
 }
 
-// calcNumericID returns the numeric ID of this client hello.
-func (ch *ClientHello) calcNumericID() (orig, norm int64) {
-	for _, normalized := range []bool{false, true} {
-		h := sha1.New() // skipcq: GO-S1025, GSC-G401,
-		binary.Write(h, binary.BigEndian, uint16(ch.TLSRecordVersion))
-		binary.Write(h, binary.BigEndian, uint16(ch.TLSHandshakeVersion))
-
-		updateArr(h, utils.Uint16ToUint8(ch.CipherSuites))
-		updateArr(h, ch.CompressionMethods)
-		if normalized {
-			updateArr(h, utils.Uint16ToUint8(ch.ExtensionsNormalized))
-		} else {
-			updateArr(h, utils.Uint16ToUint8(ch.Extensions))
-		}
-		updateArr(h, utils.Uint16ToUint8(ch.lengthPrefixedSupportedGroups))
-		updateArr(h, ch.lengthPrefixedEcPointFormats)
-		updateArr(h, utils.Uint16ToUint8(ch.lengthPrefixedSignatureAlgos))
+// calcNumericID returns the numeric ID of this client hello, calculated with
+// the given fingerprint scheme. If normalized is true, the sorted extension
+// list is used instead of the original one.
+func (ch *ClientHello) calcNumericID(scheme FingerprintScheme, normalized bool) (numID int64, hexID string) {
+	h := scheme.newHash()
+	binary.Write(h, binary.BigEndian, uint16(ch.TLSRecordVersion))
+	binary.Write(h, binary.BigEndian, uint16(ch.TLSHandshakeVersion))
+
+	updateArr(h, utils.Uint16ToUint8(ch.CipherSuites))
+	updateArr(h, ch.CompressionMethods)
+	if normalized {
+		updateArr(h, utils.Uint16ToUint8(scheme.filterExtensions(ch.ExtensionsNormalized)))
+	} else {
+		updateArr(h, utils.Uint16ToUint8(scheme.filterExtensions(ch.Extensions)))
+	}
+	updateArr(h, utils.Uint16ToUint8(ch.lengthPrefixedSupportedGroups))
+	updateArr(h, ch.lengthPrefixedEcPointFormats)
+	updateArr(h, utils.Uint16ToUint8(ch.lengthPrefixedSignatureAlgos))
+	if !scheme.ExcludeALPN {
 		updateArr(h, ch.alpnWithLengths)
-		updateArr(h, utils.Uint16ToUint8(ch.keyshareGroupsWithLengths))
-		updateArr(h, ch.PSKKeyExchangeModes)
-		updateArr(h, utils.Uint16ToUint8(ch.SupportedVersions))
-		updateArr(h, ch.lengthPrefixedCertCompressAlgos)
-		updateArr(h, ch.RecordSizeLimit)
-
-		if normalized {
-			norm = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
-		} else {
-			orig = int64(binary.BigEndian.Uint64(h.Sum(nil)[:8]))
-		}
+	}
+	updateArr(h, utils.Uint16ToUint8(ch.keyshareGroupsWithLengths))
+	updateArr(h, ch.PSKKeyExchangeModes)
+	updateArr(h, utils.Uint16ToUint8(ch.SupportedVersions))
+	updateArr(h, ch.lengthPrefixedCertCompressAlgos)
+	updateArr(h, ch.RecordSizeLimit)
+	if scheme.IncludeSessionIDLength {
+		updateU32(h, uint32(ch.sessionIDLength))
+	}
+	if ch.SSLv2 {
+		updateArr(h, ch.sslv2CipherSpecsBytes())
+		updateU32(h, uint32(ch.SSLv2ChallengeLength))
 	}
 
+	sum := h.Sum(nil)
+	numID = int64(binary.BigEndian.Uint64(sum[:8]))
+	if scheme.Hash == FINGERPRINT_HASH_SHA1 {
+		hexID = FingerprintID(numID).AsHex()
+	} else {
+		hexID = hex.EncodeToString(sum)
+	}
 	return
 }
 
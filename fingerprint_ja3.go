@@ -0,0 +1,52 @@
+package clienthellod
+
+import (
+	"crypto/md5" // skipcq: GSC-G501
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+)
+
+// calcJA3 returns the JA3 string and its MD5 hash (hex string) of this client hello.
+//
+// The JA3 string is composed of the following fields, separated by commas:
+//
+//	SSLVersion,Ciphers,Extensions,EllipticCurves,EllipticCurvePointFormats
+//
+// Values in each list are dash-separated decimals in the order they were
+// observed. GREASE values are ignored, as in the reference implementation.
+func (ch *ClientHello) calcJA3() (ja3 string, ja3Hash string) {
+	var sb strings.Builder
+	sb.WriteString(strconv.FormatUint(uint64(ch.TLSHandshakeVersion), 10))
+	sb.WriteByte(',')
+	writeJA3List(&sb, ch.CipherSuites)
+	sb.WriteByte(',')
+	writeJA3List(&sb, ch.Extensions)
+	sb.WriteByte(',')
+	writeJA3List(&sb, ch.NamedGroupList)
+	sb.WriteByte(',')
+	writeJA3List(&sb, ch.ECPointFormatList)
+
+	ja3 = sb.String()
+	sum := md5.Sum([]byte(ja3)) // skipcq: GO-S1023, GSC-G401
+	ja3Hash = hex.EncodeToString(sum[:])
+	return
+}
+
+// writeJA3List writes a dash-separated list of decimal values to sb, skipping
+// any GREASE values.
+func writeJA3List[T ~uint8 | ~uint16](sb *strings.Builder, arr []T) {
+	first := true
+	for _, v := range arr {
+		if utils.IsGREASEUint16(uint16(v)) {
+			continue
+		}
+		if !first {
+			sb.WriteByte('-')
+		}
+		sb.WriteString(strconv.FormatUint(uint64(v), 10))
+		first = false
+	}
+}
@@ -0,0 +1,49 @@
+package clienthellod_test
+
+import (
+	_ "embed"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+)
+
+var (
+	//go:embed internal/testdata/TLS_ClientHello_Firefox_126.bin
+	tlsClientHello_Firefox126 []byte
+)
+
+func TestClientHelloJA3(t *testing.T) {
+	t.Run("Firefox126", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testJA3EqualsTruth(t, ch,
+			"771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-65037,29-23-24-25-256-257,0",
+			"b5001237acdf006056b409cc433726b0",
+		)
+	})
+
+	t.Run("QUIC_Chrome124", func(t *testing.T) {
+		qch, err := ParseQUICClientHello(quicClientHelloTruth_Chrome124)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testJA3EqualsTruth(t, &qch.ClientHello,
+			"771,4865-4866-4867,45-43-27-13-17513-51-57-16-0-10-65037,25497-29-23-24,",
+			"1f368401cfe2cb7a2130453cfc7af494",
+		)
+	})
+}
+
+func testJA3EqualsTruth(t *testing.T, ch *ClientHello, ja3, ja3Hash string) {
+	if ch.JA3 != ja3 {
+		t.Errorf("JA3 mismatch, expecting %s, got %s", ja3, ch.JA3)
+	}
+
+	if ch.JA3Hash != ja3Hash {
+		t.Errorf("JA3 hash mismatch, expecting %s, got %s", ja3Hash, ch.JA3Hash)
+	}
+}
@@ -0,0 +1,175 @@
+package clienthellod
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+)
+
+const (
+	ja4ProtocolTCP  byte = 't'
+	ja4ProtocolQUIC byte = 'q'
+	ja4ProtocolDTLS byte = 'd'
+)
+
+// calcJA4 returns the JA4, JA4_r and JA4_o fingerprints of this client hello.
+//
+// protocol is the first character of the JA4 fingerprint, which is 't' for
+// TLS over TCP, 'q' for QUIC and 'd' for DTLS.
+//
+// GREASE values are ignored in all counts and lists.
+func (ch *ClientHello) calcJA4(protocol byte) (ja4, ja4r, ja4o string) {
+	ciphers := ja4HexList(ch.CipherSuites, false)
+	extensions := ja4HexList(ch.Extensions, false)
+	sigalgs := strings.Join(ja4HexList(ch.SignatureSchemeList, false), ",")
+
+	// extensions count includes SNI and ALPN, but they are excluded from the
+	// sorted extension list
+	sortedExtensions := make([]string, 0, len(extensions))
+	for _, ext := range ja4HexList(ch.Extensions, true) {
+		if ext == "0000" || ext == "0010" { // server_name(0), alpn(16)
+			continue
+		}
+		sortedExtensions = append(sortedExtensions, ext)
+	}
+
+	sortedCiphers := ja4HexList(ch.CipherSuites, true)
+
+	a := fmt.Sprintf("%c%s%c%02d%02d%s",
+		protocol,
+		ch.ja4Version(),
+		ch.ja4SNI(),
+		min(len(ciphers), 99),
+		min(len(extensions), 99),
+		ch.ja4ALPN(),
+	)
+
+	// JA4_r: raw, sorted
+	cr := strings.Join(sortedCiphers, ",")
+	er := ja4AppendSigalgs(strings.Join(sortedExtensions, ","), sigalgs)
+	// JA4_o: original order, SNI and ALPN included
+	co := strings.Join(ciphers, ",")
+	eo := ja4AppendSigalgs(strings.Join(extensions, ","), sigalgs)
+
+	ja4 = a + "_" + ja4Hash(cr, len(ciphers) == 0) + "_" + ja4Hash(er, len(sortedExtensions) == 0)
+	ja4r = a + "_" + cr + "_" + er
+	ja4o = a + "_" + ja4Hash(co, len(ciphers) == 0) + "_" + ja4Hash(eo, len(extensions) == 0)
+	return
+}
+
+// ja4Version returns the 2-character TLS version used in JA4, which is the
+// highest non-GREASE version in supported_versions if present, or the
+// handshake version otherwise. DTLS versions are ranked by the TLS version
+// they stand for, as their numbers go down as versions go up. An
+// SSLv2-compatible ClientHello is always "s2" regardless of the version it
+// advertises.
+func (ch *ClientHello) ja4Version() string {
+	if ch.SSLv2 {
+		return "s2"
+	}
+
+	var version uint16 = ch.TLSHandshakeVersion
+	if len(ch.SupportedVersions) > 0 {
+		version = 0
+		for _, v := range ch.SupportedVersions {
+			if !utils.IsGREASEUint16(v) && (version == 0 || dtlsToTLSVersion(v) > dtlsToTLSVersion(version)) {
+				version = v
+			}
+		}
+	}
+
+	switch version {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	default:
+		return "00"
+	}
+}
+
+// ja4SNI returns 'd' if the client hello is sent to a domain (SNI present),
+// or 'i' if it is sent to an IP (SNI absent).
+func (ch *ClientHello) ja4SNI() byte {
+	for _, ext := range ch.Extensions {
+		if ext == 0 { // server_name(0)
+			return 'd'
+		}
+	}
+	return 'i'
+}
+
+// ja4ALPN returns the first and last characters of the first ALPN value, or
+// "00" if no ALPN is present. If either character is not alphanumeric, the
+// first and last characters of the hex representation of the value are used
+// instead.
+func (ch *ClientHello) ja4ALPN() string {
+	if len(ch.ALPN) == 0 || len(ch.ALPN[0]) == 0 {
+		return "00"
+	}
+
+	alpn := ch.ALPN[0]
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+
+	hexALPN := hex.EncodeToString([]byte(alpn))
+	return string([]byte{hexALPN[0], hexALPN[len(hexALPN)-1]})
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// ja4HexList converts a list of uint16 into a list of 4-character hex strings,
+// skipping GREASE values. If sorted is true, the output will be sorted.
+func ja4HexList(arr []uint16, sorted bool) []string {
+	list := make([]string, 0, len(arr))
+	for _, v := range arr {
+		if utils.IsGREASEUint16(v) {
+			continue
+		}
+		list = append(list, fmt.Sprintf("%04x", v))
+	}
+
+	if sorted {
+		sort.Strings(list)
+	}
+	return list
+}
+
+func ja4AppendSigalgs(extensions, sigalgs string) string {
+	if sigalgs == "" {
+		return extensions
+	}
+	return extensions + "_" + sigalgs
+}
+
+// ja4Hash returns the first 12 characters of the hex-encoded SHA-256 hash
+// of s, or "000000000000" if empty is true.
+func ja4Hash(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,49 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+)
+
+func TestClientHelloJA4(t *testing.T) {
+	t.Run("Firefox126", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testJA4EqualsTruth(t, ch,
+			"t13d1715h2_5b57614c22b0_5c2c66f702b0",
+			"t13d1715h2_002f,0035,009c,009d,1301,1302,1303,c009,c00a,c013,c014,c02b,c02c,c02f,c030,cca8,cca9_0005,000a,000b,000d,0017,001c,0022,0023,002b,002d,0033,fe0d,ff01_0403,0503,0603,0804,0805,0806,0401,0501,0601,0203,0201",
+			"t13d1715h2_5b234860e130_e7cd4f1676b9",
+		)
+	})
+
+	t.Run("QUIC_Chrome124", func(t *testing.T) {
+		qch, err := ParseQUICClientHello(quicClientHelloTruth_Chrome124)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		testJA4EqualsTruth(t, &qch.ClientHello,
+			"q13d0311h3_55b375c5d22e_5a1f323ef56d",
+			"q13d0311h3_1301,1302,1303_000a,000d,001b,002b,002d,0033,0039,4469,fe0d_0403,0804,0401,0503,0805,0501,0806,0601,0201",
+			"q13d0311h3_55b375c5d22e_2010cd944cde",
+		)
+	})
+}
+
+func testJA4EqualsTruth(t *testing.T, ch *ClientHello, ja4, ja4r, ja4o string) {
+	if ch.JA4 != ja4 {
+		t.Errorf("JA4 mismatch, expecting %s, got %s", ja4, ch.JA4)
+	}
+
+	if ch.JA4R != ja4r {
+		t.Errorf("JA4_r mismatch, expecting %s, got %s", ja4r, ch.JA4R)
+	}
+
+	if ch.JA4O != ja4o {
+		t.Errorf("JA4_o mismatch, expecting %s, got %s", ja4o, ch.JA4O)
+	}
+}
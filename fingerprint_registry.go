@@ -0,0 +1,157 @@
+package clienthellod
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Names of the built-in fingerprint algorithms.
+const (
+	FINGERPRINT_CLIENTHELLOD      = "clienthellod"      // native fingerprint ID (hex string)
+	FINGERPRINT_CLIENTHELLOD_NORM = "clienthellod_norm" // native normalized fingerprint ID (hex string), ClientHello only
+	FINGERPRINT_JA3               = "ja3"               // JA3 hash, ClientHello only
+	FINGERPRINT_JA4               = "ja4"
+	FINGERPRINT_JA4_R             = "ja4_r" // ClientHello only
+	FINGERPRINT_JA4_O             = "ja4_o" // ClientHello only
+
+	FINGERPRINT_QUIC                      = "clienthellod_quic"                 // native ID of the QUICFingerprint, QUIC only
+	FINGERPRINT_QUIC_CLIENT_INITIALS      = "clienthellod_client_initials"      // native ID of the gathered ClientInitials, QUIC only
+	FINGERPRINT_QUIC_TRANSPORT_PARAMETERS = "clienthellod_transport_parameters" // native ID of the QUIC Transport Parameters, QUIC only
+)
+
+// FingerprintSet maps the name of each registered fingerprint algorithm to
+// the fingerprint ID it calculated.
+type FingerprintSet map[string]string
+
+// ClientHelloFingerprintFunc calculates a fingerprint ID of a parsed ClientHello.
+// It returns an empty string if the algorithm is not applicable to the ClientHello,
+// in which case the algorithm will be omitted from the FingerprintSet.
+type ClientHelloFingerprintFunc func(ch *ClientHello) string
+
+// QUICFingerprintFunc calculates a fingerprint ID of a QUICFingerprint.
+// It returns an empty string if the algorithm is not applicable to the QUICFingerprint,
+// in which case the algorithm will be omitted from the FingerprintSet.
+type QUICFingerprintFunc func(qfp *QUICFingerprint) string
+
+var (
+	ErrFingerprintAlgorithmRegistered = errors.New("fingerprint algorithm already registered")
+	ErrFingerprintAlgorithmInvalid    = errors.New("fingerprint algorithm must have a non-empty name and a non-nil function")
+)
+
+var (
+	fingerprintRegistryMutex sync.RWMutex
+
+	clientHelloFingerprintAlgorithms = map[string]ClientHelloFingerprintFunc{
+		FINGERPRINT_CLIENTHELLOD:      func(ch *ClientHello) string { return ch.HexID },
+		FINGERPRINT_CLIENTHELLOD_NORM: func(ch *ClientHello) string { return ch.NormHexID },
+		FINGERPRINT_JA3:               func(ch *ClientHello) string { return ch.JA3Hash },
+		FINGERPRINT_JA4:               func(ch *ClientHello) string { return ch.JA4 },
+		FINGERPRINT_JA4_R:             func(ch *ClientHello) string { return ch.JA4R },
+		FINGERPRINT_JA4_O:             func(ch *ClientHello) string { return ch.JA4O },
+	}
+
+	quicFingerprintAlgorithms = map[string]QUICFingerprintFunc{
+		FINGERPRINT_QUIC: func(qfp *QUICFingerprint) string { return qfp.HexID },
+		FINGERPRINT_JA4:  func(qfp *QUICFingerprint) string { return qfp.JA4 },
+		FINGERPRINT_QUIC_CLIENT_INITIALS: func(qfp *QUICFingerprint) string {
+			return qfp.ClientInitials.HexID
+		},
+		FINGERPRINT_QUIC_TRANSPORT_PARAMETERS: func(qfp *QUICFingerprint) string {
+			if qfp.ClientInitials.TransportParameters == nil {
+				return ""
+			}
+			return qfp.ClientInitials.TransportParameters.HexID
+		},
+	}
+)
+
+// RegisterClientHelloFingerprint registers a named fingerprint algorithm to be
+// calculated for every ClientHello parsed after the registration.
+//
+// It returns ErrFingerprintAlgorithmRegistered if an algorithm with the same
+// name has already been registered.
+func RegisterClientHelloFingerprint(name string, fn ClientHelloFingerprintFunc) error {
+	if name == "" || fn == nil {
+		return ErrFingerprintAlgorithmInvalid
+	}
+
+	fingerprintRegistryMutex.Lock()
+	defer fingerprintRegistryMutex.Unlock()
+
+	if _, ok := clientHelloFingerprintAlgorithms[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFingerprintAlgorithmRegistered, name)
+	}
+	clientHelloFingerprintAlgorithms[name] = fn
+	return nil
+}
+
+// UnregisterClientHelloFingerprint removes a named fingerprint algorithm for
+// ClientHello, including a built-in one. It is a no-op if no algorithm is
+// registered with the name.
+func UnregisterClientHelloFingerprint(name string) {
+	fingerprintRegistryMutex.Lock()
+	defer fingerprintRegistryMutex.Unlock()
+
+	delete(clientHelloFingerprintAlgorithms, name)
+}
+
+// RegisterQUICFingerprint registers a named fingerprint algorithm to be
+// calculated for every QUICFingerprint generated after the registration.
+//
+// It returns ErrFingerprintAlgorithmRegistered if an algorithm with the same
+// name has already been registered.
+func RegisterQUICFingerprint(name string, fn QUICFingerprintFunc) error {
+	if name == "" || fn == nil {
+		return ErrFingerprintAlgorithmInvalid
+	}
+
+	fingerprintRegistryMutex.Lock()
+	defer fingerprintRegistryMutex.Unlock()
+
+	if _, ok := quicFingerprintAlgorithms[name]; ok {
+		return fmt.Errorf("%w: %s", ErrFingerprintAlgorithmRegistered, name)
+	}
+	quicFingerprintAlgorithms[name] = fn
+	return nil
+}
+
+// UnregisterQUICFingerprint removes a named fingerprint algorithm for
+// QUICFingerprint, including a built-in one. It is a no-op if no algorithm
+// is registered with the name.
+func UnregisterQUICFingerprint(name string) {
+	fingerprintRegistryMutex.Lock()
+	defer fingerprintRegistryMutex.Unlock()
+
+	delete(quicFingerprintAlgorithms, name)
+}
+
+// calcFingerprintSet calculates the fingerprint IDs of this client hello with
+// all registered algorithms.
+func (ch *ClientHello) calcFingerprintSet() FingerprintSet {
+	fingerprintRegistryMutex.RLock()
+	defer fingerprintRegistryMutex.RUnlock()
+
+	fps := make(FingerprintSet, len(clientHelloFingerprintAlgorithms))
+	for name, fn := range clientHelloFingerprintAlgorithms {
+		if id := fn(ch); id != "" {
+			fps[name] = id
+		}
+	}
+	return fps
+}
+
+// calcFingerprintSet calculates the fingerprint IDs of this QUIC fingerprint
+// with all registered algorithms.
+func (qfp *QUICFingerprint) calcFingerprintSet() FingerprintSet {
+	fingerprintRegistryMutex.RLock()
+	defer fingerprintRegistryMutex.RUnlock()
+
+	fps := make(FingerprintSet, len(quicFingerprintAlgorithms))
+	for name, fn := range quicFingerprintAlgorithms {
+		if id := fn(qfp); id != "" {
+			fps[name] = id
+		}
+	}
+	return fps
+}
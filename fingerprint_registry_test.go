@@ -0,0 +1,97 @@
+package clienthellod_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+)
+
+func TestRegisterClientHelloFingerprint(t *testing.T) {
+	const customName = "test_cipher_count"
+
+	if err := RegisterClientHelloFingerprint(customName, func(ch *ClientHello) string {
+		return strconv.Itoa(len(ch.CipherSuites))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterClientHelloFingerprint(customName) })
+
+	if err := RegisterClientHelloFingerprint(customName, func(*ClientHello) string { return "" }); !errors.Is(err, ErrFingerprintAlgorithmRegistered) {
+		t.Fatalf("expecting ErrFingerprintAlgorithmRegistered, got %v", err)
+	}
+
+	if err := RegisterClientHelloFingerprint("", nil); !errors.Is(err, ErrFingerprintAlgorithmInvalid) {
+		t.Fatalf("expecting ErrFingerprintAlgorithmInvalid, got %v", err)
+	}
+
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, truth := range map[string]string{
+		FINGERPRINT_CLIENTHELLOD:      ch.HexID,
+		FINGERPRINT_CLIENTHELLOD_NORM: ch.NormHexID,
+		FINGERPRINT_JA3:               "b5001237acdf006056b409cc433726b0",
+		FINGERPRINT_JA4:               "t13d1715h2_5b57614c22b0_5c2c66f702b0",
+		customName:                    "17",
+	} {
+		if ch.Fingerprints[name] != truth {
+			t.Errorf("fingerprint %s mismatch, expecting %s, got %s", name, truth, ch.Fingerprints[name])
+		}
+	}
+
+	UnregisterClientHelloFingerprint(customName)
+	ch, err = UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ch.Fingerprints[customName]; ok {
+		t.Errorf("fingerprint %s is still calculated after being unregistered", customName)
+	}
+}
+
+func TestRegisterQUICFingerprint(t *testing.T) {
+	const customName = "test_packet_count"
+
+	if err := RegisterQUICFingerprint(customName, func(qfp *QUICFingerprint) string {
+		return strconv.Itoa(len(qfp.ClientInitials.Packets))
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { UnregisterQUICFingerprint(customName) })
+
+	gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+	for _, d := range mapGatheredClientInitials["Chrome125"] {
+		cip, err := UnmarshalQUICClientInitialPacket(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = gci.AddPacket(cip); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	qfp, err := GenerateQUICFingerprint(gci)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, truth := range map[string]string{
+		FINGERPRINT_QUIC:                      qfp.HexID,
+		FINGERPRINT_JA4:                       qfp.JA4,
+		FINGERPRINT_QUIC_CLIENT_INITIALS:      gci.HexID,
+		FINGERPRINT_QUIC_TRANSPORT_PARAMETERS: gci.TransportParameters.HexID,
+		customName:                            "2",
+	} {
+		if qfp.Fingerprints[name] != truth {
+			t.Errorf("fingerprint %s mismatch, expecting %s, got %s", name, truth, qfp.Fingerprints[name])
+		}
+	}
+	if id, ok := qfp.Fingerprints[FINGERPRINT_CLIENTHELLOD]; ok { // reserved for the native ID of the ClientHello
+		t.Errorf("fingerprint %s is not expected for QUICFingerprint, got %s", FINGERPRINT_CLIENTHELLOD, id)
+	}
+}
@@ -0,0 +1,96 @@
+package clienthellod
+
+import (
+	"crypto/sha1" // skipcq: GSC-G505
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// FINGERPRINT_SCHEME_VERSION is the version of the field list and serialization
+// used by FingerprintScheme to calculate the native fingerprint ID of a ClientHello.
+//
+// It MUST be bumped whenever a change would alter IDs calculated with an
+// existing FingerprintScheme.
+const FINGERPRINT_SCHEME_VERSION = 1
+
+// FingerprintHash selects the hash function used by a FingerprintScheme.
+type FingerprintHash uint8
+
+const (
+	FINGERPRINT_HASH_SHA1   FingerprintHash = iota // SHA-1 truncated to 8 bytes, the legacy default
+	FINGERPRINT_HASH_SHA256                        // SHA-256, HexID will be the full-length hex string
+)
+
+// String returns the name of the hash function.
+func (fh FingerprintHash) String() string {
+	switch fh {
+	case FINGERPRINT_HASH_SHA1:
+		return "sha1"
+	case FINGERPRINT_HASH_SHA256:
+		return "sha256"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(fh))
+	}
+}
+
+// FingerprintScheme configures how the native fingerprint IDs (NumID, NormNumID,
+// HexID, NormHexID) of a ClientHello are calculated.
+//
+// The zero value is the legacy scheme which reproduces all IDs calculated
+// before FingerprintScheme was introduced.
+type FingerprintScheme struct {
+	Hash FingerprintHash
+
+	ExcludeALPN            bool // do not hash the ALPN extension content
+	ExcludePadding         bool // do not hash the padding(21) extension ID
+	IncludeSessionIDLength bool // hash the length of legacy_session_id
+}
+
+// String returns the identifier of the scheme, which is included in the output
+// of a ClientHello as FingerprintScheme. The legacy scheme is identified as "v1",
+// while any other scheme has its options appended, e.g., "v1/sha256/-alpn".
+func (fs FingerprintScheme) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "v%d", FINGERPRINT_SCHEME_VERSION)
+	if fs.Hash != FINGERPRINT_HASH_SHA1 {
+		sb.WriteString("/" + fs.Hash.String())
+	}
+	if fs.ExcludeALPN {
+		sb.WriteString("/-alpn")
+	}
+	if fs.ExcludePadding {
+		sb.WriteString("/-padding")
+	}
+	if fs.IncludeSessionIDLength {
+		sb.WriteString("/+session_id_length")
+	}
+	return sb.String()
+}
+
+func (fs FingerprintScheme) newHash() hash.Hash {
+	switch fs.Hash {
+	case FINGERPRINT_HASH_SHA256:
+		return sha256.New()
+	default:
+		return sha1.New() // skipcq: GO-S1025, GSC-G401
+	}
+}
+
+// filterExtensions returns the list of extension IDs to be hashed.
+func (fs FingerprintScheme) filterExtensions(extensions []uint16) []uint16 {
+	if !fs.ExcludePadding {
+		return extensions
+	}
+
+	filtered := make([]uint16, 0, len(extensions))
+	for _, ext := range extensions {
+		if ext != dicttls.ExtType_padding {
+			filtered = append(filtered, ext)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,152 @@
+package clienthellod_test
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+)
+
+// fingerprintSchemeCorpus pins the native fingerprint IDs of the test data under
+// each FingerprintScheme. IDs under the legacy scheme were calculated before
+// FingerprintScheme was introduced and MUST NOT change.
+var fingerprintSchemeCorpus = []struct {
+	scheme    FingerprintScheme
+	schemeID  string
+	hexID     map[string]string
+	normHexID map[string]string
+}{
+	{
+		scheme:   FingerprintScheme{},
+		schemeID: "v1",
+		hexID: map[string]string{
+			"TLS_Firefox126": "79562b48401fc449",
+			"QUIC_Chrome124": "4baa5f6b8666f5f3",
+		},
+		normHexID: map[string]string{
+			"TLS_Firefox126": "64142698e2e96ec5",
+			"QUIC_Chrome124": "c59ce307a3c96009",
+		},
+	},
+	{
+		scheme:   FingerprintScheme{Hash: FINGERPRINT_HASH_SHA256},
+		schemeID: "v1/sha256",
+		hexID: map[string]string{
+			"TLS_Firefox126": "bcc86a491f770ede763e9be7d3bea6ed7aefd7c0b310208be7f5c62f8097da3e",
+			"QUIC_Chrome124": "0a8e0912d3713f5201c5ec07d3141110f75c8e464a56f2a110af38ee3ba67f05",
+		},
+		normHexID: map[string]string{
+			"TLS_Firefox126": "fc2ef7202ac085def688aeb5037ce07f5196d8603ab9ebd563394127f2e914c4",
+			"QUIC_Chrome124": "bfaed20d706b0c05eaf49d8a128c455dc640014bf3a8bbd04c681398ef5c65cb",
+		},
+	},
+	{
+		scheme:   FingerprintScheme{ExcludeALPN: true, ExcludePadding: true, IncludeSessionIDLength: true},
+		schemeID: "v1/-alpn/-padding/+session_id_length",
+		hexID: map[string]string{
+			"TLS_Firefox126": "28a34f632176c86b",
+			"QUIC_Chrome124": "aed6d529cd709763",
+		},
+		normHexID: map[string]string{
+			"TLS_Firefox126": "1373308c673699d9",
+			"QUIC_Chrome124": "4c416e4e8cd8124f",
+		},
+	},
+}
+
+func TestFingerprintScheme(t *testing.T) {
+	samples := map[string]*ClientHello{}
+
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples["TLS_Firefox126"] = ch
+
+	qch, err := ParseQUICClientHello(quicClientHelloTruth_Chrome124)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples["QUIC_Chrome124"] = &qch.ClientHello
+
+	for _, c := range fingerprintSchemeCorpus {
+		t.Run(c.schemeID, func(t *testing.T) {
+			if c.scheme.String() != c.schemeID {
+				t.Errorf("scheme identifier mismatch, expecting %s, got %s", c.schemeID, c.scheme.String())
+			}
+
+			for name, ch := range samples {
+				hexID, normHexID := ch.FingerprintIDWithScheme(c.scheme)
+				if hexID != c.hexID[name] {
+					t.Errorf("%s: HexID mismatch, expecting %s, got %s", name, c.hexID[name], hexID)
+				}
+				if normHexID != c.normHexID[name] {
+					t.Errorf("%s: NormHexID mismatch, expecting %s, got %s", name, c.normHexID[name], normHexID)
+				}
+			}
+		})
+	}
+}
+
+func TestSetFingerprintScheme(t *testing.T) {
+	scheme := FingerprintScheme{Hash: FINGERPRINT_HASH_SHA256}
+
+	tfp := NewTLSFingerprinter()
+	defer tfp.Close()
+	tfp.SetFingerprintScheme(scheme)
+
+	if err := tfp.HandleMessage("test", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := tfp.Pop("test")
+	if ch == nil {
+		t.Fatal("ClientHello not found in TLSFingerprinter")
+	}
+
+	if ch.FingerprintScheme != "v1/sha256" {
+		t.Errorf("FingerprintScheme mismatch, expecting v1/sha256, got %s", ch.FingerprintScheme)
+	}
+
+	if ch.HexID != "bcc86a491f770ede763e9be7d3bea6ed7aefd7c0b310208be7f5c62f8097da3e" {
+		t.Errorf("HexID mismatch, got %s", ch.HexID)
+	}
+}
+
+// TestLegacyQUICFingerprintIDs ensures the QUIC fingerprint IDs, which depend on
+// the legacy ClientHello IDs, are not affected by FingerprintScheme.
+func TestLegacyQUICFingerprintIDs(t *testing.T) {
+	for name, truth := range map[string][3]string{ // ClientInitials, TransportParameters, QUICFingerprint
+		"Chrome125":        {"4abca7510c81152d", "909cd470e80b4ca2", "0d2a1ddd5d5c8795"},
+		"Firefox126":       {"1042b91912487919", "4cd75aaf98ff9e9b", "4110508e56df4fc1"},
+		"Firefox126_0-RTT": {"26dba2aef0acb113", "4cd75aaf98ff9e9b", "993e658861ed789c"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+			for _, d := range mapGatheredClientInitials[name] {
+				cip, err := UnmarshalQUICClientInitialPacket(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = gci.AddPacket(cip); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			qfp, err := GenerateQUICFingerprint(gci)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if gci.HexID != truth[0] {
+				t.Errorf("ClientInitials HexID mismatch, expecting %s, got %s", truth[0], gci.HexID)
+			}
+			if gci.TransportParameters.HexID != truth[1] {
+				t.Errorf("TransportParameters HexID mismatch, expecting %s, got %s", truth[1], gci.TransportParameters.HexID)
+			}
+			if qfp.HexID != truth[2] {
+				t.Errorf("QUICFingerprint HexID mismatch, expecting %s, got %s", truth[2], qfp.HexID)
+			}
+		})
+	}
+}
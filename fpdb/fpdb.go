@@ -0,0 +1,302 @@
+// Package fpdb provides a database of known fingerprints, mapping the
+// fingerprint IDs calculated by clienthellod (native IDs, JA3, JA4, etc.) to
+// labels describing the client, e.g., browser, library, OS and versions.
+package fpdb
+
+import (
+	"bytes"
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gaukas/clienthellod"
+)
+
+// Protocols a Record may be observed over.
+const (
+	PROTOCOL_TLS  = "tls"
+	PROTOCOL_QUIC = "quic"
+)
+
+// Kinds of clients.
+const (
+	KIND_BROWSER = "browser"
+	KIND_LIBRARY = "library"
+	KIND_TOOL    = "tool"
+)
+
+// Label describes a client.
+type Label struct {
+	Client     string `json:"client"`                // e.g., "Firefox", "Go crypto/tls"
+	Kind       string `json:"kind,omitempty"`        // e.g., KIND_BROWSER
+	OS         string `json:"os,omitempty"`          // e.g., "Windows", empty if any
+	MinVersion string `json:"min_version,omitempty"` // earliest version of the client known to send the fingerprint
+	MaxVersion string `json:"max_version,omitempty"` // latest version of the client known to send the fingerprint
+	FirstSeen  string `json:"first_seen,omitempty"`  // date in ISO 8601, e.g., "2024-05-14"
+	LastSeen   string `json:"last_seen,omitempty"`   // date in ISO 8601, e.g., "2024-06-11"
+	Notes      string `json:"notes,omitempty"`
+	Source     string `json:"source,omitempty"` // where the record came from, e.g., "tlsfingerprint.io"
+}
+
+// Record is a known fingerprint of a client, identified by one or more
+// fingerprint IDs.
+type Record struct {
+	Protocol     string                      `json:"protocol,omitempty"` // PROTOCOL_TLS or PROTOCOL_QUIC, empty if both
+	Fingerprints clienthellod.FingerprintSet `json:"fingerprints"`       // keyed by the names of fingerprint algorithms, e.g., clienthellod.FINGERPRINT_JA4
+	Label
+}
+
+// Match is a Record matched by a lookup.
+type Match struct {
+	Algorithm string `json:"algorithm"` // name of the fingerprint algorithm matched
+	*Record
+}
+
+// DB is a database of known fingerprints. It is safe for concurrent use.
+type DB struct {
+	mutex   sync.RWMutex
+	records []*Record
+	index   map[string]map[string][]*Record // algorithm -> fingerprint ID -> records
+}
+
+// New creates a new empty DB.
+func New() *DB {
+	return &DB{
+		index: make(map[string]map[string][]*Record),
+	}
+}
+
+//go:embed known_fingerprints.json
+var embeddedDataset []byte
+
+// Default creates a new DB loaded with the dataset embedded in this package.
+//
+// The embedded dataset is small and covers only the clients captured in the
+// test data of clienthellod. More datasets can be merged with LoadJSON and
+// LoadCSV.
+func Default() *DB {
+	db := New()
+	if err := db.LoadJSON(bytes.NewReader(embeddedDataset)); err != nil {
+		panic("fpdb: invalid embedded dataset: " + err.Error())
+	}
+	return db
+}
+
+// ClientHelloLookupOrder is the order of fingerprint algorithms to look up a
+// ClientHello with, from the most specific to the least specific.
+var ClientHelloLookupOrder = []string{
+	clienthellod.FINGERPRINT_CLIENTHELLOD,
+	clienthellod.FINGERPRINT_CLIENTHELLOD_NORM,
+	clienthellod.FINGERPRINT_JA4_O,
+	clienthellod.FINGERPRINT_JA4,
+	clienthellod.FINGERPRINT_JA3,
+}
+
+// QUICFingerprintLookupOrder is the order of fingerprint algorithms to look up
+// a QUICFingerprint with, from the most specific to the least specific.
+var QUICFingerprintLookupOrder = []string{
+	clienthellod.FINGERPRINT_QUIC,
+	clienthellod.FINGERPRINT_JA4,
+}
+
+// Add adds a record to the DB.
+//
+// If a record with the same protocol and label shares any fingerprint ID with
+// it, the two are merged: fingerprint IDs are combined, and the version range
+// and the first/last seen dates are extended to cover both. Records with
+// different IDs calculated by the same algorithm are never merged, so every
+// ID added stays searchable.
+func (db *DB) Add(r *Record) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.add(r)
+}
+
+func (db *DB) add(r *Record) {
+	for algorithm, id := range r.Fingerprints {
+		for _, existing := range db.index[algorithm][id] {
+			if existing.Protocol == r.Protocol && existing.sameClient(&r.Label) && !existing.conflicts(r) {
+				existing.merge(r)
+				db.indexRecord(existing)
+				return
+			}
+		}
+	}
+
+	rec := *r
+	rec.Fingerprints = make(clienthellod.FingerprintSet, len(r.Fingerprints))
+	for algorithm, id := range r.Fingerprints {
+		rec.Fingerprints[algorithm] = id
+	}
+	db.records = append(db.records, &rec)
+	db.indexRecord(&rec)
+}
+
+func (db *DB) indexRecord(r *Record) {
+	for algorithm, id := range r.Fingerprints {
+		if db.index[algorithm] == nil {
+			db.index[algorithm] = make(map[string][]*Record)
+		}
+		indexed := false
+		for _, existing := range db.index[algorithm][id] {
+			if existing == r {
+				indexed = true
+				break
+			}
+		}
+		if !indexed {
+			db.index[algorithm][id] = append(db.index[algorithm][id], r)
+		}
+	}
+}
+
+// Merge adds all records in another DB to this DB.
+func (db *DB) Merge(other *DB) {
+	other.mutex.RLock()
+	records := append([]*Record{}, other.records...)
+	other.mutex.RUnlock()
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, r := range records {
+		db.add(r)
+	}
+}
+
+// Len returns the number of records in the DB.
+func (db *DB) Len() int {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	return len(db.records)
+}
+
+// Lookup returns all records with the fingerprint ID calculated by the named
+// algorithm, over the given protocol. Records with no protocol match any
+// protocol, and so does an empty protocol.
+//
+// The returned records are shared with the DB and must not be modified.
+func (db *DB) Lookup(protocol, algorithm, id string) []*Record {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var records []*Record
+	for _, r := range db.index[algorithm][id] {
+		if protocol == "" || r.Protocol == "" || r.Protocol == protocol {
+			records = append(records, r)
+		}
+	}
+	return records
+}
+
+// LookupClientHello looks up a parsed ClientHello with the fingerprint
+// algorithms in ClientHelloLookupOrder, and returns all records matched by
+// the first algorithm with any match, or nil if none is found.
+func (db *DB) LookupClientHello(ch *clienthellod.ClientHello) []*Match {
+	protocol := PROTOCOL_TLS
+	if strings.HasPrefix(ch.JA4, "q") { // QUIC ClientHello
+		protocol = PROTOCOL_QUIC
+	}
+	return db.lookupFingerprintSet(protocol, ch.Fingerprints, ClientHelloLookupOrder)
+}
+
+// LookupQUICFingerprint looks up a QUICFingerprint with the fingerprint
+// algorithms in QUICFingerprintLookupOrder, and returns all records matched by
+// the first algorithm with any match, or nil if none is found.
+func (db *DB) LookupQUICFingerprint(qfp *clienthellod.QUICFingerprint) []*Match {
+	return db.lookupFingerprintSet(PROTOCOL_QUIC, qfp.Fingerprints, QUICFingerprintLookupOrder)
+}
+
+func (db *DB) lookupFingerprintSet(protocol string, fs clienthellod.FingerprintSet, order []string) []*Match {
+	for _, algorithm := range order {
+		id, ok := fs[algorithm]
+		if !ok || id == "" {
+			continue
+		}
+
+		records := db.Lookup(protocol, algorithm, id)
+		if len(records) == 0 {
+			continue
+		}
+		matches := make([]*Match, 0, len(records))
+		for _, r := range records {
+			matches = append(matches, &Match{Algorithm: algorithm, Record: r})
+		}
+		return matches
+	}
+	return nil
+}
+
+// sameClient reports whether the two labels describe the same client,
+// regardless of the versions and dates.
+func (l *Label) sameClient(other *Label) bool {
+	return l.Client == other.Client && l.Kind == other.Kind && l.OS == other.OS && l.Notes == other.Notes
+}
+
+// conflicts reports whether the two records have different IDs calculated by
+// the same fingerprint algorithm.
+func (r *Record) conflicts(other *Record) bool {
+	for algorithm, id := range other.Fingerprints {
+		if existing, ok := r.Fingerprints[algorithm]; ok && existing != id {
+			return true
+		}
+	}
+	return false
+}
+
+// merge merges another record of the same client into r. The two records
+// must not conflict.
+func (r *Record) merge(other *Record) {
+	for algorithm, id := range other.Fingerprints {
+		r.Fingerprints[algorithm] = id
+	}
+
+	if other.MinVersion != "" && (r.MinVersion == "" || compareVersions(other.MinVersion, r.MinVersion) < 0) {
+		r.MinVersion = other.MinVersion
+	}
+	if other.MaxVersion != "" && (r.MaxVersion == "" || compareVersions(other.MaxVersion, r.MaxVersion) > 0) {
+		r.MaxVersion = other.MaxVersion
+	}
+	if other.FirstSeen != "" && (r.FirstSeen == "" || other.FirstSeen < r.FirstSeen) {
+		r.FirstSeen = other.FirstSeen
+	}
+	if other.LastSeen != "" && (r.LastSeen == "" || other.LastSeen > r.LastSeen) {
+		r.LastSeen = other.LastSeen
+	}
+	if r.Source == "" {
+		r.Source = other.Source
+	}
+}
+
+// compareVersions compares two dot-separated versions, numerically for the
+// parts that are numbers in both, e.g., "9.1" < "10.0".
+func compareVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+		switch {
+		case errA == nil && errB == nil:
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		case partsA[i] != partsB[i]:
+			if partsA[i] < partsB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(partsA) < len(partsB):
+		return -1
+	case len(partsA) > len(partsB):
+		return 1
+	}
+	return 0
+}
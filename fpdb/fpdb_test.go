@@ -0,0 +1,162 @@
+package fpdb_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gaukas/clienthellod"
+	. "github.com/gaukas/clienthellod/fpdb"
+)
+
+func TestDefault(t *testing.T) {
+	db := Default()
+	if db.Len() == 0 {
+		t.Fatal("embedded dataset is empty")
+	}
+
+	t.Run("ClientHello", func(t *testing.T) {
+		raw, err := os.ReadFile("../internal/testdata/TLS_ClientHello_Firefox_126.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := clienthellod.UnmarshalClientHello(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches := db.LookupClientHello(ch)
+		if len(matches) != 1 {
+			t.Fatalf("exactly one match is expected, got %d", len(matches))
+		}
+		if matches[0].Client != "Firefox" || matches[0].MinVersion != "126" || matches[0].Algorithm != clienthellod.FINGERPRINT_CLIENTHELLOD {
+			t.Errorf("Firefox 126 is expected to match by native ID, got %+v", matches[0])
+		}
+	})
+
+	t.Run("QUICFingerprint", func(t *testing.T) {
+		raw, err := os.ReadFile("../internal/testdata/QUIC_IETF_Firefox_126.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		gci := clienthellod.GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+		cip, err := clienthellod.UnmarshalQUICClientInitialPacket(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = gci.AddPacket(cip); err != nil {
+			t.Fatal(err)
+		}
+		qfp, err := clienthellod.GenerateQUICFingerprint(gci)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches := db.LookupQUICFingerprint(qfp)
+		if len(matches) != 1 || matches[0].Client != "Firefox" || matches[0].Protocol != PROTOCOL_QUIC || matches[0].Notes != "" || matches[0].Algorithm != clienthellod.FINGERPRINT_QUIC {
+			t.Errorf("Firefox 126 over QUIC is expected to match by native ID, got %v", matches)
+		}
+
+		// the native IDs of the QUICFingerprint and of its ClientHello never cross-match
+		if records := db.Lookup(PROTOCOL_QUIC, clienthellod.FINGERPRINT_CLIENTHELLOD, qfp.HexID); len(records) != 0 {
+			t.Errorf("native ID of QUICFingerprint is not expected to match a ClientHello, got %v", records)
+		}
+		if records := db.Lookup(PROTOCOL_QUIC, clienthellod.FINGERPRINT_QUIC, gci.ClientHello.HexID); len(records) != 0 {
+			t.Errorf("native ID of ClientHello is not expected to match a QUICFingerprint, got %v", records)
+		}
+	})
+}
+
+func TestDB(t *testing.T) {
+	db := New()
+	err := db.LoadJSON(strings.NewReader(`[
+		{"client": "Firefox", "kind": "browser", "min_version": "126", "max_version": "126", "last_seen": "2024-06-01", "ja4": "t13d1715h2_5b57614c22b0_5c2c66f702b0"},
+		{"client": "curl", "kind": "tool", "protocol": "tls", "fingerprints": {"ja3": "0123456789abcdef0123456789abcdef"}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.LoadCSV(strings.NewReader(`client,kind,min_version,max_version,first_seen,last_seen,ja4,norm_hex_id,count
+Firefox,browser,9.1,127,2023-01-01,2024-07-01,t13d1715h2_5b57614c22b0_5c2c66f702b0,64142698e2e96ec5,42
+Go crypto/tls,library,1.21,1.22,,,t13d1311h1_e8f1e7e78f70_b26ce05bbdd6,,1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if db.Len() != 3 {
+		t.Fatalf("3 records are expected after merging, got %d", db.Len())
+	}
+
+	records := db.Lookup(PROTOCOL_TLS, clienthellod.FINGERPRINT_CLIENTHELLOD_NORM, "64142698e2e96ec5")
+	if len(records) != 1 {
+		t.Fatalf("exactly one record is expected, got %d", len(records))
+	}
+	firefox := records[0]
+	if firefox.MinVersion != "9.1" || firefox.MaxVersion != "127" || firefox.FirstSeen != "2023-01-01" || firefox.LastSeen != "2024-07-01" {
+		t.Errorf("merged record is expected to cover both, got %+v", firefox.Label)
+	}
+	if firefox.Fingerprints[clienthellod.FINGERPRINT_JA4] != "t13d1715h2_5b57614c22b0_5c2c66f702b0" {
+		t.Errorf("merged record is expected to keep JA4, got %v", firefox.Fingerprints)
+	}
+
+	if records := db.Lookup(PROTOCOL_QUIC, clienthellod.FINGERPRINT_JA3, "0123456789abcdef0123456789abcdef"); len(records) != 0 {
+		t.Errorf("TLS-only record is not expected to match QUIC, got %v", records)
+	}
+
+	merged := Default()
+	merged.Merge(db)
+	if merged.Len() != Default().Len()+3 { // records of any protocol are not merged into those of TLS
+		t.Errorf("unexpected number of records after merging, got %d", merged.Len())
+	}
+
+	t.Run("Conflict", func(t *testing.T) {
+		db := New()
+		err := db.LoadJSON(strings.NewReader(`[
+			{"client": "Chrome", "kind": "browser", "min_version": "124", "fingerprints": {"ja4": "t13d1516h2_8daaf6152771_02713d6af862", "clienthellod": "0123456789abcdef"}},
+			{"client": "Chrome", "kind": "browser", "min_version": "125", "fingerprints": {"ja4": "t13d1516h2_8daaf6152771_02713d6af862", "clienthellod": "fedcba9876543210"}}
+		]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.Len() != 2 {
+			t.Fatalf("records with conflicting IDs are not expected to be merged, got %d records", db.Len())
+		}
+		for _, id := range []string{"0123456789abcdef", "fedcba9876543210"} {
+			if records := db.Lookup(PROTOCOL_TLS, clienthellod.FINGERPRINT_CLIENTHELLOD, id); len(records) != 1 {
+				t.Errorf("native ID %s is expected to match exactly one record, got %d", id, len(records))
+			}
+		}
+		if records := db.Lookup(PROTOCOL_TLS, clienthellod.FINGERPRINT_JA4, "t13d1516h2_8daaf6152771_02713d6af862"); len(records) != 2 {
+			t.Errorf("shared JA4 is expected to match both records, got %d", len(records))
+		}
+	})
+
+	t.Run("QUICFingerprintJSON", func(t *testing.T) {
+		db := New()
+		err := db.LoadJSON(strings.NewReader(`[
+			{"client": "Firefox", "protocol": "quic", "ClientInitials": {}, "hex_id": "4110508e56df4fc1"}
+		]`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if records := db.Lookup(PROTOCOL_QUIC, clienthellod.FINGERPRINT_QUIC, "4110508e56df4fc1"); len(records) != 1 {
+			t.Errorf("hex_id of QUICFingerprint is expected to be loaded as %s, got %d records", clienthellod.FINGERPRINT_QUIC, len(records))
+		}
+		if records := db.Lookup(PROTOCOL_QUIC, clienthellod.FINGERPRINT_CLIENTHELLOD, "4110508e56df4fc1"); len(records) != 0 {
+			t.Errorf("hex_id of QUICFingerprint is not expected to be loaded as %s, got %d records", clienthellod.FINGERPRINT_CLIENTHELLOD, len(records))
+		}
+	})
+
+	for _, invalid := range []string{
+		`[{"ja4": "t13d1715h2_5b57614c22b0_5c2c66f702b0"}]`,
+		`[{"client": "Firefox"}]`,
+		`[{"client": "Firefox", "protocol": "dtls", "ja4": "d13d1715h2_5b57614c22b0_5c2c66f702b0"}]`,
+	} {
+		if err := New().LoadJSON(strings.NewReader(invalid)); err == nil {
+			t.Errorf("invalid record %s is expected to fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package fpdb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gaukas/clienthellod"
+)
+
+// fingerprintAliases maps the JSON field names of fingerprint IDs in the
+// output of clienthellod to the names of the fingerprint algorithms.
+var fingerprintAliases = map[string]string{
+	"hex_id":      clienthellod.FINGERPRINT_CLIENTHELLOD,
+	"norm_hex_id": clienthellod.FINGERPRINT_CLIENTHELLOD_NORM,
+	"ja3_hash":    clienthellod.FINGERPRINT_JA3,
+}
+
+// csvFingerprintAlgorithms are the fingerprint algorithms accepted as CSV
+// columns. IDs of custom algorithms can only be loaded from JSON.
+var csvFingerprintAlgorithms = map[string]bool{
+	clienthellod.FINGERPRINT_CLIENTHELLOD:              true,
+	clienthellod.FINGERPRINT_CLIENTHELLOD_NORM:         true,
+	clienthellod.FINGERPRINT_JA3:                       true,
+	clienthellod.FINGERPRINT_JA4:                       true,
+	clienthellod.FINGERPRINT_JA4_R:                     true,
+	clienthellod.FINGERPRINT_JA4_O:                     true,
+	clienthellod.FINGERPRINT_QUIC:                      true,
+	clienthellod.FINGERPRINT_QUIC_CLIENT_INITIALS:      true,
+	clienthellod.FINGERPRINT_QUIC_TRANSPORT_PARAMETERS: true,
+}
+
+// jsonRecord is a Record in JSON, which also accepts the fingerprint IDs as
+// top-level fields as in the JSON output of a ClientHello or QUICFingerprint.
+type jsonRecord struct {
+	Record
+
+	ClientInitials json.RawMessage `json:"ClientInitials"` // only in the output of a QUICFingerprint
+
+	HexID     string `json:"hex_id"`
+	NormHexID string `json:"norm_hex_id"`
+	JA3Hash   string `json:"ja3_hash"`
+	JA4       string `json:"ja4"`
+	JA4R      string `json:"ja4_r"`
+	JA4O      string `json:"ja4_o"`
+}
+
+// LoadJSON loads records from a JSON array and merges them into the DB.
+//
+// Each record is an object with the fields of a Label, an optional protocol,
+// and the fingerprint IDs in a "fingerprints" object keyed by algorithm
+// names. Fingerprint IDs may also be given as the top-level fields hex_id,
+// norm_hex_id, ja3_hash, ja4, ja4_r and ja4_o, so the JSON output of
+// clienthellod (e.g., collected from tlsfingerprint.io) can be loaded as-is
+// once labeled with a client. The hex_id of a QUICFingerprint, told apart by
+// its ClientInitials, is loaded as clienthellod.FINGERPRINT_QUIC.
+func (db *DB) LoadJSON(r io.Reader) error {
+	var jsonRecords []jsonRecord
+	if err := json.NewDecoder(r).Decode(&jsonRecords); err != nil {
+		return fmt.Errorf("fpdb: failed to decode JSON: %w", err)
+	}
+
+	records := make([]*Record, 0, len(jsonRecords))
+	for i := range jsonRecords {
+		jr := &jsonRecords[i]
+		rec := jr.Record
+		if rec.Fingerprints == nil {
+			rec.Fingerprints = make(clienthellod.FingerprintSet)
+		}
+		hexIDAlgorithm := clienthellod.FINGERPRINT_CLIENTHELLOD
+		if len(jr.ClientInitials) != 0 { // hex_id of a QUICFingerprint
+			hexIDAlgorithm = clienthellod.FINGERPRINT_QUIC
+		}
+		for algorithm, id := range map[string]string{
+			hexIDAlgorithm: jr.HexID,
+			clienthellod.FINGERPRINT_CLIENTHELLOD_NORM: jr.NormHexID,
+			clienthellod.FINGERPRINT_JA3:               jr.JA3Hash,
+			clienthellod.FINGERPRINT_JA4:               jr.JA4,
+			clienthellod.FINGERPRINT_JA4_R:             jr.JA4R,
+			clienthellod.FINGERPRINT_JA4_O:             jr.JA4O,
+		} {
+			if _, ok := rec.Fingerprints[algorithm]; !ok && id != "" {
+				rec.Fingerprints[algorithm] = id
+			}
+		}
+
+		if err := validateRecord(&rec); err != nil {
+			return fmt.Errorf("fpdb: invalid record #%d: %w", i, err)
+		}
+		records = append(records, &rec)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, rec := range records {
+		db.add(rec)
+	}
+	return nil
+}
+
+// LoadCSV loads records from CSV with a header row and merges them into the
+// DB.
+//
+// Columns are matched by the header: the JSON field names of a Label and
+// "protocol" fill the label, and columns named after fingerprint algorithms
+// (e.g., "ja3", "ja4", "clienthellod_norm") or after the JSON field names of
+// fingerprint IDs in the output of clienthellod (e.g., "ja3_hash",
+// "norm_hex_id") give the fingerprint IDs. Other columns, including those of
+// custom fingerprint algorithms, are ignored.
+func (db *DB) LoadCSV(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("fpdb: failed to read CSV header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var records []*Record
+	for line := 2; ; line++ {
+		row, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("fpdb: failed to read CSV: %w", err)
+		}
+
+		rec := &Record{Fingerprints: make(clienthellod.FingerprintSet)}
+		for i, value := range row {
+			if i >= len(header) || value == "" {
+				continue
+			}
+			setCSVField(rec, header[i], value)
+		}
+
+		if err := validateRecord(rec); err != nil {
+			return fmt.Errorf("fpdb: invalid record on line %d: %w", line, err)
+		}
+		records = append(records, rec)
+	}
+
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for _, rec := range records {
+		db.add(rec)
+	}
+	return nil
+}
+
+// LoadFile loads records from a file and merges them into the DB, as CSV if
+// the file name ends with ".csv", otherwise as JSON.
+func (db *DB) LoadFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(name), ".csv") {
+		return db.LoadCSV(f)
+	}
+	return db.LoadJSON(f)
+}
+
+func setCSVField(rec *Record, column, value string) { // skipcq: GO-R1005
+	switch column {
+	case "protocol":
+		rec.Protocol = strings.ToLower(value)
+	case "client":
+		rec.Client = value
+	case "kind":
+		rec.Kind = strings.ToLower(value)
+	case "os":
+		rec.OS = value
+	case "min_version":
+		rec.MinVersion = value
+	case "max_version":
+		rec.MaxVersion = value
+	case "first_seen":
+		rec.FirstSeen = value
+	case "last_seen":
+		rec.LastSeen = value
+	case "notes":
+		rec.Notes = value
+	case "source":
+		rec.Source = value
+	default:
+		if algorithm, ok := fingerprintAliases[column]; ok {
+			column = algorithm
+		}
+		if csvFingerprintAlgorithms[column] {
+			rec.Fingerprints[column] = value
+		}
+	}
+}
+
+func validateRecord(rec *Record) error {
+	if rec.Client == "" {
+		return errors.New("missing client")
+	}
+	if len(rec.Fingerprints) == 0 {
+		return errors.New("missing fingerprint ID")
+	}
+	switch rec.Protocol {
+	case "", PROTOCOL_TLS, PROTOCOL_QUIC:
+	default:
+		return fmt.Errorf("unknown protocol %q", rec.Protocol)
+	}
+	return nil
+}
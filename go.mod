@@ -6,6 +6,7 @@ toolchain go1.22.3
 
 require (
 	github.com/caddyserver/caddy/v2 v2.8.4
+	github.com/cloudflare/circl v1.3.7
 	github.com/google/gopacket v1.1.19
 	github.com/refraction-networking/utls v1.6.6
 	go.uber.org/zap v1.27.0
@@ -29,7 +30,6 @@ require (
 	github.com/cespare/xxhash v1.1.0 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/chzyer/readline v1.5.1 // indirect
-	github.com/cloudflare/circl v1.3.7 // indirect
 	github.com/cpuguy83/go-md2man/v2 v2.0.3 // indirect
 	github.com/dgraph-io/badger v1.6.2 // indirect
 	github.com/dgraph-io/badger/v2 v2.2007.4 // indirect
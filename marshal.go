@@ -0,0 +1,329 @@
+package clienthellod
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// MarshalOptions configures how Marshal encodes a ClientHello, a
+// QUICFingerprint or any other value into JSON.
+type MarshalOptions struct {
+	// Annotated replaces each code point, e.g., a cipher suite, an extension
+	// or a QUIC transport parameter ID, with an AnnotatedCodePoint pairing it
+	// with its IANA name and flagging GREASE values.
+	Annotated bool
+
+	// Indent, if not empty, is used to indent the output as json.MarshalIndent.
+	Indent string
+}
+
+// AnnotatedCodePoint is a code point in the annotated JSON output.
+type AnnotatedCodePoint struct {
+	Value  uint64 `json:"value"`
+	Name   string `json:"name,omitempty"` // IANA name, empty if unknown
+	GREASE bool   `json:"grease,omitempty"`
+}
+
+// Marshal encodes v into JSON with the options. Field order is preserved.
+func (o MarshalOptions) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Annotated {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		tree, err := decodeOrderedJSON(dec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode JSON for annotation: %w", err)
+		}
+		if b, err = json.Marshal(annotateJSON(tree)); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.Indent == "" {
+		return b, nil
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, b, "", o.Indent); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// codePointAnnotator names a code point and tells if it is a GREASE value.
+type codePointAnnotator func(v uint64) (name string, grease bool)
+
+// codePointAnnotators are keyed by the JSON field names of code points.
+var codePointAnnotators = map[string]codePointAnnotator{
+	"tls_record_version":     annotateVersion,
+	"tls_handshake_version":  annotateVersion,
+	"supported_versions":     annotateVersion,
+	"cipher_suites":          annotateUint16(dicttls.DictCipherSuiteValueIndexed),
+	"extensions":             annotateUint16(dicttls.DictExtTypeValueIndexed, extraExtensionNames),
+	"extensions_normalized":  annotateUint16(dicttls.DictExtTypeValueIndexed, extraExtensionNames),
+	"supported_groups":       annotateUint16(dicttls.DictSupportedGroupsValueIndexed, extraGroupNames),
+	"key_share":              annotateUint16(dicttls.DictSupportedGroupsValueIndexed, extraGroupNames),
+	"signature_algorithms":   annotateUint16(dicttls.DictSignatureSchemeValueIndexed),
+	"delegated_credentials":  annotateUint16(dicttls.DictSignatureSchemeValueIndexed),
+	"compress_certificate":   annotateUint16(dicttls.DictCertificateCompressionAlgorithmValueIndexed),
+	"compression_methods":    annotateUint8(dicttls.DictCompMethValueIndexed, nil),
+	"ec_point_formats":       annotateUint8(dicttls.DictECPointFormatValueIndexed, nil),
+	"psk_key_exchange_modes": annotateUint8(dicttls.DictPSKKeyExchangeModeValueIndexed, isGREASEPSKKeyExchangeMode),
+	"frames":                 annotateUint8(dicttls.DictQUICFrameTypeValueIndexed, nil),
+	"tpids":                  annotateTransportParameter,
+}
+
+// names missing in dicttls
+var (
+	extraExtensionNames = map[uint16]string{
+		EXTENSION_ENCRYPTED_CLIENT_HELLO:   "encrypted_client_hello",
+		EXTENSION_APPLICATION_SETTINGS_NEW: "application_settings",
+	}
+	extraGroupNames = map[uint16]string{
+		GROUP_X25519_KYBER768_DRAFT00: "X25519Kyber768Draft00",
+		GROUP_SECP256R1_MLKEM768:      "SecP256r1MLKEM768",
+		GROUP_X25519_MLKEM768:         "X25519MLKEM768",
+		GROUP_SECP384R1_MLKEM1024:     "SecP384r1MLKEM1024",
+	}
+)
+
+func annotateUint16(dicts ...map[uint16]string) codePointAnnotator {
+	return func(v uint64) (string, bool) {
+		if v > 0xffff {
+			return "", false
+		}
+		if utils.IsGREASEUint16(uint16(v)) {
+			return "GREASE", true
+		}
+		for _, dict := range dicts {
+			if name, ok := dict[uint16(v)]; ok {
+				return name, false
+			}
+		}
+		return "", false
+	}
+}
+
+func annotateUint8(dict map[uint8]string, isGREASE func(v uint8) bool) codePointAnnotator {
+	return func(v uint64) (string, bool) {
+		if v > 0xff {
+			return "", false
+		}
+		if isGREASE != nil && isGREASE(uint8(v)) {
+			return "GREASE", true
+		}
+		return dict[uint8(v)], false
+	}
+}
+
+// isGREASEPSKKeyExchangeMode reports whether v is one of the GREASE values
+// reserved for psk_key_exchange_modes by RFC 8701, i.e., 0x0B, 0x2A, 0x49, ...
+func isGREASEPSKKeyExchangeMode(v uint8) bool {
+	return v >= 0x0b && (v-0x0b)%0x1f == 0
+}
+
+func annotateVersion(v uint64) (string, bool) {
+	switch v {
+	case SSLV2_RECORD_VERSION:
+		return "SSLv2", false
+	case tls.VersionSSL30, tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+		return tls.VersionName(uint16(v)), false
+	case 0xfeff:
+		return "DTLS 1.0", false
+	case 0xfefd:
+		return "DTLS 1.2", false
+	case 0xfefc:
+		return "DTLS 1.3", false
+	}
+	if v <= 0xffff && utils.IsGREASEUint16(uint16(v)) {
+		return "GREASE", true
+	}
+	return "", false
+}
+
+func annotateTransportParameter(v uint64) (string, bool) {
+	if IsGREASETransportParameter(v) {
+		return "GREASE", true
+	}
+	return dicttls.DictQUICTransportParameterValueIndexed[v], false
+}
+
+// annotateQUICVersion names a QUIC version, which is a 4-byte array in JSON.
+func annotateQUICVersion(v uint64) (string, bool) {
+	switch v {
+	case 0x00000001:
+		return "QUIC v1", false
+	case 0x6b3343cf:
+		return "QUIC v2", false
+	}
+	if v&0x0f0f0f0f == 0x0a0a0a0a { // RFC 9000 Section 15
+		return "GREASE", true
+	}
+	if v>>8 == 0xff0000 {
+		return fmt.Sprintf("draft-%d", v&0xff), false
+	}
+	return "", false
+}
+
+// orderedJSONObject is a JSON object with the order of its members preserved.
+type orderedJSONObject []orderedJSONMember
+
+type orderedJSONMember struct {
+	key   string
+	value any
+}
+
+func (o orderedJSONObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value from dec, with objects
+// decoded into orderedJSONObject. dec must use json.Number.
+func decodeOrderedJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		obj := orderedJSONObject{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedJSONMember{key: key.(string), value: value})
+		}
+		_, err = dec.Token() // '}'
+		return obj, err
+	case json.Delim('['):
+		arr := []any{}
+		for dec.More() {
+			value, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, value)
+		}
+		_, err = dec.Token() // ']'
+		return arr, err
+	}
+	return tok, nil
+}
+
+// annotateJSON replaces code points in a tree decoded by decodeOrderedJSON
+// with AnnotatedCodePoint, in place.
+func annotateJSON(tree any) any {
+	switch node := tree.(type) {
+	case orderedJSONObject:
+		for i := range node {
+			m := &node[i]
+			if annotator, ok := codePointAnnotators[m.key]; ok {
+				if annotated, ok := annotateCodePoints(m.value, annotator); ok {
+					m.value = annotated
+					continue
+				}
+			}
+			if m.key == "version" { // QUIC header
+				if annotated, ok := annotateQUICVersionBytes(m.value); ok {
+					m.value = annotated
+					continue
+				}
+			}
+			m.value = annotateJSON(m.value)
+		}
+	case []any:
+		for i := range node {
+			node[i] = annotateJSON(node[i])
+		}
+	}
+	return tree
+}
+
+// annotateCodePoints annotates a number or a list of numbers. It returns
+// false if value is neither.
+func annotateCodePoints(value any, annotator codePointAnnotator) (any, bool) {
+	annotate := func(v any) (*AnnotatedCodePoint, bool) {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		cp := &AnnotatedCodePoint{Value: u}
+		cp.Name, cp.GREASE = annotator(u)
+		return cp, true
+	}
+
+	if list, ok := value.([]any); ok {
+		annotated := make([]*AnnotatedCodePoint, 0, len(list))
+		for _, v := range list {
+			cp, ok := annotate(v)
+			if !ok {
+				return nil, false
+			}
+			annotated = append(annotated, cp)
+		}
+		return annotated, true
+	}
+	return annotate(value)
+}
+
+// annotateQUICVersionBytes annotates a QUIC version encoded as a list of 4
+// bytes. It returns false if value is not.
+func annotateQUICVersionBytes(value any) (any, bool) {
+	list, ok := value.([]any)
+	if !ok || len(list) != 4 {
+		return nil, false
+	}
+	var version uint64
+	for _, v := range list {
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, false
+		}
+		b, err := strconv.ParseUint(n.String(), 10, 8)
+		if err != nil {
+			return nil, false
+		}
+		version = version<<8 | b
+	}
+	cp := &AnnotatedCodePoint{Value: version}
+	cp.Name, cp.GREASE = annotateQUICVersion(version)
+	return cp, true
+}
@@ -0,0 +1,94 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestMarshalOptions(t *testing.T) {
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		b, err := MarshalOptions{}.Marshal(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := json.Marshal(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, expected) {
+			t.Errorf("output mismatch, expecting %s, got %s", expected, b)
+		}
+
+		b, err = MarshalOptions{Indent: "  "}.Marshal(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected, err = json.MarshalIndent(ch, "", "  "); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, expected) {
+			t.Errorf("indented output mismatch, expecting %s, got %s", expected, b)
+		}
+	})
+
+	t.Run("Annotated", func(t *testing.T) {
+		b, err := MarshalOptions{Annotated: true}.Marshal(ch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(b, []byte(`{"tls_record_version":{"value":769,"name":"TLS 1.0"},`)) {
+			t.Errorf("field order is not preserved, got %.80s...", b)
+		}
+
+		var annotated struct {
+			CipherSuites      []AnnotatedCodePoint `json:"cipher_suites"`
+			Extensions        []AnnotatedCodePoint `json:"extensions"`
+			SupportedVersions []AnnotatedCodePoint `json:"supported_versions"`
+			ServerName        string               `json:"server_name"`
+			HexID             string               `json:"hex_id"`
+		}
+		if err = json.Unmarshal(b, &annotated); err != nil {
+			t.Fatal(err)
+		}
+		if expected := (AnnotatedCodePoint{Value: 0x1301, Name: "TLS_AES_128_GCM_SHA256"}); annotated.CipherSuites[0] != expected {
+			t.Errorf("cipher suite mismatch, expecting %+v, got %+v", expected, annotated.CipherSuites[0])
+		}
+		if expected := (AnnotatedCodePoint{Value: uint64(EXTENSION_ENCRYPTED_CLIENT_HELLO), Name: "encrypted_client_hello"}); annotated.Extensions[len(annotated.Extensions)-1] != expected {
+			t.Errorf("extension mismatch, expecting %+v, got %+v", expected, annotated.Extensions[len(annotated.Extensions)-1])
+		}
+		if expected := []AnnotatedCodePoint{{Value: 0x0304, Name: "TLS 1.3"}, {Value: 0x0303, Name: "TLS 1.2"}}; !reflect.DeepEqual(annotated.SupportedVersions, expected) {
+			t.Errorf("supported versions mismatch, expecting %+v, got %+v", expected, annotated.SupportedVersions)
+		}
+		if annotated.ServerName != ch.ServerName || annotated.HexID != ch.HexID {
+			t.Errorf("fields other than code points are expected to be untouched")
+		}
+	})
+
+	t.Run("GREASE", func(t *testing.T) {
+		chrome := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+		b, err := MarshalOptions{Annotated: true}.Marshal(chrome)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var annotated struct {
+			CipherSuites []AnnotatedCodePoint `json:"cipher_suites"`
+		}
+		if err = json.Unmarshal(b, &annotated); err != nil {
+			t.Fatal(err)
+		}
+		if expected := (AnnotatedCodePoint{Value: uint64(tls.GREASE_PLACEHOLDER), Name: "GREASE", GREASE: true}); annotated.CipherSuites[0] != expected {
+			t.Errorf("GREASE cipher suite mismatch, expecting %+v, got %+v", expected, annotated.CipherSuites[0])
+		}
+	})
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"strconv"
+
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
@@ -64,6 +66,25 @@ func parseCaddyfile(d *caddyfile.Dispenser, _ interface{}) (interface{}, error)
 				if len(args) > 1 {
 					return nil, d.Err("too many arguments")
 				}
+			case "ech_key_file": // PEM file(s) with ECH private key and ECHConfigList
+				args := d.RemainingArgs()
+				if len(args) == 0 {
+					return nil, d.ArgErr()
+				}
+				app.ECHKeyFiles = append(app.ECHKeyFiles, args...)
+			case "max_clienthello_size": // maximum size of a ClientHello reassembled from TLS records
+				if app.MaxClientHelloSize != 0 {
+					return nil, d.Err("only one max_clienthello_size is allowed")
+				}
+				args := d.RemainingArgs()
+				if len(args) != 1 {
+					return nil, d.ArgErr()
+				}
+				size, err := strconv.Atoi(args[0])
+				if err != nil || size <= 0 {
+					return nil, d.Errf("invalid size: %s", args[0])
+				}
+				app.MaxClientHelloSize = size
 			}
 		}
 	}
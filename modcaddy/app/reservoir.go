@@ -2,6 +2,8 @@ package app
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"sync"
 	"time"
 
@@ -42,9 +44,21 @@ type Reservoir struct {
 	// a longer TTL for QUIC.
 	QuicTTL caddy.Duration `json:"quic_ttl,omitempty"`
 
+	// ECHKeyFiles is a list of PEM files, each containing an ECH private key
+	// and the ECHConfigList it is published in. When set, the inner ClientHello
+	// of TLS connections using ECH with one of these keys is decrypted and
+	// fingerprinted as well.
+	ECHKeyFiles []string `json:"ech_key_files,omitempty"`
+
+	// MaxClientHelloSize is the maximum size in bytes of a TLS ClientHello
+	// to be reassembled from multiple TLS records. If unset,
+	// clienthellod.DEFAULT_CLIENTHELLO_MAX_SIZE is used.
+	MaxClientHelloSize int `json:"max_clienthello_size,omitempty"`
+
 	tlsFingerprinter        *clienthellod.TLSFingerprinter
 	quicFingerprinter       *clienthellod.QUICFingerprinter
 	mapLastQUICVisitorPerIP *sync.Map // sometimes even when a complete QUIC handshake is done, client decide to connect using HTTP/2
+	mapLastSSLv2HelloPerIP  *sync.Map // SSLv2-compatible ClientHellos never make it to the handler as the TLS handshake fails
 
 	logger *zap.Logger
 }
@@ -96,6 +110,29 @@ func (r *Reservoir) GetLastQUICVisitor(ip string) (string, bool) { // skipcq: GO
 	return "", false
 }
 
+// NewSSLv2ClientHello updates the map entry for the given IP address with
+// an SSLv2-compatible ClientHello.
+func (r *Reservoir) NewSSLv2ClientHello(ip string, ch *clienthellod.ClientHello) { // skipcq: GO-W1029
+	r.mapLastSSLv2HelloPerIP.Store(ip, ch)
+
+	// delete it after TTL if not updated
+	go func() {
+		<-time.After(time.Duration(r.TlsTTL))
+		r.mapLastSSLv2HelloPerIP.CompareAndDelete(ip, ch)
+	}()
+}
+
+// GetLastSSLv2ClientHello returns the last SSLv2-compatible ClientHello sent
+// from the given IP address.
+func (r *Reservoir) GetLastSSLv2ClientHello(ip string) (*clienthellod.ClientHello, bool) { // skipcq: GO-W1029
+	if v, ok := r.mapLastSSLv2HelloPerIP.Load(ip); ok {
+		if ch, ok := v.(*clienthellod.ClientHello); ok {
+			return ch, true
+		}
+	}
+	return nil, false
+}
+
 // Start implements Start() of caddy.App.
 func (r *Reservoir) Start() error { // skipcq: GO-W1029
 	if r.QuicTTL <= 0 || r.TlsTTL <= 0 {
@@ -117,11 +154,30 @@ func (r *Reservoir) Stop() error { // skipcq: GO-W1029
 // Provision implements Provision() of caddy.Provisioner.
 func (r *Reservoir) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
 	r.tlsFingerprinter = clienthellod.NewTLSFingerprinterWithTimeout(time.Duration(r.TlsTTL))
+	r.tlsFingerprinter.SetMaxClientHelloSize(r.MaxClientHelloSize)
 	r.quicFingerprinter = clienthellod.NewQUICFingerprinterWithTimeout(time.Duration(r.QuicTTL))
 	r.mapLastQUICVisitorPerIP = new(sync.Map)
+	r.mapLastSSLv2HelloPerIP = new(sync.Map)
 
 	r.logger = ctx.Logger(r)
 
+	if len(r.ECHKeyFiles) > 0 {
+		var echKeys []*clienthellod.ECHKey
+		for _, file := range r.ECHKeyFiles {
+			pemBytes, err := os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("failed to read ECH key file %s: %w", file, err)
+			}
+			keys, err := clienthellod.LoadECHKeysFromPEM(pemBytes)
+			if err != nil {
+				return fmt.Errorf("failed to load ECH keys from %s: %w", file, err)
+			}
+			echKeys = append(echKeys, keys...)
+		}
+		r.tlsFingerprinter.SetECHKeys(echKeys)
+		r.logger.Info("clienthellod reservoir loaded ECH keys", zap.Int("count", len(echKeys)))
+	}
+
 	r.logger.Info("clienthellod reservoir is provisioned")
 	return nil
 }
@@ -1,7 +1,6 @@
 package handler
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
@@ -11,6 +10,8 @@ import (
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
 	"github.com/caddyserver/caddy/v2/caddyconfig/httpcaddyfile"
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
+	"github.com/gaukas/clienthellod"
+	"github.com/gaukas/clienthellod/fpdb"
 	"github.com/gaukas/clienthellod/modcaddy/app"
 	"go.uber.org/zap"
 )
@@ -37,8 +38,14 @@ type Handler struct {
 	// Mutually exclusive with TLS. One and only one of TLS or QUIC must be true.
 	QUIC bool `json:"quic,omitempty"`
 
+	// FingerprintDB lists JSON or CSV datasets of known fingerprints to be
+	// merged into the dataset embedded in fpdb, for labeling the fingerprints
+	// in the response.
+	FingerprintDB []string `json:"fingerprint_db,omitempty"`
+
 	logger    *zap.Logger
 	reservoir *app.Reservoir
+	db        *fpdb.DB
 }
 
 // CaddyModule returns the Caddy module information.
@@ -67,6 +74,14 @@ func (h *Handler) Provision(ctx caddy.Context) error { // skipcq: GO-W1029
 		return errors.New("clienthellod handler: one and only one of TLS or QUIC must be enabled")
 	}
 
+	h.db = fpdb.Default()
+	for _, name := range h.FingerprintDB {
+		if err := h.db.LoadFile(name); err != nil {
+			return fmt.Errorf("clienthellod handler: failed to load fingerprint database %s: %w", name, err)
+		}
+	}
+	h.logger.Info(fmt.Sprintf("clienthellod handler fingerprint database loaded with %d records.", h.db.Len()))
+
 	h.logger.Info("clienthellod handler provisioned.")
 
 	return nil
@@ -97,23 +112,46 @@ func (h *Handler) serveTLS(wr http.ResponseWriter, req *http.Request, next caddy
 	wr.Header().Set("Alt-Svc", "clear") // to prevent web broswers switching to QUIC
 
 	// get the client hello from the reservoir
-	ch := h.reservoir.TLSFingerprinter().Pop(req.RemoteAddr)
-	if ch == nil {
-		h.logger.Debug(fmt.Sprintf("Unable to fetch TLS ClientHello sent by %s, maybe not TLS connection?", req.RemoteAddr))
-		return next.ServeHTTP(wr, req)
+	var ch *clienthellod.ClientHello
+	if req.URL.Query().Get("sslv2") == "true" {
+		// SSLv2-compatible ClientHello sent from the same IP in a previous
+		// connection, since the connection carrying it can't complete a TLS
+		// handshake to reach here
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			h.logger.Error(fmt.Sprintf("Can't split IP from %s: %v", req.RemoteAddr, err))
+			return next.ServeHTTP(wr, req)
+		}
+		var ok bool
+		ch, ok = h.reservoir.GetLastSSLv2ClientHello(ip)
+		if !ok {
+			h.logger.Debug(fmt.Sprintf("Can't find last SSLv2-compatible ClientHello for %s", ip))
+			return next.ServeHTTP(wr, req)
+		}
+	} else {
+		ch = h.reservoir.TLSFingerprinter().Pop(req.RemoteAddr)
+		if ch == nil {
+			h.logger.Debug(fmt.Sprintf("Unable to fetch TLS ClientHello sent by %s, maybe not TLS connection?", req.RemoteAddr))
+			return next.ServeHTTP(wr, req)
+		}
 	}
 	// h.logger.Debug(fmt.Sprintf("Fetched TLS ClientHello for %s", req.RemoteAddr))
 
-	ch.UserAgent = req.UserAgent()
+	// set the User-Agent on a copy, since the ClientHello may be shared by
+	// concurrent requests, e.g., the last SSLv2-compatible one of an IP
+	chCopy := *ch
+	chCopy.UserAgent = req.UserAgent()
+	ch = &chCopy
+
+	resp := struct {
+		*clienthellod.ClientHello
+		Labels           []*fpdb.Match                  `json:"labels,omitempty"` // known clients sending the same fingerprint
+		UserAgentVerdict *clienthellod.UserAgentVerdict `json:"user_agent_verdict"`
+		Security         *clienthellod.SecurityReport   `json:"security,omitempty"`
+	}{ch, h.db.LookupClientHello(ch), ch.CheckUserAgent(), ch.GradeSecurity()}
 
 	// dump JSON
-	var b []byte
-	var err error
-	if req.URL.Query().Get("beautify") == "true" {
-		b, err = json.MarshalIndent(ch, "", "  ")
-	} else {
-		b, err = json.Marshal(ch)
-	}
+	b, err := marshalOptions(req).Marshal(resp)
 	if err != nil {
 		h.logger.Error("failed to marshal TLS ClientHello into JSON", zap.Error(err))
 		return next.ServeHTTP(wr, req)
@@ -186,15 +224,21 @@ func (h *Handler) serveQUIC(wr http.ResponseWriter, req *http.Request, next cadd
 		}
 	}
 
-	qfp.UserAgent = req.UserAgent()
+	// set the User-Agent on a copy, since the QUIC fingerprint is only peeked
+	// and may be shared by concurrent requests
+	qfpCopy := *qfp
+	qfpCopy.UserAgent = req.UserAgent()
+	qfp = &qfpCopy
+
+	resp := struct {
+		*clienthellod.QUICFingerprint
+		Labels           []*fpdb.Match                  `json:"labels,omitempty"` // known clients sending the same fingerprint
+		UserAgentVerdict *clienthellod.UserAgentVerdict `json:"user_agent_verdict"`
+		Security         *clienthellod.SecurityReport   `json:"security,omitempty"`
+	}{qfp, h.db.LookupQUICFingerprint(qfp), qfp.CheckUserAgent(), qfp.GradeSecurity()}
 
 	// dump JSON
-	var b []byte
-	if req.URL.Query().Get("beautify") == "true" {
-		b, err = json.MarshalIndent(qfp, "", "  ")
-	} else {
-		b, err = json.Marshal(qfp)
-	}
+	b, err := marshalOptions(req).Marshal(resp)
 	if err != nil {
 		h.logger.Error("failed to marshal QUIC fingerprint into JSON", zap.Error(err))
 		return next.ServeHTTP(wr, req)
@@ -219,6 +263,19 @@ func (h *Handler) serveQUIC(wr http.ResponseWriter, req *http.Request, next cadd
 	return nil
 }
 
+// marshalOptions returns the options to marshal the response with, selected
+// by the query parameters of the request: beautify=true to indent the JSON,
+// annotate=true to pair each code point with its IANA name.
+func marshalOptions(req *http.Request) clienthellod.MarshalOptions {
+	opts := clienthellod.MarshalOptions{
+		Annotated: req.URL.Query().Get("annotate") == "true",
+	}
+	if req.URL.Query().Get("beautify") == "true" {
+		opts.Indent = "  "
+	}
+	return opts
+}
+
 // UnmarshalCaddyfile unmarshals Caddyfile tokens into h.
 func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error { // skipcq: GO-W1029
 	for d.Next() {
@@ -238,6 +295,12 @@ func (h *Handler) UnmarshalCaddyfile(d *caddyfile.Dispenser) error { // skipcq:
 					return d.Err("clienthellod: tls and quic are mutually exclusive in one block")
 				}
 				h.QUIC = true
+			case "fingerprint_db":
+				args := d.RemainingArgs()
+				if len(args) == 0 {
+					return d.ArgErr()
+				}
+				h.FingerprintDB = append(h.FingerprintDB, args...)
 			}
 		}
 	}
@@ -137,6 +137,19 @@ func (l *tlsListener) Accept() (net.Conn, error) {
 		return conn, err
 	}
 
+	// SSLv2-compatible ClientHello will be rejected by the TLS server, so it
+	// is logged and kept by the IP address for the handler to look up later.
+	if ch := l.reservoir.TLSFingerprinter().Peek(conn.RemoteAddr().String()); ch != nil && ch.SSLv2 {
+		l.logger.Info("SSLv2-compatible ClientHello from "+conn.RemoteAddr().String(),
+			zap.String("hex_id", ch.HexID),
+			zap.String("ja3_hash", ch.JA3Hash),
+			zap.String("ja4", ch.JA4),
+		)
+		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+			l.reservoir.NewSSLv2ClientHello(ip, ch)
+		}
+	}
+
 	// No matter what happens, rewind the connection
 	return rewindConn, nil
 }
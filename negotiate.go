@@ -0,0 +1,379 @@
+package clienthellod
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"strings"
+
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	ErrNoCommonVersion             = errors.New("no TLS version supported by both client and server")
+	ErrNoCommonCipherSuite         = errors.New("no cipher suite supported by both client and server")
+	ErrNoCommonGroup               = errors.New("no key exchange group supported by both client and server")
+	ErrNoCommonSignatureScheme     = errors.New("no signature scheme supported by both client and server")
+	ErrNoCommonApplicationProtocol = errors.New("no application protocol supported by both client and server")
+)
+
+// ServerConfig describes the TLS configuration of a server to simulate the
+// negotiation with a ClientHello. Zero values are for the defaults of
+// crypto/tls as of Go 1.24.
+type ServerConfig struct {
+	MinVersion uint16 // TLS 1.2 if zero
+	MaxVersion uint16 // TLS 1.3 if zero
+
+	// CipherSuites are the cipher suites enabled for TLS 1.2 and below. As
+	// crypto/tls since Go 1.17, their order is ignored: the cipher suite is
+	// selected in the fixed order of preference of crypto/tls.
+	CipherSuites []uint16
+
+	// TLS13CipherSuites are the cipher suites for TLS 1.3, in the order of
+	// server preference. If nil, as crypto/tls, AES-GCM is preferred unless
+	// the client prefers ChaCha20-Poly1305.
+	TLS13CipherSuites []uint16
+
+	// Groups are the key exchange groups, in the order of server preference.
+	Groups []uint16
+
+	// SignatureSchemes are the signature schemes supported by the
+	// certificate of the server. If nil, the certificate is assumed to be of
+	// an ECDSA P-256 key.
+	SignatureSchemes []uint16
+
+	// NextProtos are the application protocols supported by the server, in
+	// the order of server preference. If empty, ALPN is not negotiated.
+	NextProtos []string
+}
+
+// defaults of crypto/tls
+var (
+	// in the order of preference of crypto/tls
+	defaultServerCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	}
+	defaultServerTLS13CipherSuitesAES = []uint16{
+		tls.TLS_AES_128_GCM_SHA256,
+		tls.TLS_AES_256_GCM_SHA384,
+		tls.TLS_CHACHA20_POLY1305_SHA256,
+	}
+	defaultServerTLS13CipherSuitesChaCha = []uint16{
+		tls.TLS_CHACHA20_POLY1305_SHA256,
+		tls.TLS_AES_128_GCM_SHA256,
+		tls.TLS_AES_256_GCM_SHA384,
+	}
+	serverCipherSuitesPreferenceOrder = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA,
+		tls.TLS_RSA_WITH_AES_256_CBC_SHA,
+		tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+		tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA, tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA,
+		tls.TLS_RSA_WITH_RC4_128_SHA,
+	}
+	aesgcmCipherSuites = []uint16{
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384,
+	}
+	defaultServerGroups = []uint16{
+		GROUP_X25519_MLKEM768,
+		uint16(tls.X25519),
+		uint16(tls.CurveP256),
+		uint16(tls.CurveP384),
+		uint16(tls.CurveP521),
+	}
+)
+
+// ServerConfigFromTLSConfig describes a server configuration of crypto/tls.
+// The signature schemes are of the first certificate, if any.
+func ServerConfigFromTLSConfig(config *tls.Config) *ServerConfig {
+	sc := &ServerConfig{
+		MinVersion:   config.MinVersion,
+		MaxVersion:   config.MaxVersion,
+		CipherSuites: config.CipherSuites, // crypto/tls does not allow configuring TLS 1.3 cipher suites
+		NextProtos:   config.NextProtos,
+	}
+	for _, curve := range config.CurvePreferences {
+		sc.Groups = append(sc.Groups, uint16(curve))
+	}
+
+	if len(config.Certificates) > 0 {
+		cert := config.Certificates[0]
+		if len(cert.SupportedSignatureAlgorithms) > 0 {
+			for _, scheme := range cert.SupportedSignatureAlgorithms {
+				sc.SignatureSchemes = append(sc.SignatureSchemes, uint16(scheme))
+			}
+		} else if signer, ok := cert.PrivateKey.(crypto.Signer); ok {
+			sc.SignatureSchemes = signatureSchemesForKey(signer.Public())
+		}
+	}
+	return sc
+}
+
+// signatureSchemesForKey returns the signature schemes crypto/tls supports
+// for a public key, in the order of preference.
+func signatureSchemesForKey(pub crypto.PublicKey) []uint16 {
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return []uint16{uint16(tls.ECDSAWithP256AndSHA256), uint16(tls.ECDSAWithSHA1)}
+		case elliptic.P384():
+			return []uint16{uint16(tls.ECDSAWithP384AndSHA384), uint16(tls.ECDSAWithSHA1)}
+		case elliptic.P521():
+			return []uint16{uint16(tls.ECDSAWithP521AndSHA512), uint16(tls.ECDSAWithSHA1)}
+		}
+	case *rsa.PublicKey:
+		return []uint16{
+			uint16(tls.PSSWithSHA256), uint16(tls.PSSWithSHA384), uint16(tls.PSSWithSHA512),
+			uint16(tls.PKCS1WithSHA256), uint16(tls.PKCS1WithSHA384), uint16(tls.PKCS1WithSHA512),
+			uint16(tls.PKCS1WithSHA1),
+		}
+	case ed25519.PublicKey:
+		return []uint16{uint16(tls.Ed25519)}
+	}
+	return nil
+}
+
+// NegotiationResult is the predicted outcome of a negotiation.
+type NegotiationResult struct {
+	Version           uint16 `json:"version"`
+	CipherSuite       uint16 `json:"cipher_suite"`
+	Group             uint16 `json:"group,omitempty"`               // key exchange group, 0 for RSA key exchange
+	HelloRetryRequest bool   `json:"hello_retry_request,omitempty"` // no key share of Group is sent, so the server has to ask for one
+	SignatureScheme   uint16 `json:"signature_scheme,omitempty"`    // 0 for RSA key exchange, or if not sent by the client of TLS 1.2 and below
+	ALPN              string `json:"alpn,omitempty"`
+}
+
+// Negotiate predicts the outcome of the negotiation between the ClientHello
+// and a server, following the logic of crypto/tls: the version is selected
+// by client preference, the cipher suite and the group by server preference,
+// and the signature scheme by client preference. It returns one of the
+// ErrNoCommon* errors if the handshake would fail.
+//
+// Session resumption and extensions not listed in NegotiationResult are not
+// considered.
+func (ch *ClientHello) Negotiate(server *ServerConfig) (*NegotiationResult, error) { // skipcq: GO-R1005
+	result := &NegotiationResult{}
+
+	// version
+	minVersion, maxVersion := server.MinVersion, server.MaxVersion
+	if minVersion == 0 {
+		minVersion = tls.VersionTLS12
+	}
+	if maxVersion == 0 {
+		maxVersion = tls.VersionTLS13
+	}
+	clientVersions := ch.SupportedVersions
+	if !slices.Contains(ch.Extensions, dicttls.ExtType_supported_versions) {
+		clientVersions = nil
+		for v := min(ch.TLSHandshakeVersion, tls.VersionTLS12); v >= tls.VersionSSL30; v-- {
+			clientVersions = append(clientVersions, v)
+		}
+	}
+	for _, v := range clientVersions {
+		if v >= minVersion && v <= maxVersion && v >= tls.VersionTLS10 && v <= tls.VersionTLS13 {
+			result.Version = v
+			break
+		}
+	}
+	if result.Version == 0 {
+		return nil, ErrNoCommonVersion
+	}
+
+	serverGroups := server.Groups
+	if serverGroups == nil {
+		serverGroups = defaultServerGroups
+	}
+	serverSchemes := server.SignatureSchemes
+	if serverSchemes == nil {
+		serverSchemes = []uint16{uint16(tls.ECDSAWithP256AndSHA256), uint16(tls.ECDSAWithSHA1)}
+	}
+
+	if result.Version == tls.VersionTLS13 {
+		// cipher suite
+		serverSuites := server.TLS13CipherSuites
+		if serverSuites == nil {
+			serverSuites = defaultServerTLS13CipherSuitesAES
+			for _, suite := range ch.CipherSuites {
+				if suite == tls.TLS_CHACHA20_POLY1305_SHA256 {
+					serverSuites = defaultServerTLS13CipherSuitesChaCha
+					break
+				} else if slices.Contains(defaultServerTLS13CipherSuitesAES, suite) {
+					break
+				}
+			}
+		}
+		result.CipherSuite = firstCommon(serverSuites, ch.CipherSuites)
+		if result.CipherSuite == 0 {
+			return nil, ErrNoCommonCipherSuite
+		}
+
+		// group, preferring those with a key share sent
+		for _, group := range serverGroups {
+			if slices.Contains(ch.KeyShare, group) {
+				result.Group = group
+				break
+			}
+			if result.Group == 0 && slices.Contains(ch.NamedGroupList, group) {
+				result.Group = group // keep looking for one with a key share sent
+			}
+		}
+		if result.Group == 0 {
+			return nil, ErrNoCommonGroup
+		}
+		result.HelloRetryRequest = !slices.Contains(ch.KeyShare, result.Group)
+
+		// signature scheme, PKCS #1 v1.5 and SHA-1 not allowed
+		result.SignatureScheme = firstCommon(ch.SignatureSchemeList, slices.DeleteFunc(slices.Clone(serverSchemes), func(scheme uint16) bool {
+			return scheme&0xff == 0x01 || scheme&0xff00 == 0x0200
+		}))
+		if result.SignatureScheme == 0 {
+			return nil, ErrNoCommonSignatureScheme
+		}
+	} else {
+		// cipher suite and group, with the group needed for ECDHE only
+		serverSuites := serverCipherSuites(server.CipherSuites, ch.CipherSuites)
+		ecdhGroup := firstCommon(serverGroups, slices.DeleteFunc(slices.Clone(ch.NamedGroupList), func(group uint16) bool {
+			return pqHybridGroups[group] // TLS 1.3 only
+		}))
+		ecdsaCert := slices.ContainsFunc(serverSchemes, isECDSASignatureScheme)
+		rsaCert := slices.ContainsFunc(serverSchemes, isRSASignatureScheme)
+		for _, suite := range serverSuites {
+			if !slices.Contains(ch.CipherSuites, suite) {
+				continue
+			}
+			name := dicttls.DictCipherSuiteValueIndexed[suite]
+			if result.Version < tls.VersionTLS12 && (strings.HasSuffix(name, "_SHA256") || strings.HasSuffix(name, "_SHA384")) {
+				continue // AEAD and SHA-2 cipher suites are TLS 1.2 only
+			}
+			switch {
+			case strings.HasPrefix(name, "TLS_ECDHE_ECDSA_"):
+				if !ecdsaCert || ecdhGroup == 0 {
+					continue
+				}
+				result.Group = ecdhGroup
+			case strings.HasPrefix(name, "TLS_ECDHE_RSA_"):
+				if !rsaCert || ecdhGroup == 0 {
+					continue
+				}
+				result.Group = ecdhGroup
+			case strings.HasPrefix(name, "TLS_RSA_"):
+				if !rsaCert {
+					continue
+				}
+			default:
+				continue // not supported by crypto/tls
+			}
+			result.CipherSuite = suite
+			break
+		}
+		if result.CipherSuite == 0 {
+			if ecdhGroup == 0 && slices.ContainsFunc(ch.CipherSuites, func(suite uint16) bool {
+				return strings.HasPrefix(dicttls.DictCipherSuiteValueIndexed[suite], "TLS_ECDHE_")
+			}) {
+				return nil, ErrNoCommonGroup
+			}
+			return nil, ErrNoCommonCipherSuite
+		}
+
+		// signature scheme, with ECDHE only
+		if result.Group != 0 && len(ch.SignatureSchemeList) > 0 {
+			ecdsaSuite := strings.HasPrefix(dicttls.DictCipherSuiteValueIndexed[result.CipherSuite], "TLS_ECDHE_ECDSA_")
+			result.SignatureScheme = firstCommon(ch.SignatureSchemeList, slices.DeleteFunc(slices.Clone(serverSchemes), func(scheme uint16) bool {
+				return ecdsaSuite != isECDSASignatureScheme(scheme)
+			}))
+			if result.SignatureScheme == 0 {
+				return nil, ErrNoCommonSignatureScheme
+			}
+		}
+	}
+
+	// ALPN
+	if len(server.NextProtos) > 0 && len(ch.ALPN) > 0 {
+		for _, proto := range server.NextProtos {
+			if slices.Contains(ch.ALPN, proto) {
+				result.ALPN = proto
+				break
+			}
+		}
+		if result.ALPN == "" {
+			return nil, ErrNoCommonApplicationProtocol
+		}
+	}
+
+	return result, nil
+}
+
+// serverCipherSuites returns the cipher suites enabled for TLS 1.2 and below
+// in the order of preference of crypto/tls, which ignores the order
+// configured. As crypto/tls, ChaCha20-Poly1305 is preferred if the first
+// cipher suite of the client known to crypto/tls is not an AES-GCM one.
+func serverCipherSuites(configured, client []uint16) []uint16 {
+	if configured == nil {
+		configured = defaultServerCipherSuites
+	}
+
+	preferenceOrder := serverCipherSuitesPreferenceOrder
+	for _, suite := range client {
+		if slices.Contains(aesgcmCipherSuites, suite) {
+			break
+		}
+		if slices.Contains(serverCipherSuitesPreferenceOrder, suite) || slices.Contains(defaultServerTLS13CipherSuitesAES, suite) {
+			// ChaCha20-Poly1305 first, then AES-GCM
+			preferenceOrder = append(slices.Clone(preferenceOrder[4:6]), preferenceOrder[:4]...)
+			preferenceOrder = append(preferenceOrder, serverCipherSuitesPreferenceOrder[6:]...)
+			break
+		}
+	}
+
+	return slices.DeleteFunc(slices.Clone(preferenceOrder), func(suite uint16) bool {
+		return !slices.Contains(configured, suite)
+	})
+}
+
+// firstCommon returns the first value in preferred also in other, or 0 if
+// none.
+func firstCommon(preferred, other []uint16) uint16 {
+	for _, v := range preferred {
+		if slices.Contains(other, v) {
+			return v
+		}
+	}
+	return 0
+}
+
+// isECDSASignatureScheme reports whether a signature scheme is of an ECDSA or
+// EdDSA key, which are both used with ECDHE_ECDSA cipher suites.
+func isECDSASignatureScheme(scheme uint16) bool {
+	return scheme&0xff == 0x03 || scheme == uint16(tls.Ed25519)
+}
+
+// isRSASignatureScheme reports whether a signature scheme is of an RSA key.
+func isRSASignatureScheme(scheme uint16) bool {
+	return scheme&0xff == 0x01 || (scheme >= uint16(tls.PSSWithSHA256) && scheme <= uint16(tls.PSSWithSHA512))
+}
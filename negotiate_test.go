@@ -0,0 +1,124 @@
+package clienthellod_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"reflect"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	utls "github.com/refraction-networking/utls"
+)
+
+func TestClientHelloNegotiate(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome58 := uTLSClientHello(t, utls.HelloChrome_58, nil, tls.VersionTLS10)
+	chacha := uTLSClientHello(t, utls.HelloCustom, &utls.ClientHelloSpec{
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		Extensions: []utls.TLSExtension{
+			&utls.SupportedCurvesExtension{Curves: []utls.CurveID{utls.X25519}},
+			&utls.SupportedPointsExtension{SupportedPoints: []uint8{0}},
+			&utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{utls.ECDSAWithP256AndSHA256}},
+		},
+	}, tls.VersionTLS10)
+
+	for _, tc := range []struct {
+		name     string
+		ch       *ClientHello
+		server   *ServerConfig
+		expected *NegotiationResult
+		err      error
+	}{
+		{"Default", firefox, &ServerConfig{}, &NegotiationResult{
+			Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256),
+		}, nil},
+		{"ALPN", firefox, &ServerConfig{NextProtos: []string{"h3", "h2", "http/1.1"}}, &NegotiationResult{
+			Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256), ALPN: "h2",
+		}, nil},
+		{"HelloRetryRequest", firefox, &ServerConfig{Groups: []uint16{uint16(tls.CurveP384)}}, &NegotiationResult{
+			Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, Group: uint16(tls.CurveP384), HelloRetryRequest: true, SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256),
+		}, nil},
+		{"TLS 1.2", firefox, &ServerConfig{MaxVersion: tls.VersionTLS12}, &NegotiationResult{
+			Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256),
+		}, nil},
+		{"Configured order ignored", firefox, &ServerConfig{
+			MaxVersion:       tls.VersionTLS12,
+			CipherSuites:     []uint16{tls.TLS_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			SignatureSchemes: []uint16{uint16(tls.PSSWithSHA256)},
+		}, &NegotiationResult{
+			Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.PSSWithSHA256),
+		}, nil},
+		{"RSA key exchange", firefox, &ServerConfig{
+			MaxVersion:       tls.VersionTLS12,
+			CipherSuites:     []uint16{tls.TLS_RSA_WITH_AES_256_CBC_SHA, tls.TLS_RSA_WITH_AES_128_GCM_SHA256},
+			SignatureSchemes: []uint16{uint16(tls.PSSWithSHA256)},
+		}, &NegotiationResult{
+			Version: tls.VersionTLS12, CipherSuite: tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		}, nil},
+		{"ChaCha20-Poly1305 preferred by client", chacha, &ServerConfig{MaxVersion: tls.VersionTLS12}, &NegotiationResult{
+			Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256),
+		}, nil},
+		{"Chrome58", chrome58, &ServerConfig{}, &NegotiationResult{
+			Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, Group: uint16(tls.X25519), SignatureScheme: uint16(tls.ECDSAWithP256AndSHA256),
+		}, nil},
+		{"No common version", chrome58, &ServerConfig{MinVersion: tls.VersionTLS13}, nil, ErrNoCommonVersion},
+		{"No common cipher suite", firefox, &ServerConfig{TLS13CipherSuites: []uint16{0x1304}}, nil, ErrNoCommonCipherSuite}, // TLS_AES_128_CCM_SHA256
+		{"No common group", firefox, &ServerConfig{Groups: []uint16{30}}, nil, ErrNoCommonGroup},                             // x448
+		{"No common signature scheme", firefox, &ServerConfig{SignatureSchemes: []uint16{uint16(tls.Ed25519)}}, nil, ErrNoCommonSignatureScheme},
+		{"No common application protocol", firefox, &ServerConfig{NextProtos: []string{"h3"}}, nil, ErrNoCommonApplicationProtocol},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := tc.ch.Negotiate(tc.server)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("error mismatch, expecting %v, got %v", tc.err, err)
+			}
+			if !reflect.DeepEqual(result, tc.expected) {
+				t.Errorf("result mismatch, expecting %+v, got %+v", tc.expected, result)
+			}
+		})
+	}
+}
+
+func TestServerConfigFromTLSConfig(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.CurveP256},
+		NextProtos:       []string{"http/1.1"},
+		Certificates:     []tls.Certificate{{PrivateKey: key}},
+	}
+
+	sc := ServerConfigFromTLSConfig(config)
+	expected := &ServerConfig{
+		MinVersion:       tls.VersionTLS12,
+		Groups:           []uint16{uint16(tls.CurveP256)},
+		SignatureSchemes: []uint16{uint16(tls.ECDSAWithP384AndSHA384), uint16(tls.ECDSAWithSHA1)},
+		NextProtos:       []string{"http/1.1"},
+	}
+	if !reflect.DeepEqual(sc, expected) {
+		t.Fatalf("server config mismatch, expecting %+v, got %+v", expected, sc)
+	}
+
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := firefox.Negotiate(sc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (&NegotiationResult{
+		Version: tls.VersionTLS13, CipherSuite: tls.TLS_AES_128_GCM_SHA256, Group: uint16(tls.CurveP256), SignatureScheme: uint16(tls.ECDSAWithP384AndSHA384), ALPN: "http/1.1",
+	}); !reflect.DeepEqual(result, expected) {
+		t.Errorf("result mismatch, expecting %+v, got %+v", expected, result)
+	}
+}
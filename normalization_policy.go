@@ -0,0 +1,137 @@
+package clienthellod
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	"github.com/refraction-networking/utls/dicttls"
+)
+
+// NormalizationPolicy configures how a ClientHello is normalized before the
+// normalized fingerprint IDs (NormNumID, NormHexID) are calculated.
+//
+// Extensions are always sorted. The zero value does nothing else, which is
+// the legacy behavior and reproduces all normalized IDs calculated before
+// NormalizationPolicy was introduced.
+type NormalizationPolicy struct {
+	// CollapseGREASE removes GREASE values from every list, including cipher
+	// suites, extensions, supported groups, supported versions, signature
+	// algorithms and key shares, so the normalized ID does not depend on
+	// whether, where or how many GREASE values are sent.
+	CollapseGREASE bool
+
+	IgnorePadding    bool // remove padding(21) from extensions
+	SortCipherSuites bool // sort cipher suites in ascending order
+	DropALPN         bool // remove alpn(16) from extensions and ignore its content
+
+	// IgnorePSK removes pre_shared_key(41) and early_data(42) from extensions,
+	// so resumed and fresh handshakes from the same client are normalized
+	// into the same ID.
+	IgnorePSK bool
+
+	// IgnoreECH removes encrypted_client_hello(65037) from extensions, which
+	// some clients send depending on the connection, e.g., Firefox sends it
+	// (as GREASE or not) in fresh handshakes but not when resuming with 0-RTT.
+	IgnoreECH bool
+}
+
+// String returns the identifier of the policy, which is included in the output
+// of a ClientHello as NormalizationPolicy, e.g., "sort_extensions+ignore_padding".
+func (np NormalizationPolicy) String() string {
+	opts := []string{"sort_extensions"}
+	if np.CollapseGREASE {
+		opts = append(opts, "collapse_grease")
+	}
+	if np.IgnorePadding {
+		opts = append(opts, "ignore_padding")
+	}
+	if np.SortCipherSuites {
+		opts = append(opts, "sort_cipher_suites")
+	}
+	if np.DropALPN {
+		opts = append(opts, "drop_alpn")
+	}
+	if np.IgnorePSK {
+		opts = append(opts, "ignore_psk")
+	}
+	if np.IgnoreECH {
+		opts = append(opts, "ignore_ech")
+	}
+	return strings.Join(opts, "+")
+}
+
+// normalizeExtensions returns a sorted copy of the extension list with
+// extensions removed according to the policy.
+func (np NormalizationPolicy) normalizeExtensions(extensions []uint16) []uint16 {
+	normalized := make([]uint16, 0, len(extensions))
+	for _, ext := range extensions {
+		switch {
+		case np.CollapseGREASE && utils.IsGREASEUint16(ext),
+			np.IgnorePadding && ext == dicttls.ExtType_padding,
+			np.DropALPN && ext == dicttls.ExtType_application_layer_protocol_negotiation,
+			np.IgnorePSK && (ext == dicttls.ExtType_pre_shared_key || ext == dicttls.ExtType_early_data),
+			np.IgnoreECH && ext == EXTENSION_ENCRYPTED_CLIENT_HELLO:
+			continue
+		}
+		normalized = append(normalized, ext)
+	}
+
+	sort.Slice(normalized, func(i, j int) bool {
+		return normalized[i] < normalized[j]
+	})
+	return normalized
+}
+
+// normalized returns a shallow copy of the ClientHello with all fields used for
+// calculating the normalized fingerprint normalized according to the policy.
+func (ch *ClientHello) normalized(np NormalizationPolicy) *ClientHello {
+	norm := *ch
+	norm.ExtensionsNormalized = np.normalizeExtensions(ch.Extensions)
+
+	if np.CollapseGREASE {
+		norm.CipherSuites = removeGREASE(ch.CipherSuites)
+		norm.SupportedVersions = removeGREASE(ch.SupportedVersions)
+
+		if len(ch.lengthPrefixedSupportedGroups) > 0 {
+			groups := removeGREASE(ch.NamedGroupList)
+			norm.lengthPrefixedSupportedGroups = append([]uint16{2 * uint16(len(groups))}, groups...)
+		}
+		if len(ch.lengthPrefixedSignatureAlgos) > 0 {
+			sigalgs := removeGREASE(ch.SignatureSchemeList)
+			norm.lengthPrefixedSignatureAlgos = append([]uint16{2 * uint16(len(sigalgs))}, sigalgs...)
+		}
+
+		norm.keyshareGroupsWithLengths = make([]uint16, 0, len(ch.keyshareGroupsWithLengths))
+		for i := 0; i+1 < len(ch.keyshareGroupsWithLengths); i += 2 {
+			if utils.IsGREASEUint16(ch.keyshareGroupsWithLengths[i]) {
+				continue
+			}
+			norm.keyshareGroupsWithLengths = append(norm.keyshareGroupsWithLengths,
+				ch.keyshareGroupsWithLengths[i], ch.keyshareGroupsWithLengths[i+1])
+		}
+	}
+
+	if np.SortCipherSuites {
+		norm.CipherSuites = append([]uint16{}, norm.CipherSuites...)
+		sort.Slice(norm.CipherSuites, func(i, j int) bool {
+			return norm.CipherSuites[i] < norm.CipherSuites[j]
+		})
+	}
+
+	if np.DropALPN {
+		norm.alpnWithLengths = nil
+	}
+
+	return &norm
+}
+
+func removeGREASE(arr []uint16) []uint16 {
+	filtered := make([]uint16, 0, len(arr))
+	for _, v := range arr {
+		if !utils.IsGREASEUint16(v) {
+			filtered = append(filtered, v)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,191 @@
+package clienthellod_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"golang.org/x/exp/slices"
+)
+
+// parseGatheredClientHelloWithPolicy gathers the ClientInitials and re-parses
+// the reconstructed QUIC ClientHello with the given NormalizationPolicy.
+func parseGatheredClientHelloWithPolicy(t *testing.T, pkts [][]byte, policy NormalizationPolicy) *ClientHello {
+	gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+	for _, d := range pkts {
+		cip, err := UnmarshalQUICClientInitialPacket(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = gci.AddPacket(cip); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !gci.Completed() {
+		t.Fatal("GatheredClientInitials is not completed")
+	}
+
+	raw := gci.ClientHello.Raw()
+	record := append([]byte{0x16, 0x00, 0x00, byte(len(raw) >> 8), byte(len(raw))}, raw...)
+	ch, err := ReadClientHello(bytes.NewReader(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.SetNormalizationPolicy(policy)
+	if err = ch.ParseClientHello(); err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+func TestNormalizationPolicyIgnorePSK(t *testing.T) {
+	policy := NormalizationPolicy{IgnorePSK: true, IgnoreECH: true}
+	fresh := parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials["Firefox126"], policy)
+	resumed := parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials["Firefox126_0-RTT"], policy)
+
+	if !slices.Contains(resumed.Extensions, 41) || !slices.Contains(resumed.Extensions, 42) {
+		t.Fatalf("resumed handshake is expected to send pre_shared_key and early_data, got %v", resumed.Extensions)
+	}
+	// Firefox does not send encrypted_client_hello(65037) when resuming
+	if !slices.Contains(fresh.Extensions, 65037) || slices.Contains(resumed.Extensions, 65037) {
+		t.Fatalf("only the fresh handshake is expected to send encrypted_client_hello, got %v and %v", fresh.Extensions, resumed.Extensions)
+	}
+
+	if !slices.Equal(fresh.ExtensionsNormalized, resumed.ExtensionsNormalized) {
+		t.Errorf("normalized extensions mismatch, fresh: %v, resumed: %v", fresh.ExtensionsNormalized, resumed.ExtensionsNormalized)
+	}
+	if fresh.NormHexID != resumed.NormHexID || fresh.NormNumID != resumed.NormNumID {
+		t.Errorf("normalized IDs mismatch, fresh: %s, resumed: %s", fresh.NormHexID, resumed.NormHexID)
+	}
+	if fresh.HexID == resumed.HexID {
+		t.Errorf("HexID is expected to differ between fresh and resumed handshakes")
+	}
+
+	if resumed.NormalizationPolicy != "sort_extensions+ignore_psk+ignore_ech" {
+		t.Errorf("NormalizationPolicy mismatch, expecting sort_extensions+ignore_psk+ignore_ech, got %s", resumed.NormalizationPolicy)
+	}
+
+	// either one alone is not enough
+	for _, policy := range []NormalizationPolicy{{IgnorePSK: true}, {IgnoreECH: true}} {
+		fresh := parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials["Firefox126"], policy)
+		resumed := parseGatheredClientHelloWithPolicy(t, mapGatheredClientInitials["Firefox126_0-RTT"], policy)
+		if fresh.NormHexID == resumed.NormHexID {
+			t.Errorf("normalized IDs are not expected to match with %s", policy)
+		}
+	}
+}
+
+// reparseWithPolicy re-parses the ClientHello as sent with the given
+// NormalizationPolicy.
+func reparseWithPolicy(t *testing.T, ch *ClientHello, policy NormalizationPolicy) *ClientHello {
+	reparsed, err := ReadClientHello(bytes.NewReader(ch.Raw()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reparsed.SetNormalizationPolicy(policy)
+	if err = reparsed.ParseClientHello(); err != nil {
+		t.Fatal(err)
+	}
+	return reparsed
+}
+
+func TestNormalizationPolicyCollapseGREASE(t *testing.T) {
+	// GREASE values are random per connection but always fingerprinted as the
+	// same placeholder, so two Chrome ClientHellos match even without collapsing
+	first := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+	second := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+
+	// the same Chrome without the GREASE cipher suite and the first GREASE
+	// extension, still sending GREASE elsewhere
+	spec, err := tls.UTLSIdToSpec(tls.HelloChrome_120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec.CipherSuites = slices.DeleteFunc(spec.CipherSuites, func(c uint16) bool { return c == tls.GREASE_PLACEHOLDER })
+	for i, ext := range spec.Extensions {
+		if _, ok := ext.(*tls.UtlsGREASEExtension); ok {
+			spec.Extensions = slices.Delete(spec.Extensions, i, i+1)
+			break
+		}
+	}
+	lessGREASE := uTLSClientHello(t, tls.HelloCustom, &spec, tls.VersionTLS10)
+	if !slices.ContainsFunc(lessGREASE.Extensions, utils.IsGREASEUint16) {
+		t.Fatalf("ClientHello is expected to still send GREASE extensions, got %v", lessGREASE.Extensions)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		policy   NormalizationPolicy
+		expected bool // whether lessGREASE matches
+	}{
+		{"Off", NormalizationPolicy{}, false},
+		{"On", NormalizationPolicy{CollapseGREASE: true}, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b, c := reparseWithPolicy(t, first, tc.policy), reparseWithPolicy(t, second, tc.policy), reparseWithPolicy(t, lessGREASE, tc.policy)
+			if a.NormHexID != b.NormHexID || a.NormNumID != b.NormNumID {
+				t.Errorf("normalized IDs of Chrome built twice mismatch, %s and %s", a.NormHexID, b.NormHexID)
+			}
+			if (a.NormHexID == c.NormHexID) != tc.expected {
+				t.Errorf("normalized IDs with fewer GREASE values are expected to match: %t, got %s and %s", tc.expected, a.NormHexID, c.NormHexID)
+			}
+			if a.HexID == c.HexID {
+				t.Errorf("HexID is expected to differ with fewer GREASE values")
+			}
+		})
+	}
+}
+
+func TestNormalizationPolicy(t *testing.T) {
+	ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var legacy FingerprintScheme
+	if ch.NormFingerprintIDWithPolicy(legacy, NormalizationPolicy{}) != ch.NormHexID {
+		t.Fatalf("zero NormalizationPolicy must reproduce the legacy NormHexID")
+	}
+
+	policy := NormalizationPolicy{
+		CollapseGREASE:   true,
+		IgnorePadding:    true,
+		SortCipherSuites: true,
+		DropALPN:         true,
+		IgnorePSK:        true,
+	}
+
+	tfp := NewTLSFingerprinter()
+	defer tfp.Close()
+	tfp.SetNormalizationPolicy(policy)
+	if err := tfp.HandleMessage("test", tlsClientHello_Firefox126); err != nil {
+		t.Fatal(err)
+	}
+	normCh := tfp.Pop("test")
+	if normCh == nil {
+		t.Fatal("ClientHello not found in TLSFingerprinter")
+	}
+
+	if normCh.HexID != ch.HexID {
+		t.Errorf("NormalizationPolicy must not affect HexID, expecting %s, got %s", ch.HexID, normCh.HexID)
+	}
+
+	if normCh.NormHexID != ch.NormFingerprintIDWithPolicy(legacy, policy) {
+		t.Errorf("NormHexID mismatch, expecting %s, got %s", ch.NormFingerprintIDWithPolicy(legacy, policy), normCh.NormHexID)
+	}
+
+	if normCh.NormHexID == ch.NormHexID {
+		t.Errorf("NormHexID is expected to change with the NormalizationPolicy")
+	}
+
+	// Firefox 126 sends ALPN but no padding or PSK
+	if slices.Contains(normCh.ExtensionsNormalized, 16) {
+		t.Errorf("ALPN is expected to be dropped from normalized extensions, got %v", normCh.ExtensionsNormalized)
+	}
+	if !slices.IsSorted(normCh.ExtensionsNormalized) || len(normCh.ExtensionsNormalized) != len(ch.ExtensionsNormalized)-1 {
+		t.Errorf("unexpected normalized extensions %v", normCh.ExtensionsNormalized)
+	}
+}
@@ -39,6 +39,10 @@ func ParseQUICClientHello(p []byte) (*QUICClientHello, error) {
 		return nil, ch.qtp.ParseError()
 	}
 
+	// JA4 fingerprints of QUIC ClientHello are prefixed with 'q' instead of 't'
+	ch.JA4, ch.JA4R, ch.JA4O = ch.calcJA4(ja4ProtocolQUIC)
+	ch.Fingerprints = ch.calcFingerprintSet()
+
 	return &QUICClientHello{ClientHello: *ch}, nil
 }
 
@@ -21,6 +21,10 @@ type QUICFingerprint struct {
 	HexID string `json:"hex_id,omitempty"`
 	NumID uint64 `json:"num_id,omitempty"`
 
+	JA4 string `json:"ja4,omitempty"` // JA4 fingerprint of the QUIC ClientHello, prefixed with 'q'
+
+	Fingerprints FingerprintSet `json:"fingerprints,omitempty"` // fingerprint IDs calculated by all registered algorithms
+
 	UserAgent string `json:"user_agent,omitempty"` // User-Agent header, set by the caller
 }
 
@@ -43,6 +47,8 @@ func GenerateQUICFingerprint(gci *GatheredClientInitials) (*QUICFingerprint, err
 
 	qfp.NumID = binary.BigEndian.Uint64(h.Sum(nil))
 	qfp.HexID = FingerprintID(qfp.NumID).AsHex()
+	qfp.JA4 = gci.ClientHello.JA4
+	qfp.Fingerprints = qfp.calcFingerprintSet()
 
 	runtime.SetFinalizer(qfp, func(q *QUICFingerprint) {
 		q.ClientInitials = nil
@@ -0,0 +1,309 @@
+package clienthellod
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+)
+
+// SimilarityWeights maps the name of each field to its weight in the
+// similarity score. Fields with no or non-positive weight are not compared.
+//
+// Field names are the JSON names of the fields in [ClientHello] and
+// [QUICTransportParameters]. Transport parameters of a QUIC ClientHello are
+// prefixed with "transport_parameters.", e.g., "transport_parameters.tpids".
+type SimilarityWeights map[string]float64
+
+// DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS is used when no SimilarityWeights is
+// given. Fields that are more specific to a client weigh more.
+var DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS = SimilarityWeights{
+	"tls_handshake_version":  0.5,
+	"cipher_suites":          3,
+	"compression_methods":    0.5,
+	"extensions":             3,
+	"supported_groups":       2,
+	"ec_point_formats":       0.5,
+	"signature_algorithms":   2,
+	"alpn":                   1,
+	"compress_certificate":   1,
+	"record_size_limit":      0.5,
+	"supported_versions":     1,
+	"psk_key_exchange_modes": 0.5,
+	"key_share":              1,
+	"application_settings":   0.5,
+	"delegated_credentials":  0.5,
+
+	"transport_parameters.tpids":                               2,
+	"transport_parameters.max_idle_timeout":                    0.25,
+	"transport_parameters.max_udp_payload_size":                0.25,
+	"transport_parameters.initial_max_data":                    0.25,
+	"transport_parameters.initial_max_stream_data_bidi_local":  0.25,
+	"transport_parameters.initial_max_stream_data_bidi_remote": 0.25,
+	"transport_parameters.initial_max_stream_data_uni":         0.25,
+	"transport_parameters.initial_max_streams_bidi":            0.25,
+	"transport_parameters.initial_max_streams_uni":             0.25,
+	"transport_parameters.ack_delay_exponent":                  0.25,
+	"transport_parameters.max_ack_delay":                       0.25,
+	"transport_parameters.active_connection_id_limit":          0.25,
+}
+
+// SimilarityScore is the similarity between two fingerprints.
+type SimilarityScore struct {
+	Score  float64            `json:"score"`            // weighted average of Fields, from 0 (nothing in common) to 1 (identical)
+	Fields map[string]float64 `json:"fields,omitempty"` // similarity of each compared field, from 0 to 1
+}
+
+// ClientHelloSimilarity scores how similar two parsed ClientHellos are, field
+// by field, with [DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS] if weights is nil.
+//
+// Extensions and PSK key exchange modes are compared as sets, since some
+// clients shuffle them. Other lists are compared as sequences with the edit
+// distance, so a reordering scores lower than an exact match but higher than
+// a completely different list. Transport parameters are compared only if
+// either ClientHello is a QUIC ClientHello.
+func ClientHelloSimilarity(a, b *ClientHello, weights SimilarityWeights) *SimilarityScore {
+	if weights == nil {
+		weights = DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS
+	}
+
+	s := newSimilarityScorer(weights)
+	s.add("tls_handshake_version", valueSimilarity(a.TLSHandshakeVersion, b.TLSHandshakeVersion))
+	s.add("cipher_suites", sequenceSimilarity(a.CipherSuites, b.CipherSuites))
+	s.add("compression_methods", sequenceSimilarity(a.CompressionMethods, b.CompressionMethods))
+	s.add("extensions", setSimilarity(a.Extensions, b.Extensions))
+	s.add("supported_groups", sequenceSimilarity(a.NamedGroupList, b.NamedGroupList))
+	s.add("ec_point_formats", sequenceSimilarity(a.ECPointFormatList, b.ECPointFormatList))
+	s.add("signature_algorithms", sequenceSimilarity(a.SignatureSchemeList, b.SignatureSchemeList))
+	s.add("alpn", sequenceSimilarity(a.ALPN, b.ALPN))
+	s.add("compress_certificate", sequenceSimilarity(a.CertCompressAlgo, b.CertCompressAlgo))
+	s.add("record_size_limit", bytesSimilarity(a.RecordSizeLimit, b.RecordSizeLimit))
+	s.add("supported_versions", sequenceSimilarity(a.SupportedVersions, b.SupportedVersions))
+	s.add("psk_key_exchange_modes", setSimilarity(a.PSKKeyExchangeModes, b.PSKKeyExchangeModes))
+	s.add("key_share", sequenceSimilarity(a.KeyShare, b.KeyShare))
+	s.add("application_settings", sequenceSimilarity(a.ApplicationSettings, b.ApplicationSettings))
+	s.add("delegated_credentials", sequenceSimilarity(a.DelegatedCredentials, b.DelegatedCredentials))
+
+	if a.qtp != nil || b.qtp != nil {
+		qtpA, qtpB := a.qtp, b.qtp
+		if qtpA == nil {
+			qtpA = &QUICTransportParameters{}
+		}
+		if qtpB == nil {
+			qtpB = &QUICTransportParameters{}
+		}
+		s.addQUICTransportParameters("transport_parameters.", qtpA, qtpB)
+	}
+
+	return s.score()
+}
+
+// QUICTransportParametersSimilarity scores how similar two QUIC transport
+// parameters combinations are, field by field. The weights are looked up
+// with the field names prefixed with "transport_parameters.", same as in
+// ClientHelloSimilarity, and [DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS] is
+// used if weights is nil.
+func QUICTransportParametersSimilarity(a, b *QUICTransportParameters, weights SimilarityWeights) *SimilarityScore {
+	if weights == nil {
+		weights = DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS
+	}
+
+	if a == nil {
+		a = &QUICTransportParameters{}
+	}
+	if b == nil {
+		b = &QUICTransportParameters{}
+	}
+
+	s := newSimilarityScorer(weights)
+	s.addQUICTransportParameters("transport_parameters.", a, b)
+	return s.score()
+}
+
+func (s *similarityScorer) addQUICTransportParameters(prefix string, a, b *QUICTransportParameters) {
+	s.add(prefix+"tpids", setSimilarity(a.QTPIDs, b.QTPIDs))
+	s.add(prefix+"max_idle_timeout", bytesSimilarity(a.MaxIdleTimeout, b.MaxIdleTimeout))
+	s.add(prefix+"max_udp_payload_size", bytesSimilarity(a.MaxUDPPayloadSize, b.MaxUDPPayloadSize))
+	s.add(prefix+"initial_max_data", bytesSimilarity(a.InitialMaxData, b.InitialMaxData))
+	s.add(prefix+"initial_max_stream_data_bidi_local", bytesSimilarity(a.InitialMaxStreamDataBidiLocal, b.InitialMaxStreamDataBidiLocal))
+	s.add(prefix+"initial_max_stream_data_bidi_remote", bytesSimilarity(a.InitialMaxStreamDataBidiRemote, b.InitialMaxStreamDataBidiRemote))
+	s.add(prefix+"initial_max_stream_data_uni", bytesSimilarity(a.InitialMaxStreamDataUni, b.InitialMaxStreamDataUni))
+	s.add(prefix+"initial_max_streams_bidi", bytesSimilarity(a.InitialMaxStreamsBidi, b.InitialMaxStreamsBidi))
+	s.add(prefix+"initial_max_streams_uni", bytesSimilarity(a.InitialMaxStreamsUni, b.InitialMaxStreamsUni))
+	s.add(prefix+"ack_delay_exponent", bytesSimilarity(a.AckDelayExponent, b.AckDelayExponent))
+	s.add(prefix+"max_ack_delay", bytesSimilarity(a.MaxAckDelay, b.MaxAckDelay))
+	s.add(prefix+"active_connection_id_limit", bytesSimilarity(a.ActiveConnectionIDLimit, b.ActiveConnectionIDLimit))
+}
+
+// similarityScorer accumulates the weighted similarity of fields.
+type similarityScorer struct {
+	weights     SimilarityWeights
+	fields      map[string]float64
+	weightedSum float64
+	totalWeight float64
+}
+
+func newSimilarityScorer(weights SimilarityWeights) *similarityScorer {
+	return &similarityScorer{
+		weights: weights,
+		fields:  make(map[string]float64),
+	}
+}
+
+func (s *similarityScorer) add(field string, similarity float64) {
+	w := s.weights[field]
+	if w <= 0 {
+		return
+	}
+	s.fields[field] = similarity
+	s.weightedSum += w * similarity
+	s.totalWeight += w
+}
+
+func (s *similarityScorer) score() *SimilarityScore {
+	score := &SimilarityScore{Score: 1, Fields: s.fields} // nothing compared, nothing different
+	if s.totalWeight > 0 {
+		score.Score = s.weightedSum / s.totalWeight
+	}
+	return score
+}
+
+// valueSimilarity is 1 if the two values are equal, otherwise 0.
+func valueSimilarity[T comparable](a, b T) float64 {
+	if a == b {
+		return 1
+	}
+	return 0
+}
+
+// bytesSimilarity is 1 if the two byte slices are equal, otherwise 0.
+func bytesSimilarity(a, b []byte) float64 {
+	if bytes.Equal(a, b) {
+		return 1
+	}
+	return 0
+}
+
+// setSimilarity is the Jaccard index of two lists as multisets, or 1 if both
+// are empty.
+func setSimilarity[T comparable](a, b []T) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	count := make(map[T]int, len(a))
+	for _, v := range a {
+		count[v]++
+	}
+	intersection := 0
+	for _, v := range b {
+		if count[v] > 0 {
+			count[v]--
+			intersection++
+		}
+	}
+	return float64(intersection) / float64(len(a)+len(b)-intersection)
+}
+
+// sequenceSimilarity is 1 minus the Levenshtein distance of two lists divided
+// by the length of the longer one, or 1 if both are empty.
+func sequenceSimilarity[T comparable](a, b []T) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return 1 - float64(prev[len(b)])/float64(max(len(a), len(b)))
+}
+
+// SimilarityIndex holds known ClientHellos and finds the most similar ones to
+// a new ClientHello, e.g., to cluster variants of the same client.
+//
+// It is safe for concurrent use.
+type SimilarityIndex struct {
+	mutex   sync.RWMutex
+	entries []*SimilarityMatch
+	weights SimilarityWeights
+}
+
+// SimilarityMatch is a known ClientHello in a SimilarityIndex, scored against
+// the ClientHello being looked up.
+type SimilarityMatch struct {
+	Label       string       `json:"label"`
+	ClientHello *ClientHello `json:"-"`
+	*SimilarityScore
+}
+
+// NewSimilarityIndex creates a new empty SimilarityIndex using
+// [DEFAULT_CLIENTHELLO_SIMILARITY_WEIGHTS].
+func NewSimilarityIndex() *SimilarityIndex {
+	return &SimilarityIndex{}
+}
+
+// NewSimilarityIndexWithWeights creates a new empty SimilarityIndex using the
+// given weights.
+func NewSimilarityIndexWithWeights(weights SimilarityWeights) *SimilarityIndex {
+	return &SimilarityIndex{
+		weights: weights,
+	}
+}
+
+// Add adds a known ClientHello to the index under a label, e.g., "Chrome 120".
+// A label may be shared by multiple ClientHellos, e.g., variants of the same
+// client.
+func (idx *SimilarityIndex) Add(label string, ch *ClientHello) {
+	idx.mutex.Lock()
+	defer idx.mutex.Unlock()
+
+	idx.entries = append(idx.entries, &SimilarityMatch{
+		Label:       label,
+		ClientHello: ch,
+	})
+}
+
+// Len returns the number of ClientHellos in the index.
+func (idx *SimilarityIndex) Len() int {
+	idx.mutex.RLock()
+	defer idx.mutex.RUnlock()
+
+	return len(idx.entries)
+}
+
+// TopK scores the ClientHello against every known ClientHello in the index
+// and returns at most k most similar ones, most similar first. All of them
+// are returned if k is negative.
+func (idx *SimilarityIndex) TopK(ch *ClientHello, k int) []*SimilarityMatch {
+	idx.mutex.RLock()
+	matches := make([]*SimilarityMatch, 0, len(idx.entries))
+	for _, entry := range idx.entries {
+		matches = append(matches, &SimilarityMatch{
+			Label:           entry.Label,
+			ClientHello:     entry.ClientHello,
+			SimilarityScore: ClientHelloSimilarity(ch, entry.ClientHello, idx.weights),
+		})
+	}
+	idx.mutex.RUnlock()
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if k >= 0 && k < len(matches) {
+		matches = matches[:k]
+	}
+	return matches
+}
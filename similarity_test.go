@@ -0,0 +1,85 @@
+package clienthellod_test
+
+import (
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestClientHelloSimilarity(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome := uTLSClientHello(t, tls.HelloChrome_120, nil, 0x0301)
+	chromeShuffled := uTLSClientHello(t, tls.HelloChrome_120, nil, 0x0301)
+
+	if s := ClientHelloSimilarity(firefox, firefox, nil); s.Score != 1 {
+		t.Errorf("identical ClientHellos are expected to score 1, got %f", s.Score)
+	}
+	if s := ClientHelloSimilarity(chrome, chromeShuffled, nil); s.Score != 1 {
+		t.Errorf("shuffled extensions are expected to score 1, got %f: %v", s.Score, s.Fields)
+	}
+
+	s := ClientHelloSimilarity(firefox, chrome, nil)
+	if s.Score <= 0 || s.Score >= 1 {
+		t.Errorf("Firefox and Chrome are expected to be partially similar, got %f", s.Score)
+	}
+	if s.Fields["supported_versions"] >= 1 || s.Fields["alpn"] != 1 {
+		t.Errorf("field similarity mismatch, got %v", s.Fields)
+	}
+
+	weighted := ClientHelloSimilarity(firefox, chrome, SimilarityWeights{"alpn": 1})
+	if weighted.Score != 1 || len(weighted.Fields) != 1 {
+		t.Errorf("only alpn is expected to be compared, got %f: %v", weighted.Score, weighted.Fields)
+	}
+}
+
+func TestQUICTransportParametersSimilarity(t *testing.T) {
+	qtp := ParseQUICTransportParameters(rawQTPExtData_Chrome120)
+	if s := QUICTransportParametersSimilarity(qtp, qtp, nil); s.Score != 1 {
+		t.Errorf("identical transport parameters are expected to score 1, got %f", s.Score)
+	}
+
+	modified := *qtp
+	modified.InitialMaxData = []byte{0x00, 0x10, 0x00, 0x00}
+	modified.QTPIDs = modified.QTPIDs[1:]
+	s := QUICTransportParametersSimilarity(qtp, &modified, nil)
+	if s.Fields["transport_parameters.initial_max_data"] != 0 ||
+		s.Fields["transport_parameters.max_idle_timeout"] != 1 ||
+		s.Fields["transport_parameters.tpids"] != float64(len(modified.QTPIDs))/float64(len(qtp.QTPIDs)) {
+		t.Errorf("field similarity mismatch, got %v", s.Fields)
+	}
+	if s.Score <= 0 || s.Score >= 1 {
+		t.Errorf("transport parameters are expected to be partially similar, got %f", s.Score)
+	}
+}
+
+func TestSimilarityIndex(t *testing.T) {
+	idx := NewSimilarityIndex()
+	for _, parrot := range UTLSParrots() {
+		idx.Add(parrot.ID.Str(), parrot.ClientHello)
+	}
+	if idx.Len() != len(UTLSParrots()) {
+		t.Fatalf("index is expected to hold %d ClientHellos, got %d", len(UTLSParrots()), idx.Len())
+	}
+
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := idx.TopK(firefox, 3)
+	if len(matches) != 3 {
+		t.Fatalf("3 matches are expected, got %d", len(matches))
+	}
+	for i, expected := range []string{"Firefox-120", "Firefox-105", "Firefox-102"} {
+		if matches[i].Label != expected {
+			t.Errorf("match #%d is expected to be %s, got %s (%f)", i, expected, matches[i].Label, matches[i].Score)
+		}
+	}
+	if matches[0].Score != 1 || matches[1].Score >= matches[0].Score || matches[2].Score > matches[1].Score {
+		t.Errorf("matches are expected in descending order of score, got %f, %f, %f", matches[0].Score, matches[1].Score, matches[2].Score)
+	}
+}
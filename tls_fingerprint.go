@@ -1,6 +1,7 @@
 package clienthellod
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"net"
@@ -17,8 +18,12 @@ const DEFAULT_TLSFINGERPRINT_EXPIRY = 5 * time.Second
 type TLSFingerprinter struct {
 	mapClientHellos *sync.Map
 
-	timeout time.Duration
-	closed  atomic.Bool
+	timeout    time.Duration
+	scheme     FingerprintScheme
+	normPolicy NormalizationPolicy
+	echKeys    []*ECHKey
+	maxSize    int
+	closed     atomic.Bool
 }
 
 // NewTLSFingerprinter creates a new TLSFingerprinter.
@@ -43,17 +48,49 @@ func (tfp *TLSFingerprinter) SetTimeout(timeout time.Duration) {
 	tfp.timeout = timeout
 }
 
+// SetFingerprintScheme sets the scheme used to calculate the native fingerprint
+// IDs of ClientHellos handled after this call.
+func (tfp *TLSFingerprinter) SetFingerprintScheme(scheme FingerprintScheme) {
+	tfp.scheme = scheme
+}
+
+// SetNormalizationPolicy sets the policy used to normalize ClientHellos handled
+// after this call before calculating the normalized fingerprint IDs.
+func (tfp *TLSFingerprinter) SetNormalizationPolicy(policy NormalizationPolicy) {
+	tfp.normPolicy = policy
+}
+
+// SetECHKeys sets the ECHKeys used to decrypt the inner ClientHello from
+// encrypted_client_hello of ClientHellos handled after this call.
+func (tfp *TLSFingerprinter) SetECHKeys(keys []*ECHKey) {
+	tfp.echKeys = keys
+}
+
+// SetMaxClientHelloSize sets the maximum size of a ClientHello handshake
+// message to be reassembled from multiple TLS records. A non-positive size
+// means [DEFAULT_CLIENTHELLO_MAX_SIZE].
+func (tfp *TLSFingerprinter) SetMaxClientHelloSize(size int) {
+	tfp.maxSize = size
+}
+
 // HandleMessage handles a message.
 func (tfp *TLSFingerprinter) HandleMessage(from string, p []byte) error {
 	if tfp.closed.Load() {
 		return errors.New("TLSFingerprinter closed")
 	}
 
-	ch, err := UnmarshalClientHello(p)
+	ch, err := ReadClientHelloWithMaxSize(bytes.NewReader(p), tfp.maxSize)
 	if err != nil {
 		return err
 	}
 
+	ch.SetFingerprintScheme(tfp.scheme)
+	ch.SetNormalizationPolicy(tfp.normPolicy)
+	ch.SetECHKeys(tfp.echKeys)
+	if err = ch.ParseClientHello(); err != nil {
+		return err
+	}
+
 	tfp.mapClientHellos.Store(from, ch)
 	go func(timeoutOverride time.Duration, key string, oldCh *ClientHello) {
 		if timeoutOverride == time.Duration(0) {
@@ -74,11 +111,14 @@ func (tfp *TLSFingerprinter) HandleTCPConn(conn net.Conn) (rewindConn net.Conn,
 		return nil, errors.New("TLSFingerprinter closed")
 	}
 
-	ch, err := ReadClientHello(conn)
+	ch, err := ReadClientHelloWithMaxSize(conn, tfp.maxSize)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read ClientHello from connection: %w", err)
 	}
 
+	ch.SetFingerprintScheme(tfp.scheme)
+	ch.SetNormalizationPolicy(tfp.normPolicy)
+	ch.SetECHKeys(tfp.echKeys)
 	if err = ch.ParseClientHello(); err != nil {
 		return nil, fmt.Errorf("failed to parse ClientHello: %w", err)
 	}
@@ -0,0 +1,307 @@
+package clienthellod
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/gaukas/clienthellod/internal/utils"
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+// TLS libraries (or stacks) recognized by [ClientHello.ClassifyTLSLibrary].
+const (
+	TLS_LIBRARY_BORINGSSL = "boringssl" // Chrome, Chromium-based browsers
+	TLS_LIBRARY_NSS       = "nss"       // Firefox
+	TLS_LIBRARY_GO        = "go"        // Go crypto/tls
+	TLS_LIBRARY_OPENSSL   = "openssl"
+	TLS_LIBRARY_RUSTLS    = "rustls"
+	TLS_LIBRARY_SCHANNEL  = "schannel" // Windows
+	TLS_LIBRARY_APPLE     = "apple"    // SecureTransport and Network.framework, e.g., Safari
+	TLS_LIBRARY_JSSE      = "jsse"     // Java
+	TLS_LIBRARY_UTLS      = "utls"     // uTLS mimicking another library
+)
+
+// TLSLibraryCandidate is a TLS library scored by its traits found in a
+// ClientHello.
+type TLSLibraryCandidate struct {
+	Library string   `json:"library"`
+	Version string   `json:"version,omitempty"` // version hint, e.g., "1.1.1" for OpenSSL, empty if unknown
+	Score   float64  `json:"score"`             // weighted fraction of the traits of the library found, from 0 to 1
+	Traits  []string `json:"traits,omitempty"`  // traits of the library found
+}
+
+// TLSLibraryClassification is the likely TLS library sending a ClientHello.
+type TLSLibraryClassification struct {
+	Library    string                `json:"library"`
+	Version    string                `json:"version,omitempty"`
+	Confidence float64               `json:"confidence"` // from 0 to 1, the score of the library discounted by how close the runner-up is
+	Candidates []TLSLibraryCandidate `json:"candidates"` // all libraries, by score from the highest
+}
+
+// tlsLibraryTrait is a structural trait of the ClientHellos sent by a TLS
+// library. The weight of a trait is how specific it is to the library.
+type tlsLibraryTrait struct {
+	weight      float64
+	description string
+	check       func(ch *ClientHello) bool
+}
+
+var tlsLibraryTraits = map[string][]tlsLibraryTrait{
+	TLS_LIBRARY_BORINGSSL: {
+		{3, "GREASE", sendsGREASE},
+		{3, "application_settings (ALPS)", sendsALPS},
+		{2, "compress_certificate with brotli only", func(ch *ClientHello) bool {
+			return slices.Equal(ch.CertCompressAlgo, []uint16{uint16(tls.CertCompressionBrotli)})
+		}},
+		{1, "TLS 1.3 cipher suites in the order AES-128-GCM, AES-256-GCM, ChaCha20-Poly1305", tls13SuitesInOrder(0x1301, 0x1302, 0x1303)},
+		{2, "signature_algorithms starting with ecdsa_secp256r1_sha256, rsa_pss_rsae_sha256, rsa_pkcs1_sha256", signatureAlgorithmsStartWith(0x0403, 0x0804, 0x0401)},
+		{1, "no record_size_limit", negate(sendsRecordSizeLimit)},
+	},
+	TLS_LIBRARY_NSS: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{3, "record_size_limit", sendsRecordSizeLimit},
+		{2, "delegated_credentials", hasExtension(dicttls.ExtType_delegated_credentials)},
+		{2, "TLS 1.3 cipher suites in the order AES-128-GCM, ChaCha20-Poly1305, AES-256-GCM", tls13SuitesInOrder(0x1301, 0x1303, 0x1302)},
+		{2, "signature_algorithms starting with ecdsa_secp256r1_sha256, ecdsa_secp384r1_sha384, ecdsa_secp521r1_sha512", signatureAlgorithmsStartWith(0x0403, 0x0503, 0x0603)},
+		{1, "finite field groups in supported_groups", offersFFDHE},
+		{2, "extensions in the order server_name, extended_master_secret, renegotiation_info, supported_groups, ec_point_formats", extensionsInOrder(0, 23, 65281, 10, 11)},
+	},
+	TLS_LIBRARY_GO: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{3, "signature_algorithms_cert", hasExtension(dicttls.ExtType_signature_algorithms_cert)},
+		{3, "signature_algorithms starting with rsa_pss_rsae_sha256, ecdsa_secp256r1_sha256, ed25519", signatureAlgorithmsStartWith(0x0804, 0x0403, 0x0807)},
+		{1, "TLS 1.3 cipher suites in the order AES-128-GCM, AES-256-GCM, ChaCha20-Poly1305", tls13SuitesInOrder(0x1301, 0x1302, 0x1303)},
+		{1, "status_request and signed_certificate_timestamp", func(ch *ClientHello) bool {
+			return ch.StatusRequest != nil && ch.SignedCertificateTimestamp
+		}},
+		{1, "no padding", negate(hasExtension(dicttls.ExtType_padding))},
+		{2, "extensions in the order server_name, ec_point_formats, renegotiation_info, extended_master_secret, signed_certificate_timestamp, status_request, supported_groups, signature_algorithms", extensionsInOrder(0, 11, 65281, 23, 18, 5, 10, 13)},
+	},
+	TLS_LIBRARY_OPENSSL: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{3, "all 3 ec_point_formats", func(ch *ClientHello) bool { return len(ch.ECPointFormatList) == 3 }},
+		{2, "TLS 1.3 cipher suites in the order AES-256-GCM, ChaCha20-Poly1305, AES-128-GCM", tls13SuitesInOrder(0x1302, 0x1303, 0x1301)},
+		{2, "ed448 in signature_algorithms", hasSignatureAlgorithm(0x0808)},
+		{1, "encrypt_then_mac", func(ch *ClientHello) bool { return ch.EncryptThenMAC }},
+		{1, "x448 in supported_groups", hasGroup(dicttls.SupportedGroups_x448)},
+		{2, "extensions in the order server_name, ec_point_formats, supported_groups, session_ticket, encrypt_then_mac, extended_master_secret, signature_algorithms", extensionsInOrder(0, 11, 10, 35, 22, 23, 13)},
+	},
+	TLS_LIBRARY_RUSTLS: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{2, "TLS 1.3 cipher suites in the order AES-256-GCM, AES-128-GCM, ChaCha20-Poly1305", tls13SuitesInOrder(0x1302, 0x1301, 0x1303)},
+		{3, "signature_algorithms starting with ecdsa_secp384r1_sha384, ecdsa_secp256r1_sha256, ed25519", signatureAlgorithmsStartWith(0x0503, 0x0403, 0x0807)},
+		{2, "no CBC cipher suites", negate(offersCipherSuiteNamed(isCBCCipherSuite))},
+		{1, "no SHA-1 signature algorithms", negate(offersSHA1SignatureAlgorithm)},
+	},
+	TLS_LIBRARY_SCHANNEL: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{2, "TLS 1.3 cipher suites in the order AES-256-GCM, AES-128-GCM", tls13SuitesInOrder(0x1302, 0x1301)},
+		{3, "signature_algorithms starting with rsa_pss_rsae_sha256, rsa_pss_rsae_sha384, rsa_pss_rsae_sha512, rsa_pkcs1_sha256", signatureAlgorithmsStartWith(0x0804, 0x0805, 0x0806, 0x0401)},
+		{2, "DHE cipher suites", offersCipherSuiteNamed(isDHECipherSuite)},
+		{1, "no ChaCha20-Poly1305 for TLS 1.3", func(ch *ClientHello) bool { return !slices.Contains(ch.CipherSuites, tls.TLS_CHACHA20_POLY1305_SHA256) }},
+		{1, "extensions in the order server_name, status_request, supported_groups, ec_point_formats, signature_algorithms", extensionsInOrder(0, 5, 10, 11, 13)},
+	},
+	TLS_LIBRARY_APPLE: {
+		{2, "GREASE", sendsGREASE},
+		{1, "no application_settings (ALPS)", negate(sendsALPS)},
+		{2, "3DES cipher suites", offersCipherSuiteNamed(isTripleDESCipherSuite)},
+		{3, "duplicate rsa_pss_rsae_sha384 in signature_algorithms", func(ch *ClientHello) bool {
+			return countUint16(ch.SignatureSchemeList, 0x0805) > 1
+		}},
+		{2, "compress_certificate with zlib only", func(ch *ClientHello) bool {
+			return slices.Equal(ch.CertCompressAlgo, []uint16{uint16(tls.CertCompressionZlib)})
+		}},
+		{1, "no record_size_limit", negate(sendsRecordSizeLimit)},
+		{1, "extensions in the order supported_groups, ec_point_formats, application_layer_protocol_negotiation, status_request, signature_algorithms, signed_certificate_timestamp", extensionsInOrder(10, 11, 16, 5, 13, 18)},
+	},
+	TLS_LIBRARY_JSSE: {
+		{2, "no GREASE", negate(sendsGREASE)},
+		{3, "status_request_v2", hasExtension(dicttls.ExtType_status_request_v2)},
+		{2, "static ECDH cipher suites", offersCipherSuiteNamed(isStaticECDHCipherSuite)},
+		{2, "DSA signature algorithms", hasSignatureAlgorithm(0x0402)},
+		{1, "TLS_EMPTY_RENEGOTIATION_INFO_SCSV", func(ch *ClientHello) bool {
+			return slices.Contains(ch.CipherSuites, dicttls.TLS_EMPTY_RENEGOTIATION_INFO_SCSV)
+		}},
+	},
+}
+
+// utlsContradictions are traits of different libraries found together, which
+// no library but uTLS mixing its parrots sends.
+var utlsContradictions = []tlsLibraryTrait{
+	{1, "GREASE with record_size_limit, mixing BoringSSL and NSS", func(ch *ClientHello) bool { return sendsGREASE(ch) && sendsRecordSizeLimit(ch) }},
+	{1, "application_settings (ALPS) without GREASE over TCP", func(ch *ClientHello) bool { return ch.qtp == nil && sendsALPS(ch) && !sendsGREASE(ch) }},
+}
+
+// ClassifyTLSLibrary labels the ClientHello with the TLS library likely
+// sending it, based on structural traits such as GREASE, cipher suite and
+// signature algorithm orders and library-specific extensions. Unlike a
+// lookup of known fingerprints, it works for versions never seen.
+//
+// A ClientHello of uTLS mimicking a browser can only be told apart from the
+// browser by traits of different libraries found together, so a uTLS parrot
+// done right is classified as the library it mimics.
+func (ch *ClientHello) ClassifyTLSLibrary() *TLSLibraryClassification {
+	c := &TLSLibraryClassification{
+		Candidates: make([]TLSLibraryCandidate, 0, len(tlsLibraryTraits)+1),
+	}
+	for library, traits := range tlsLibraryTraits {
+		candidate := TLSLibraryCandidate{Library: library}
+		var total, found float64
+		for _, trait := range traits {
+			total += trait.weight
+			if trait.check(ch) {
+				found += trait.weight
+				candidate.Traits = append(candidate.Traits, trait.description)
+			}
+		}
+		candidate.Score = found / total
+		if library == TLS_LIBRARY_OPENSSL {
+			candidate.Version = openSSLVersion(ch)
+		}
+		c.Candidates = append(c.Candidates, candidate)
+	}
+	// any contradiction is conclusive
+	utls := TLSLibraryCandidate{Library: TLS_LIBRARY_UTLS}
+	for _, trait := range utlsContradictions {
+		if trait.check(ch) {
+			utls.Score = 1
+			utls.Traits = append(utls.Traits, trait.description)
+		}
+	}
+	c.Candidates = append(c.Candidates, utls)
+
+	sort.SliceStable(c.Candidates, func(i, j int) bool {
+		if c.Candidates[i].Score != c.Candidates[j].Score {
+			return c.Candidates[i].Score > c.Candidates[j].Score
+		}
+		return c.Candidates[i].Library < c.Candidates[j].Library
+	})
+
+	top := c.Candidates[0]
+	c.Library, c.Version = top.Library, top.Version
+	if top.Score > 0 {
+		margin := (top.Score - c.Candidates[1].Score) / top.Score
+		c.Confidence = top.Score * (0.5 + 0.5*margin)
+	}
+	return c
+}
+
+// ClassifyTLSLibrary labels the ClientHello in the QUIC Initial packets with
+// the TLS library likely sending it. See [ClientHello.ClassifyTLSLibrary].
+func (qfp *QUICFingerprint) ClassifyTLSLibrary() *TLSLibraryClassification {
+	if qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+		return nil
+	}
+	return qfp.ClientInitials.ClientHello.ClassifyTLSLibrary()
+}
+
+// openSSLVersion guesses the OpenSSL version by the features offered.
+func openSSLVersion(ch *ClientHello) string {
+	switch {
+	case !slices.Contains(ch.SupportedVersions, tls.VersionTLS13):
+		return "1.0.2"
+	case slices.Contains(ch.KeyShare, GROUP_X25519_MLKEM768):
+		return "3.5+"
+	case offersFFDHE(ch):
+		return "3.x"
+	}
+	return "1.1.1"
+}
+
+func hasExtension(id uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool { return slices.Contains(ch.Extensions, id) }
+}
+
+// extensionsInOrder checks that all the extensions ids are sent, in this
+// order relative to each other. Extensions not in ids are ignored.
+func extensionsInOrder(ids ...uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool {
+		i := 0
+		for _, ext := range ch.Extensions {
+			if i < len(ids) && ext == ids[i] {
+				i++
+			} else if slices.Contains(ids[i:], ext) {
+				return false
+			}
+		}
+		return i == len(ids)
+	}
+}
+
+func hasSignatureAlgorithm(scheme uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool { return slices.Contains(ch.SignatureSchemeList, scheme) }
+}
+
+func hasGroup(group uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool { return slices.Contains(ch.NamedGroupList, group) }
+}
+
+// signatureAlgorithmsStartWith checks the first signature algorithms, GREASE
+// ignored.
+func signatureAlgorithmsStartWith(schemes ...uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool {
+		list := slices.DeleteFunc(slices.Clone(ch.SignatureSchemeList), utils.IsGREASEUint16)
+		return len(list) >= len(schemes) && slices.Equal(list[:len(schemes)], schemes)
+	}
+}
+
+// tls13SuitesInOrder checks the order of the TLS 1.3 cipher suites offered,
+// which must be exactly suites.
+func tls13SuitesInOrder(suites ...uint16) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool {
+		var tls13 []uint16
+		for _, suite := range ch.CipherSuites {
+			if suite >= 0x1301 && suite <= 0x1305 {
+				tls13 = append(tls13, suite)
+			}
+		}
+		return slices.Equal(tls13, suites)
+	}
+}
+
+func offersFFDHE(ch *ClientHello) bool {
+	return slices.ContainsFunc(ch.NamedGroupList, func(group uint16) bool { return group >= 0x0100 && group <= 0x01ff })
+}
+
+func offersSHA1SignatureAlgorithm(ch *ClientHello) bool {
+	return slices.ContainsFunc(ch.SignatureSchemeList, func(scheme uint16) bool { return scheme&0xff00 == 0x0200 })
+}
+
+// offersCipherSuiteNamed checks if any cipher suite offered is known and
+// matched by its name.
+func offersCipherSuiteNamed(match func(name string) bool) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool {
+		return slices.ContainsFunc(ch.CipherSuites, func(suite uint16) bool {
+			name, ok := dicttls.DictCipherSuiteValueIndexed[suite]
+			return ok && match(name)
+		})
+	}
+}
+
+func isCBCCipherSuite(name string) bool {
+	return strings.Contains(name, "_CBC_")
+}
+
+func isTripleDESCipherSuite(name string) bool {
+	return strings.Contains(name, "_3DES_")
+}
+
+func isDHECipherSuite(name string) bool {
+	return strings.HasPrefix(name, "TLS_DHE_")
+}
+
+func isStaticECDHCipherSuite(name string) bool {
+	return strings.HasPrefix(name, "TLS_ECDH_ECDSA_") || strings.HasPrefix(name, "TLS_ECDH_RSA_")
+}
+
+func countUint16(list []uint16, v uint16) int {
+	n := 0
+	for _, e := range list {
+		if e == v {
+			n++
+		}
+	}
+	return n
+}
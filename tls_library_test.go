@@ -0,0 +1,222 @@
+package clienthellod_test
+
+import (
+	stdtls "crypto/tls"
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+// goClientHello captures the ClientHello sent by crypto/tls.
+func goClientHello(t *testing.T) *ClientHello {
+	c, s := net.Pipe()
+	defer c.Close()
+	defer s.Close()
+
+	go stdtls.Client(c, &stdtls.Config{ServerName: "example.com"}).Handshake() // nolint: errcheck
+	ch, err := ReadClientHello(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ch.ParseClientHello(); err != nil {
+		t.Fatal(err)
+	}
+	return ch
+}
+
+var (
+	// OpenSSL 1.1.1, e.g., curl
+	tlsLibrarySpec_OpenSSL = &tls.ClientHelloSpec{
+		TLSVersMin: tls.VersionTLS12,
+		TLSVersMax: tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_AES_256_GCM_SHA384, tls.TLS_CHACHA20_POLY1305_SHA256, tls.TLS_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA, tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		Extensions: []tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.SupportedPointsExtension{SupportedPoints: []uint8{0, 1, 2}},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519, tls.CurveP256, 30, tls.CurveP521, tls.CurveP384}}, // x448
+			&tls.SessionTicketExtension{},
+			&tls.GenericExtension{Id: 22}, // encrypt_then_mac
+			&tls.ExtendedMasterSecretExtension{},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{
+				tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512, tls.Ed25519, 0x0808, // ed448
+				tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512, tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512,
+			}},
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13, tls.VersionTLS12}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+			&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519}}},
+		},
+	}
+
+	tlsLibrarySpec_Rustls = &tls.ClientHelloSpec{
+		TLSVersMin: tls.VersionTLS12,
+		TLSVersMax: tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_AES_256_GCM_SHA384, tls.TLS_AES_128_GCM_SHA256, tls.TLS_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+		Extensions: []tls.TLSExtension{
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13, tls.VersionTLS12}},
+			&tls.SupportedPointsExtension{SupportedPoints: []uint8{0}},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{
+				tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP256AndSHA256, tls.Ed25519,
+				tls.PSSWithSHA512, tls.PSSWithSHA384, tls.PSSWithSHA256, tls.PKCS1WithSHA512, tls.PKCS1WithSHA384, tls.PKCS1WithSHA256,
+			}},
+			&tls.ExtendedMasterSecretExtension{},
+			&tls.SNIExtension{},
+			&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519}}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+			&tls.SessionTicketExtension{},
+		},
+	}
+
+	// Windows 11
+	tlsLibrarySpec_SChannel = &tls.ClientHelloSpec{
+		TLSVersMin: tls.VersionTLS12,
+		TLSVersMax: tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_AES_256_GCM_SHA384, tls.TLS_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			0x009f, 0x009e, // TLS_DHE_RSA_WITH_AES_256_GCM_SHA384, TLS_DHE_RSA_WITH_AES_128_GCM_SHA256
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA, tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		},
+		Extensions: []tls.TLSExtension{
+			&tls.SNIExtension{},
+			&tls.StatusRequestExtension{},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384}},
+			&tls.SupportedPointsExtension{SupportedPoints: []uint8{0}},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{
+				tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512, tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA1,
+				tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512, tls.ECDSAWithSHA1, tls.PKCS1WithSHA512,
+			}},
+			&tls.SessionTicketExtension{},
+			&tls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}},
+			&tls.ExtendedMasterSecretExtension{},
+			&tls.RenegotiationInfoExtension{Renegotiation: tls.RenegotiateOnceAsClient},
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13, tls.VersionTLS12}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+			&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519}}},
+		},
+	}
+
+	// Java 11
+	tlsLibrarySpec_JSSE = &tls.ClientHelloSpec{
+		TLSVersMin: tls.VersionTLS12,
+		TLSVersMax: tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_AES_128_GCM_SHA256, tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			0xc02e, 0xc02d, // TLS_ECDH_ECDSA_WITH_AES_256_GCM_SHA384, TLS_ECDH_ECDSA_WITH_AES_128_GCM_SHA256
+			tls.TLS_RSA_WITH_AES_256_GCM_SHA384, tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+			0x00ff, // TLS_EMPTY_RENEGOTIATION_INFO_SCSV
+		},
+		Extensions: []tls.TLSExtension{
+			&tls.StatusRequestExtension{},
+			&tls.SupportedCurvesExtension{Curves: []tls.CurveID{tls.X25519, tls.CurveP256, tls.CurveP384, tls.CurveP521, 0x0100}}, // ffdhe2048
+			&tls.SupportedPointsExtension{SupportedPoints: []uint8{0}},
+			&tls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{
+				tls.ECDSAWithP256AndSHA256, tls.ECDSAWithP384AndSHA384, tls.ECDSAWithP521AndSHA512,
+				tls.PSSWithSHA256, tls.PSSWithSHA384, tls.PSSWithSHA512, tls.PKCS1WithSHA256, tls.PKCS1WithSHA384, tls.PKCS1WithSHA512,
+				0x0402, // dsa_sha256
+			}},
+			&tls.SignatureAlgorithmsCertExtension{SupportedSignatureAlgorithms: []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256}},
+			&tls.StatusRequestV2Extension{},
+			&tls.ExtendedMasterSecretExtension{},
+			&tls.SupportedVersionsExtension{Versions: []uint16{tls.VersionTLS13, tls.VersionTLS12}},
+			&tls.PSKKeyExchangeModesExtension{Modes: []uint8{tls.PskModeDHE}},
+			&tls.KeyShareExtension{KeyShares: []tls.KeyShare{{Group: tls.X25519}}},
+		},
+	}
+)
+
+func TestClientHelloClassifyTLSLibrary(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Chrome 120 with record_size_limit of Firefox added: uTLS mixing parrots
+	mixed := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+	mixedSpec, err := mixed.ClientHelloSpec()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixedSpec.Extensions = append(mixedSpec.Extensions[:len(mixedSpec.Extensions)-1], &tls.FakeRecordSizeLimitExtension{Limit: 0x4001}, mixedSpec.Extensions[len(mixedSpec.Extensions)-1])
+
+	for _, tc := range []struct {
+		name    string
+		ch      *ClientHello
+		library string
+		version string
+	}{
+		{"Chrome120", uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10), TLS_LIBRARY_BORINGSSL, ""},
+		{"Edge106", uTLSClientHello(t, tls.HelloEdge_106, nil, tls.VersionTLS10), TLS_LIBRARY_BORINGSSL, ""},
+		{"Firefox126", firefox, TLS_LIBRARY_NSS, ""},
+		{"Firefox120", uTLSClientHello(t, tls.HelloFirefox_120, nil, tls.VersionTLS10), TLS_LIBRARY_NSS, ""},
+		{"Safari16", uTLSClientHello(t, tls.HelloSafari_16_0, nil, tls.VersionTLS10), TLS_LIBRARY_APPLE, ""},
+		{"iOS14", uTLSClientHello(t, tls.HelloIOS_14, nil, tls.VersionTLS10), TLS_LIBRARY_APPLE, ""},
+		{"Go", goClientHello(t), TLS_LIBRARY_GO, ""},
+		{"OpenSSL", uTLSClientHello(t, tls.HelloCustom, tlsLibrarySpec_OpenSSL, tls.VersionTLS10), TLS_LIBRARY_OPENSSL, "1.1.1"},
+		{"Rustls", uTLSClientHello(t, tls.HelloCustom, tlsLibrarySpec_Rustls, tls.VersionTLS10), TLS_LIBRARY_RUSTLS, ""},
+		{"SChannel", uTLSClientHello(t, tls.HelloCustom, tlsLibrarySpec_SChannel, tls.VersionTLS10), TLS_LIBRARY_SCHANNEL, ""},
+		{"JSSE", uTLSClientHello(t, tls.HelloCustom, tlsLibrarySpec_JSSE, tls.VersionTLS10), TLS_LIBRARY_JSSE, ""},
+		{"uTLS", uTLSClientHello(t, tls.HelloCustom, mixedSpec, tls.VersionTLS10), TLS_LIBRARY_UTLS, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.ch.ClassifyTLSLibrary()
+			if c.Library != tc.library || c.Version != tc.version {
+				t.Fatalf("library mismatch, expecting %s %s, got %s %s: %+v", tc.library, tc.version, c.Library, c.Version, c.Candidates)
+			}
+			if c.Confidence <= 0 || c.Confidence > c.Candidates[0].Score {
+				t.Errorf("confidence %f out of range (0, %f]", c.Confidence, c.Candidates[0].Score)
+			}
+			if len(c.Candidates) != 9 {
+				t.Errorf("expecting 9 candidates, got %d", len(c.Candidates))
+			}
+		})
+	}
+}
+
+func TestQUICFingerprintClassifyTLSLibrary(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		library string
+	}{
+		{"Chrome125", TLS_LIBRARY_BORINGSSL},
+		{"Firefox126", TLS_LIBRARY_NSS},
+		{"Firefox126_0-RTT", TLS_LIBRARY_NSS},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+			for _, d := range mapGatheredClientInitials[tc.name] {
+				cip, err := UnmarshalQUICClientInitialPacket(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = gci.AddPacket(cip); err != nil {
+					t.Fatal(err)
+				}
+			}
+			qfp, err := GenerateQUICFingerprint(gci)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c := qfp.ClassifyTLSLibrary(); c.Library != tc.library {
+				t.Errorf("library mismatch, expecting %s, got %s: %+v", tc.library, c.Library, c.Candidates)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package clienthellod
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	tls "github.com/refraction-networking/utls"
+	"github.com/refraction-networking/utls/dicttls"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	EXTENSION_APPLICATION_SETTINGS_NEW uint16 = 0x44cd // application_settings(17613), new ALPS codepoint used by Chrome since 133
+)
+
+// Browser families recognized in a User-Agent.
+const (
+	USER_AGENT_FAMILY_CHROME  = "Chrome"
+	USER_AGENT_FAMILY_EDGE    = "Edge"
+	USER_AGENT_FAMILY_OPERA   = "Opera"
+	USER_AGENT_FAMILY_FIREFOX = "Firefox"
+	USER_AGENT_FAMILY_SAFARI  = "Safari"
+)
+
+// Browser engines, which decide the TLS stack of a browser.
+const (
+	USER_AGENT_ENGINE_CHROMIUM = "chromium" // BoringSSL
+	USER_AGENT_ENGINE_GECKO    = "gecko"    // NSS
+	USER_AGENT_ENGINE_WEBKIT   = "webkit"   // Apple's TLS stack, also used by all browsers on iOS
+)
+
+// Verdicts of a User-Agent consistency check.
+const (
+	USER_AGENT_CONSISTENT = "consistent" // the fingerprint matches the profile of the claimed browser
+	USER_AGENT_MISMATCH   = "mismatch"   // the fingerprint contradicts the profile of the claimed browser
+	USER_AGENT_UNKNOWN    = "unknown"    // the User-Agent is missing or not a recognized browser
+)
+
+// UserAgent is a browser recognized in a User-Agent header.
+type UserAgent struct {
+	Family        string `json:"family"`         // e.g., USER_AGENT_FAMILY_CHROME
+	Version       int    `json:"version"`        // major version of the browser
+	Engine        string `json:"engine"`         // e.g., USER_AGENT_ENGINE_CHROMIUM
+	EngineVersion int    `json:"engine_version"` // major version of the engine, e.g., the Chromium version of Edge and Opera
+}
+
+var (
+	userAgentEdge      = regexp.MustCompile(`\bEdg/(\d+)`)
+	userAgentOpera     = regexp.MustCompile(`\bOPR/(\d+)`)
+	userAgentChrome    = regexp.MustCompile(`\b(?:Chrome|Chromium)/(\d+)`)
+	userAgentChromeIOS = regexp.MustCompile(`\bCriOS/(\d+)`)
+	userAgentEdgeIOS   = regexp.MustCompile(`\bEdgiOS/(\d+)`)
+	userAgentFirefox   = regexp.MustCompile(`\bFirefox/(\d+)`)
+	userAgentFxiOS     = regexp.MustCompile(`\bFxiOS/(\d+)`)
+	userAgentSafari    = regexp.MustCompile(`\bVersion/(\d+)(?:\.\d+)*(?: Mobile/\w+)? Safari/`)
+)
+
+// ParseUserAgent recognizes the browser in a User-Agent header. It returns
+// nil if the User-Agent is not of a recognized browser, e.g., a library or a
+// command-line tool.
+func ParseUserAgent(userAgent string) *UserAgent { // skipcq: GO-R1005
+	major := func(re *regexp.Regexp) (int, bool) {
+		m := re.FindStringSubmatch(userAgent)
+		if m == nil {
+			return 0, false
+		}
+		v, err := strconv.Atoi(m[1])
+		return v, err == nil
+	}
+
+	// iOS browsers are all on WebKit, whatever they claim to be
+	if v, ok := major(userAgentChromeIOS); ok {
+		return &UserAgent{Family: USER_AGENT_FAMILY_CHROME, Version: v, Engine: USER_AGENT_ENGINE_WEBKIT}
+	}
+	if v, ok := major(userAgentEdgeIOS); ok {
+		return &UserAgent{Family: USER_AGENT_FAMILY_EDGE, Version: v, Engine: USER_AGENT_ENGINE_WEBKIT}
+	}
+	if v, ok := major(userAgentFxiOS); ok {
+		return &UserAgent{Family: USER_AGENT_FAMILY_FIREFOX, Version: v, Engine: USER_AGENT_ENGINE_WEBKIT}
+	}
+
+	if chromium, ok := major(userAgentChrome); ok {
+		ua := &UserAgent{Family: USER_AGENT_FAMILY_CHROME, Version: chromium, Engine: USER_AGENT_ENGINE_CHROMIUM, EngineVersion: chromium}
+		if v, ok := major(userAgentEdge); ok {
+			ua.Family, ua.Version = USER_AGENT_FAMILY_EDGE, v
+		} else if v, ok := major(userAgentOpera); ok {
+			ua.Family, ua.Version = USER_AGENT_FAMILY_OPERA, v
+		}
+		return ua
+	}
+	if v, ok := major(userAgentFirefox); ok {
+		return &UserAgent{Family: USER_AGENT_FAMILY_FIREFOX, Version: v, Engine: USER_AGENT_ENGINE_GECKO, EngineVersion: v}
+	}
+	if v, ok := major(userAgentSafari); ok {
+		return &UserAgent{Family: USER_AGENT_FAMILY_SAFARI, Version: v, Engine: USER_AGENT_ENGINE_WEBKIT, EngineVersion: v}
+	}
+	return nil
+}
+
+// UserAgentVerdict is the result of checking a fingerprint against the
+// profile of the browser claimed by the User-Agent.
+type UserAgentVerdict struct {
+	UserAgent      *UserAgent `json:"user_agent,omitempty"`      // nil if not recognized
+	Verdict        string     `json:"verdict"`                   // e.g., USER_AGENT_MISMATCH
+	Mismatches     []string   `json:"mismatches,omitempty"`      // what the fingerprint contradicts, one per line
+	SoftMismatches []string   `json:"soft_mismatches,omitempty"` // what the fingerprint misses of traits depending on the platform or configuration, not affecting Verdict
+}
+
+// userAgentExpectation is a trait the ClientHello of a browser engine is
+// expected to have since a version.
+type userAgentExpectation struct {
+	engine      string
+	minVersion  int  // engine version since which the trait is expected, 0 for all
+	tlsOnly     bool // not expected in QUIC ClientHellos
+	advisory    bool // reported in SoftMismatches, e.g., enabled by default on some platforms only
+	description string
+	check       func(ch *ClientHello) bool
+}
+
+var userAgentExpectations = []userAgentExpectation{
+	{USER_AGENT_ENGINE_CHROMIUM, 70, false, false, "offer TLS 1.3", offersTLS13},
+	{USER_AGENT_ENGINE_CHROMIUM, 70, true, false, "send GREASE", sendsGREASE},
+	{USER_AGENT_ENGINE_CHROMIUM, 91, false, false, "send application_settings (ALPS)", sendsALPS},
+	{USER_AGENT_ENGINE_CHROMIUM, 124, false, true, "send a post-quantum key share (X25519Kyber768Draft00 or X25519MLKEM768)", sendsPQKeyShare}, // rolled out by platform, and can be disabled by policy
+	{USER_AGENT_ENGINE_CHROMIUM, 0, false, false, "not send record_size_limit", negate(sendsRecordSizeLimit)},
+
+	{USER_AGENT_ENGINE_GECKO, 63, false, false, "offer TLS 1.3", offersTLS13},
+	{USER_AGENT_ENGINE_GECKO, 65, false, false, "send record_size_limit", sendsRecordSizeLimit},
+	{USER_AGENT_ENGINE_GECKO, 0, false, false, "not send GREASE", negate(sendsGREASE)},
+	{USER_AGENT_ENGINE_GECKO, 0, false, false, "not send application_settings (ALPS)", negate(sendsALPS)},
+
+	{USER_AGENT_ENGINE_WEBKIT, 0, true, false, "send GREASE", sendsGREASE},
+	{USER_AGENT_ENGINE_WEBKIT, 0, false, false, "not send application_settings (ALPS)", negate(sendsALPS)},
+	{USER_AGENT_ENGINE_WEBKIT, 0, false, false, "not send record_size_limit", negate(sendsRecordSizeLimit)},
+}
+
+// CheckUserAgent checks the ClientHello against the profile of the browser
+// claimed by its UserAgent, which is set by the caller, e.g., from the
+// User-Agent header of the HTTP request sent over the same connection.
+//
+// The profiles cover only the traits stable across versions and platforms of
+// each browser engine, so a USER_AGENT_MISMATCH verdict is a strong sign of
+// a spoofed User-Agent or a mimicked ClientHello, while USER_AGENT_CONSISTENT
+// does not prove the User-Agent is genuine.
+func (ch *ClientHello) CheckUserAgent() *UserAgentVerdict {
+	return ch.checkUserAgent(ch.UserAgent, false)
+}
+
+// CheckUserAgent checks the ClientHello in the QUIC Initial packets against
+// the profile of the browser claimed by its UserAgent. See
+// [ClientHello.CheckUserAgent].
+func (qfp *QUICFingerprint) CheckUserAgent() *UserAgentVerdict {
+	if qfp.ClientInitials == nil || qfp.ClientInitials.ClientHello == nil {
+		return &UserAgentVerdict{UserAgent: ParseUserAgent(qfp.UserAgent), Verdict: USER_AGENT_UNKNOWN}
+	}
+	return qfp.ClientInitials.ClientHello.checkUserAgent(qfp.UserAgent, true)
+}
+
+func (ch *ClientHello) checkUserAgent(userAgent string, quic bool) *UserAgentVerdict {
+	v := &UserAgentVerdict{
+		UserAgent: ParseUserAgent(userAgent),
+		Verdict:   USER_AGENT_UNKNOWN,
+	}
+	if v.UserAgent == nil {
+		return v
+	}
+
+	v.Verdict = USER_AGENT_CONSISTENT
+	for _, e := range userAgentExpectations {
+		if e.engine != v.UserAgent.Engine || v.UserAgent.EngineVersion < e.minVersion || (quic && e.tlsOnly) {
+			continue
+		}
+		if e.check(ch) {
+			continue
+		}
+		mismatch := fmt.Sprintf("%s %d is expected to %s", v.UserAgent.Family, v.UserAgent.Version, e.description)
+		if e.advisory {
+			v.SoftMismatches = append(v.SoftMismatches, mismatch)
+		} else {
+			v.Verdict = USER_AGENT_MISMATCH
+			v.Mismatches = append(v.Mismatches, mismatch)
+		}
+	}
+	return v
+}
+
+func offersTLS13(ch *ClientHello) bool {
+	return slices.Contains(ch.SupportedVersions, tls.VersionTLS13)
+}
+
+func sendsGREASE(ch *ClientHello) bool {
+	return slices.Contains(ch.CipherSuites, tls.GREASE_PLACEHOLDER) || slices.Contains(ch.Extensions, tls.GREASE_PLACEHOLDER)
+}
+
+func sendsALPS(ch *ClientHello) bool {
+	return slices.Contains(ch.Extensions, dicttls.ExtType_application_settings) || slices.Contains(ch.Extensions, EXTENSION_APPLICATION_SETTINGS_NEW)
+}
+
+func sendsPQKeyShare(ch *ClientHello) bool {
+	return ch.KeyShareAnalysis != nil && ch.KeyShareAnalysis.PQHybridKeyShare
+}
+
+func sendsRecordSizeLimit(ch *ClientHello) bool {
+	return slices.Contains(ch.Extensions, dicttls.ExtType_record_size_limit)
+}
+
+func negate(check func(ch *ClientHello) bool) func(ch *ClientHello) bool {
+	return func(ch *ClientHello) bool { return !check(ch) }
+}
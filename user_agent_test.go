@@ -0,0 +1,108 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+const (
+	userAgentChrome126  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	userAgentChrome120  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	userAgentFirefox126 = "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:126.0) Gecko/20100101 Firefox/126.0"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		userAgent string
+		expected  *UserAgent
+	}{
+		{"Chrome", userAgentChrome126, &UserAgent{Family: USER_AGENT_FAMILY_CHROME, Version: 126, Engine: USER_AGENT_ENGINE_CHROMIUM, EngineVersion: 126}},
+		{"Edge", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36 Edg/125.0.2535.92", &UserAgent{Family: USER_AGENT_FAMILY_EDGE, Version: 125, Engine: USER_AGENT_ENGINE_CHROMIUM, EngineVersion: 125}},
+		{"Opera", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/124.0.0.0 Safari/537.36 OPR/110.0.0.0", &UserAgent{Family: USER_AGENT_FAMILY_OPERA, Version: 110, Engine: USER_AGENT_ENGINE_CHROMIUM, EngineVersion: 124}},
+		{"Firefox", userAgentFirefox126, &UserAgent{Family: USER_AGENT_FAMILY_FIREFOX, Version: 126, Engine: USER_AGENT_ENGINE_GECKO, EngineVersion: 126}},
+		{"Safari", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", &UserAgent{Family: USER_AGENT_FAMILY_SAFARI, Version: 17, Engine: USER_AGENT_ENGINE_WEBKIT, EngineVersion: 17}},
+		{"Chrome on iOS", "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0.6478.54 Mobile/15E148 Safari/604.1", &UserAgent{Family: USER_AGENT_FAMILY_CHROME, Version: 126, Engine: USER_AGENT_ENGINE_WEBKIT}},
+		{"curl", "curl/8.8.0", nil},
+		{"empty", "", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ua := ParseUserAgent(tc.userAgent); !reflect.DeepEqual(ua, tc.expected) {
+				t.Errorf("User-Agent mismatch, expecting %+v, got %+v", tc.expected, ua)
+			}
+		})
+	}
+}
+
+func TestClientHelloCheckUserAgent(t *testing.T) {
+	firefox, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome120 := uTLSClientHello(t, tls.HelloChrome_120, nil, tls.VersionTLS10)
+	chrome120PQ := uTLSClientHello(t, tls.HelloChrome_120_PQ, nil, tls.VersionTLS10)
+
+	for _, tc := range []struct {
+		name           string
+		ch             *ClientHello
+		userAgent      string
+		verdict        string
+		mismatches     int
+		softMismatches int
+	}{
+		{"Firefox as Firefox", firefox, userAgentFirefox126, USER_AGENT_CONSISTENT, 0, 0},
+		{"Firefox as Chrome", firefox, userAgentChrome126, USER_AGENT_MISMATCH, 3, 1}, // no GREASE or ALPS, and record_size_limit, and no PQ key share
+		{"Chrome as Chrome", chrome120, userAgentChrome120, USER_AGENT_CONSISTENT, 0, 0},
+		{"Chrome without PQ as Chrome 126", chrome120, userAgentChrome126, USER_AGENT_CONSISTENT, 0, 1}, // PQ disabled by platform or policy
+		{"Chrome with PQ as Chrome 126", chrome120PQ, userAgentChrome126, USER_AGENT_CONSISTENT, 0, 0},
+		{"Chrome as Firefox", chrome120, userAgentFirefox126, USER_AGENT_MISMATCH, 3, 0}, // GREASE and ALPS, and no record_size_limit
+		{"Firefox as curl", firefox, "curl/8.8.0", USER_AGENT_UNKNOWN, 0, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.ch.UserAgent = tc.userAgent
+			v := tc.ch.CheckUserAgent()
+			if v.Verdict != tc.verdict || len(v.Mismatches) != tc.mismatches || len(v.SoftMismatches) != tc.softMismatches {
+				t.Errorf("verdict mismatch, expecting %s with %d mismatches and %d soft mismatches, got %s with %v and %v",
+					tc.verdict, tc.mismatches, tc.softMismatches, v.Verdict, v.Mismatches, v.SoftMismatches)
+			}
+		})
+	}
+}
+
+func TestQUICFingerprintCheckUserAgent(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		userAgent string
+		verdict   string
+	}{
+		{"Chrome125", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/125.0.0.0 Safari/537.36", USER_AGENT_CONSISTENT}, // no GREASE in QUIC is expected
+		{"Firefox126", userAgentFirefox126, USER_AGENT_CONSISTENT},
+		{"Firefox126", userAgentChrome126, USER_AGENT_MISMATCH},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			gci := GatherClientInitialsWithDeadline(time.Now().Add(1 * time.Second))
+			for _, d := range mapGatheredClientInitials[tc.name] {
+				cip, err := UnmarshalQUICClientInitialPacket(d)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = gci.AddPacket(cip); err != nil {
+					t.Fatal(err)
+				}
+			}
+			qfp, err := GenerateQUICFingerprint(gci)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			qfp.UserAgent = tc.userAgent
+			if v := qfp.CheckUserAgent(); v.Verdict != tc.verdict {
+				t.Errorf("verdict mismatch, expecting %s, got %s with %v", tc.verdict, v.Verdict, v.Mismatches)
+			}
+		})
+	}
+}
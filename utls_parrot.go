@@ -0,0 +1,192 @@
+package clienthellod
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	tls "github.com/refraction-networking/utls"
+)
+
+// UTLSParrotServerName is the server name used to generate the ClientHellos
+// of uTLS parrots.
+const UTLSParrotServerName = "example.com"
+
+// utlsParrotIDs are all the ClientHelloIDs of uTLS mimicking a real client.
+// Randomized and custom ClientHelloIDs are excluded.
+var utlsParrotIDs = []tls.ClientHelloID{
+	tls.HelloGolang,
+	tls.HelloFirefox_55, tls.HelloFirefox_56, tls.HelloFirefox_63, tls.HelloFirefox_65,
+	tls.HelloFirefox_99, tls.HelloFirefox_102, tls.HelloFirefox_105, tls.HelloFirefox_120,
+	tls.HelloChrome_58, tls.HelloChrome_62, tls.HelloChrome_70, tls.HelloChrome_72,
+	tls.HelloChrome_83, tls.HelloChrome_87, tls.HelloChrome_96, tls.HelloChrome_100,
+	tls.HelloChrome_102, tls.HelloChrome_106_Shuffle,
+	tls.HelloChrome_100_PSK, tls.HelloChrome_112_PSK_Shuf, tls.HelloChrome_114_Padding_PSK_Shuf,
+	tls.HelloChrome_115_PQ, tls.HelloChrome_115_PQ_PSK,
+	tls.HelloChrome_120, tls.HelloChrome_120_PQ,
+	tls.HelloIOS_11_1, tls.HelloIOS_12_1, tls.HelloIOS_13, tls.HelloIOS_14,
+	tls.HelloAndroid_11_OkHttp,
+	tls.HelloEdge_85, tls.HelloEdge_106,
+	tls.HelloSafari_16_0,
+	tls.Hello360_7_5, tls.Hello360_11_0,
+	tls.HelloQQ_11_1,
+}
+
+// UTLSParrot is a ClientHello generated by uTLS with a ClientHelloID.
+type UTLSParrot struct {
+	ID          tls.ClientHelloID
+	ClientHello *ClientHello
+}
+
+var (
+	utlsParrotCatalog     []*UTLSParrot
+	utlsParrotCatalogOnce sync.Once
+)
+
+// UTLSParrots returns the ClientHellos generated by uTLS for all of its
+// ClientHelloIDs mimicking a real client, with [UTLSParrotServerName] as
+// the server name. ClientHelloIDs uTLS fails to generate a ClientHello for
+// (e.g., those requiring a session to resume) are skipped.
+//
+// The catalog is generated offline on the first call and cached.
+func UTLSParrots() []*UTLSParrot {
+	utlsParrotCatalogOnce.Do(func() {
+		for _, id := range utlsParrotIDs {
+			ch, err := newUTLSParrotClientHello(id)
+			if err != nil {
+				continue
+			}
+			utlsParrotCatalog = append(utlsParrotCatalog, &UTLSParrot{ID: id, ClientHello: ch})
+		}
+	})
+	return utlsParrotCatalog
+}
+
+// newUTLSParrotClientHello generates the ClientHello of a uTLS ClientHelloID
+// without connecting to anywhere and parses it.
+func newUTLSParrotClientHello(id tls.ClientHelloID) (ch *ClientHello, err error) {
+	defer func() { // uTLS may panic on ClientHelloIDs not supported any more
+		if r := recover(); r != nil {
+			err = fmt.Errorf("uTLS failed to generate ClientHello for %s: %v", id.Str(), r)
+		}
+	}()
+
+	uconn := tls.UClient(nil, &tls.Config{ServerName: UTLSParrotServerName}, id)
+	if err = uconn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+
+	handshake := uconn.HandshakeState.Hello.Raw
+	if len(handshake) == 0 { // HelloGolang is marshaled by crypto/tls codepath
+		if handshake, err = uconn.HandshakeState.Hello.Marshal(); err != nil {
+			return nil, err
+		}
+	}
+	record := append([]byte{0x16, 0x03, 0x01, byte(len(handshake) >> 8), byte(len(handshake))}, handshake...)
+	return UnmarshalClientHello(record)
+}
+
+// UTLSParrotMatch is a uTLS parrot compared with a ClientHello.
+type UTLSParrotMatch struct {
+	ClientHelloID string                 `json:"client_hello_id"`  // e.g., "Chrome-120"
+	Distance      int                    `json:"distance"`         // 0 if no difference is found
+	NormHexIDSame bool                   `json:"norm_hex_id_same"` // the parrot has the same normalized ID
+	Differences   []UTLSParrotDifference `json:"differences,omitempty"`
+
+	Parrot *UTLSParrot `json:"-"`
+}
+
+// UTLSParrotDifference is the difference of a field between a ClientHello and
+// a uTLS parrot.
+type UTLSParrotDifference struct {
+	Field     string   `json:"field"`
+	Missing   []string `json:"missing,omitempty"`   // values in the parrot but not in the ClientHello
+	Extra     []string `json:"extra,omitempty"`     // values in the ClientHello but not in the parrot
+	Reordered bool     `json:"reordered,omitempty"` // common values are in different orders
+}
+
+// NearestUTLSParrots compares the ClientHello with every uTLS parrot in
+// [UTLSParrots] and returns at most k closest matches, closest first.
+//
+// The distance is the number of values missing or extra in each field, plus
+// one for each field in a different order. Since uTLS and Chrome shuffle the
+// extensions, the order of extensions is reported but not counted.
+func (ch *ClientHello) NearestUTLSParrots(k int) []*UTLSParrotMatch {
+	parrots := UTLSParrots()
+	matches := make([]*UTLSParrotMatch, 0, len(parrots))
+	_, normHexID := ch.FingerprintIDWithScheme(ch.scheme)
+	for _, parrot := range parrots {
+		m := ch.matchUTLSParrot(parrot)
+		_, parrotNormHexID := parrot.ClientHello.normalized(ch.normPolicy).calcNumericID(ch.scheme, true)
+		m.NormHexIDSame = parrotNormHexID == normHexID
+		matches = append(matches, m)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Distance < matches[j].Distance
+	})
+	if k >= 0 && k < len(matches) {
+		matches = matches[:k]
+	}
+	return matches
+}
+
+func (ch *ClientHello) matchUTLSParrot(parrot *UTLSParrot) *UTLSParrotMatch {
+	p := parrot.ClientHello
+	m := &UTLSParrotMatch{
+		ClientHelloID: parrot.ID.Str(),
+		Parrot:        parrot,
+	}
+
+	add := func(field string, missing, extra []string, reordered, countReordered bool) {
+		if len(missing) == 0 && len(extra) == 0 && !reordered {
+			return
+		}
+		m.Differences = append(m.Differences, UTLSParrotDifference{
+			Field:     field,
+			Missing:   missing,
+			Extra:     extra,
+			Reordered: reordered,
+		})
+		m.Distance += len(missing) + len(extra)
+		if reordered && countReordered {
+			m.Distance++
+		}
+	}
+	hex16 := func(v uint16) string { return fmt.Sprintf("0x%04x", v) }
+	hex8 := func(v uint8) string { return fmt.Sprintf("0x%02x", v) }
+	str := func(v string) string { return v }
+
+	var missing, extra []string
+	var reordered bool
+	missing, extra, reordered = diffValues(ch.CipherSuites, p.CipherSuites, hex16)
+	add("cipher_suites", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.CompressionMethods, p.CompressionMethods, hex8)
+	add("compression_methods", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.Extensions, p.Extensions, hex16)
+	add("extensions", missing, extra, reordered, false)
+	missing, extra, reordered = diffValues(ch.NamedGroupList, p.NamedGroupList, hex16)
+	add("supported_groups", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.ECPointFormatList, p.ECPointFormatList, hex8)
+	add("ec_point_formats", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.SignatureSchemeList, p.SignatureSchemeList, hex16)
+	add("signature_algorithms", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.ALPN, p.ALPN, str)
+	add("alpn", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.CertCompressAlgo, p.CertCompressAlgo, hex16)
+	add("compress_certificate", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.RecordSizeLimit, p.RecordSizeLimit, hex8)
+	add("record_size_limit", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.SupportedVersions, p.SupportedVersions, hex16)
+	add("supported_versions", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.PSKKeyExchangeModes, p.PSKKeyExchangeModes, hex8)
+	add("psk_key_exchange_modes", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.KeyShare, p.KeyShare, hex16)
+	add("key_share", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.ApplicationSettings, p.ApplicationSettings, str)
+	add("application_settings", missing, extra, reordered, true)
+	missing, extra, reordered = diffValues(ch.DelegatedCredentials, p.DelegatedCredentials, hex16)
+	add("delegated_credentials", missing, extra, reordered, true)
+
+	return m
+}
@@ -0,0 +1,52 @@
+package clienthellod_test
+
+import (
+	"reflect"
+	"testing"
+
+	. "github.com/gaukas/clienthellod"
+	tls "github.com/refraction-networking/utls"
+)
+
+func TestNearestUTLSParrots(t *testing.T) {
+	if len(UTLSParrots()) == 0 {
+		t.Fatal("no uTLS parrot generated")
+	}
+
+	t.Run("Firefox126", func(t *testing.T) {
+		ch, err := UnmarshalClientHello(tlsClientHello_Firefox126)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches := ch.NearestUTLSParrots(-1)
+		if len(matches) != len(UTLSParrots()) {
+			t.Fatalf("all %d parrots are expected to be returned, got %d", len(UTLSParrots()), len(matches))
+		}
+		if matches[0].ClientHelloID != "Firefox-120" || matches[0].Distance != 0 || !matches[0].NormHexIDSame {
+			t.Errorf("Firefox 126 is expected to match Firefox-120 exactly, got %+v", matches[0])
+		}
+
+		for _, m := range matches {
+			if m.ClientHelloID != "Firefox-105" {
+				continue
+			}
+			expected := []UTLSParrotDifference{{Field: "extensions", Missing: []string{"0x0015"}, Extra: []string{"0xfe0d"}}}
+			if m.Distance != 2 || m.NormHexIDSame || !reflect.DeepEqual(m.Differences, expected) {
+				t.Errorf("Firefox-105 differences mismatch, expecting %+v, got %+v", expected, m)
+			}
+		}
+	})
+
+	t.Run("Chrome120", func(t *testing.T) {
+		ch := uTLSClientHello(t, tls.HelloChrome_120, nil, 0x0301) // extensions shuffled differently from the catalog
+
+		matches := ch.NearestUTLSParrots(1)
+		if len(matches) != 1 {
+			t.Fatalf("only the nearest parrot is expected, got %d", len(matches))
+		}
+		if matches[0].ClientHelloID != "Chrome-120" || matches[0].Distance != 0 || !matches[0].NormHexIDSame {
+			t.Errorf("uTLS Chrome 120 is expected to match Chrome-120, got %+v", matches[0])
+		}
+	})
+}